@@ -0,0 +1,28 @@
+// cmd/mockpay/main.go
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+
+	"nexus.local/internal/payments"
+)
+
+// mockpay runs payments.Mock as a stand‑in payment provider, for trying
+// the PAYMENT_GATEWAY=http path locally. State is kept in memory only.
+func main() {
+	addr := os.Getenv("MOCKPAY_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:8090"
+	}
+	mock := payments.NewMock(os.Getenv("PAYMENT_WEBHOOK_SECRET"))
+	mock.APIKey = os.Getenv("PAYMENT_API_KEY")
+	mock.WebhookURL = os.Getenv("MOCKPAY_WEBHOOK_URL")
+
+	slog.Info("starting mock payment provider", slog.String("addr", addr))
+	if err := http.ListenAndServe(addr, mock); err != nil {
+		slog.Error("mock payment provider failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,121 @@
+// cmd/replayevents/main.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/joho/godotenv"
+
+	"nexus.local/internal/config"
+	"nexus.local/internal/db"
+	"nexus.local/internal/payments"
+)
+
+// replayevents re‑sends stored payment webhook events to a running server,
+// signed the way the mock gateway signs them, to test webhook handling.
+// Replayed as they are, events are recognised as duplicates and change
+// nothing; with -fresh each gets a new ID and is applied again.
+//
+//	go run ./cmd/replayevents -since 1h
+//	go run ./cmd/replayevents -event evt_123 -fresh
+func main() {
+	url := flag.String("url", "http://localhost:8080/webhooks/payments", "webhook endpoint to send events to")
+	since := flag.Duration("since", 24*time.Hour, "replay events received within this long")
+	eventID := flag.String("event", "", "replay only this event ID")
+	fresh := flag.Bool("fresh", false, "give each event a new ID so it is applied again")
+	dryRun := flag.Bool("dry-run", false, "list the events without sending them")
+	flag.Parse()
+
+	godotenv.Load()
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if secret == "" && !*dryRun {
+		fatal("PAYMENT_WEBHOOK_SECRET must be set to sign the events", nil)
+	}
+	cfg, err := config.LoadDB()
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+	ctx := context.Background()
+	connectCtx, cancel := context.WithTimeout(ctx, cfg.ConnectTimeout)
+	sqlDB, err := db.Connect(connectCtx, db.Options{
+		Driver:       cfg.Driver,
+		User:         cfg.User,
+		Pass:         cfg.Pass,
+		Host:         cfg.Host,
+		Port:         cfg.Port,
+		Name:         cfg.Name,
+		SSLMode:      cfg.SSLMode,
+		MaxOpenConns: 1,
+		QueryTimeout: cfg.QueryTimeout,
+	})
+	cancel()
+	if err != nil {
+		fatal("DB connect error", err)
+	}
+	defer sqlDB.Close()
+
+	events, err := db.ListPaymentEvents(ctx, sqlDB, time.Now().Add(-*since), *eventID)
+	if err != nil {
+		fatal("could not load events", err)
+	}
+	if len(events) == 0 {
+		fmt.Println("no events to replay")
+		return
+	}
+
+	failed := 0
+	for i, ev := range events {
+		payload := ev.Payload
+		id := ev.ID
+		if *fresh {
+			id = fmt.Sprintf("%s_replay_%d_%d", ev.ID, time.Now().Unix(), i)
+			if payload, err = withID(payload, id); err != nil {
+				fatal("could not rewrite event "+ev.ID, err)
+			}
+		}
+		fmt.Printf("%s %-20s %-28s order=%d was=%s", id, ev.Type, ev.PaymentID, ev.OrderID, ev.Outcome)
+		if *dryRun {
+			fmt.Println()
+			continue
+		}
+		if err := payments.SendPayload(ctx, http.DefaultClient, *url, []byte(secret), payload); err != nil {
+			failed++
+			fmt.Printf(" FAILED: %v\n", err)
+			continue
+		}
+		fmt.Println(" sent")
+	}
+	if failed > 0 {
+		fatal(fmt.Sprintf("%d of %d events failed", failed, len(events)), nil)
+	}
+}
+
+// withID returns payload with its "id" field replaced, keeping every
+// other field as it was.
+func withID(payload []byte, id string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+	raw, _ := json.Marshal(id)
+	fields["id"] = raw
+	return json.Marshal(fields)
+}
+
+// fatal logs msg with err and exits.
+func fatal(msg string, err error) {
+	if err != nil {
+		slog.Error(msg, slog.Any("error", err))
+	} else {
+		slog.Error(msg)
+	}
+	os.Exit(1)
+}
@@ -5,9 +5,10 @@ import (
 	"context"
 	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc"
 	_ "github.com/go-sql-driver/mysql"
@@ -15,58 +16,105 @@ import (
 	"golang.org/x/oauth2"
 
 	"nexus.local/internal/auth"
+	"nexus.local/internal/buildinfo"
+	"nexus.local/internal/config"
 	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+	"nexus.local/internal/metrics"
+	"nexus.local/internal/payments"
 	"nexus.local/internal/server"
+	"nexus.local/internal/storage"
+	"nexus.local/internal/tracing"
 )
 
 func main() {
-	// 0) ensure uploads dir exists
-	if err := os.MkdirAll("uploads", 0755); err != nil {
-		log.Fatalf("could not create uploads dir: %v", err)
+	// 1) Load .env (optional) and the config
+	envErr := godotenv.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("invalid configuration", err)
 	}
-
-	// 1) Load .env (optional)
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found, relying on real ENV")
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fatal("could not create logger", err)
+	}
+	slog.SetDefault(logger)
+	if envErr != nil {
+		slog.Warn(".env file not found, relying on real ENV")
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: "nexus-local",
+		Version:     buildinfo.Version,
+	})
+	if err != nil {
+		fatal("could not set up tracing", err)
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
 
 	// 2) Connect to the database
-	dbUser := os.Getenv("DB_USER")
-	dbPass := os.Getenv("DB_PASS")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
-	sqlDB, err := db.Connect(dbUser, dbPass, dbHost, dbPort, dbName)
+	connectCtx, cancel := context.WithTimeout(context.Background(), cfg.DB.ConnectTimeout)
+	sqlDB, err := db.Connect(connectCtx, db.Options{
+		Driver:          cfg.DB.Driver,
+		User:            cfg.DB.User,
+		Pass:            cfg.DB.Pass,
+		Host:            cfg.DB.Host,
+		Port:            cfg.DB.Port,
+		Name:            cfg.DB.Name,
+		SSLMode:         cfg.DB.SSLMode,
+		MaxOpenConns:    cfg.DB.MaxOpenConns,
+		MaxIdleConns:    cfg.DB.MaxIdleConns,
+		ConnMaxLifetime: cfg.DB.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.DB.ConnMaxIdleTime,
+		QueryTimeout:    cfg.DB.QueryTimeout,
+	})
+	cancel()
 	if err != nil {
-		log.Fatalf("DB connect error: %v", err)
+		fatal("DB connect error", err)
 	}
 	defer sqlDB.Close()
-	log.Println("✅ Connected to database.")
+	metrics.RegisterDB(sqlDB.DB, cfg.DB.Name)
+	slog.Info("connected to database",
+		slog.String("driver", sqlDB.Driver()), slog.String("host", cfg.DB.Host), slog.String("name", cfg.DB.Name))
+	if err := db.Migrate(context.Background(), sqlDB); err != nil {
+		fatal("DB migration error", err)
+	}
 
-	// 3) Azure AD / OAuth2 settings
-	tenantID := os.Getenv("AZUREAD_TENANT_ID")
-	clientID := os.Getenv("AZUREAD_APP_ID")
-	clientSecret := os.Getenv("AZUREAD_VALUE")
-	if tenantID == "" || clientID == "" || clientSecret == "" {
-		log.Fatal("Missing one of AZUREAD_TENANT_ID, AZUREAD_APP_ID, AZUREAD_VALUE")
+	// 2b) Blob store for uploaded images
+	blobs, err := newBlobStore(cfg.Blob)
+	if err != nil {
+		fatal("could not set up blob store", err)
 	}
 
+	// 3) Azure AD / OAuth2 settings
 	oauthCfg := &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
+		ClientID:     cfg.Azure.ClientID,
+		ClientSecret: cfg.Azure.ClientSecret,
 		RedirectURL:  "http://localhost:8080/redirect",
 		Scopes:       []string{"openid", "profile", "email", "offline_access", "User.Read.All"},
 	}
 
-	// 4) OIDC provider & verifier
-	ctx := context.Background()
-	issuer := fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0", tenantID)
+	// 4) OIDC provider & verifier (discovery and key fetches are traced)
+	ctx := oidc.ClientContext(context.Background(), tracing.HTTPClient)
+	issuer := fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0", cfg.Azure.TenantID)
 	provider, err := oidc.NewProvider(ctx, issuer)
 	if err != nil {
-		log.Fatalf("Failed to initialize OIDC provider: %v", err)
+		fatal("failed to initialize OIDC provider", err)
 	}
 	oauthCfg.Endpoint = provider.Endpoint()
-	verifier := provider.Verifier(&oidc.Config{ClientID: clientID})
+	verifier := provider.Verifier(&oidc.Config{ClientID: cfg.Azure.ClientID})
+	var discovery struct {
+		JWKSURL string `json:"jwks_uri"`
+	}
+	if err := provider.Claims(&discovery); err != nil {
+		fatal("failed to read OIDC discovery document", err)
+	}
 
 	// 5) Parse login template
 	tmpl := template.Must(
@@ -77,11 +125,66 @@ func main() {
 
 	// 6) Build the AuthApp (now with a live *sql.DB)
 	authApp := auth.NewApp(oauthCfg, verifier, tmpl, sqlDB)
+	authApp.JWKSURL = discovery.JWKSURL
 
 	// 7) Wire up and start your HTTP server
-	srv := server.NewServer(authApp, sqlDB)
-	log.Println("🚀 Starting server on :8080")
-	if err := srv.Start(":8080"); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	srv := server.NewServer(authApp, sqlDB, blobs, cfg.Blob.Path)
+	srv.IdempotencyTTL = cfg.IdempotencyTTL
+	srv.HoldTTL = cfg.HoldTTL
+	srv.Payments = newGateway(cfg.Payment)
+	srv.Currency = cfg.Payment.Currency
+	go srv.ReapHolds(context.Background(), time.Minute)
+	go func() {
+		slog.Info("starting admin listener", slog.String("addr", cfg.AdminAddr))
+		if err := srv.StartAdmin(cfg.AdminAddr); err != nil {
+			fatal("admin listener failed", err)
+		}
+	}()
+	slog.Info("starting server", slog.String("addr", cfg.Addr), slog.String("version", buildinfo.Version))
+	if err := srv.Start(cfg.Addr); err != nil {
+		fatal("server failed", err)
 	}
 }
+
+// newBlobStore builds the configured storage.BlobStore.
+func newBlobStore(cfg config.Blob) (storage.BlobStore, error) {
+	if cfg.Store == "s3" {
+		return &storage.S3{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			PublicURL: cfg.S3.PublicURL,
+			URLTTL:    cfg.URLTTL,
+		}, nil
+	}
+	local, err := storage.NewLocal(cfg.Dir, cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.URLTTL > 0 {
+		local.SigningKey = []byte(cfg.SigningKey)
+		local.URLTTL = cfg.URLTTL
+	}
+	return local, nil
+}
+
+// newGateway builds the configured payments.Gateway.
+func newGateway(cfg config.Payment) payments.Gateway {
+	if cfg.Gateway == "http" {
+		return &payments.HTTP{
+			BaseURL:       cfg.URL,
+			APIKey:        cfg.APIKey,
+			WebhookSecret: []byte(cfg.WebhookSecret),
+		}
+	}
+	slog.Warn("using the mock payment gateway; no real payments are taken")
+	return payments.NewMock(cfg.WebhookSecret)
+}
+
+// fatal logs msg with err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
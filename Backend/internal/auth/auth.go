@@ -2,13 +2,19 @@ package auth
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"fmt"
 	"html/template"
+	"log/slog"
 	"net/http"
 
 	"github.com/coreos/go-oidc"
 	"golang.org/x/oauth2"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+	"nexus.local/internal/metrics"
+	"nexus.local/internal/tracing"
 )
 
 // ctxKey is the type we use for context keys in this package
@@ -28,32 +34,56 @@ type App struct {
 	OAuthCfg *oauth2.Config
 	Verifier *oidc.IDTokenVerifier
 	Tmpl     *template.Template
-	DB       *sql.DB
+	DB       *db.DB
+
+	// OnError, if set, writes error responses for the auth handlers so they
+	// match the rest of the API. It defaults to a plain‑text http.Error.
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+
+	// OnLogin, if set, runs after a successful sign‑in with the user's
+	// Azure OID, before the redirect; it may set cookies on w.
+	OnLogin func(w http.ResponseWriter, r *http.Request, userID string)
+
+	// JWKSURL is the provider's signing‑key endpoint, used by CheckKeys.
+	JWKSURL string
+	keys    keyCheck
 }
 
 // NewApp constructs a new App.
-func NewApp(oauthCfg *oauth2.Config, verifier *oidc.IDTokenVerifier, tmpl *template.Template, db *sql.DB) *App {
+func NewApp(oauthCfg *oauth2.Config, verifier *oidc.IDTokenVerifier, tmpl *template.Template, database *db.DB) *App {
 	return &App{
 		OAuthCfg: oauthCfg,
 		Verifier: verifier,
 		Tmpl:     tmpl,
-		DB:       db,
+		DB:       database,
 	}
 }
 
 var (
-	ErrNoAuthHeader = errors.New("no authorization cookie")
-	ErrInvalidToken = errors.New("invalid token")
-	ErrForbidden    = errors.New("forbidden")
+	ErrNoAuthHeader  = errors.New("no authorization cookie")
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrUnknownUser   = errors.New("user not found")
+	ErrForbidden     = errors.New("forbidden")
+	ErrMissingCode   = errors.New("missing code")
+	ErrTokenExchange = errors.New("token exchange failed")
 )
 
+// fail reports err through OnError, falling back to http.Error.
+func (a *App) fail(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if a.OnError != nil {
+		a.OnError(w, r, err)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
 // AuthMiddleware verifies the cookie, looks up is_admin in MySQL, and rejects non‑admins.
 func (a *App) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 1) Grab the ID token from the cookie
 		ck, err := r.Cookie("id_token")
 		if err != nil {
-			http.Error(w, ErrNoAuthHeader.Error(), http.StatusUnauthorized)
+			a.fail(w, r, ErrNoAuthHeader, http.StatusUnauthorized)
 			return
 		}
 
@@ -61,7 +91,7 @@ func (a *App) AuthMiddleware(next http.Handler) http.Handler {
 		rawID := ck.Value
 		idToken, err := a.Verifier.Verify(r.Context(), rawID)
 		if err != nil {
-			http.Error(w, ErrInvalidToken.Error(), http.StatusUnauthorized)
+			a.fail(w, r, fmt.Errorf("%w: %v", ErrInvalidToken, err), http.StatusUnauthorized)
 			return
 		}
 
@@ -70,32 +100,27 @@ func (a *App) AuthMiddleware(next http.Handler) http.Handler {
 			OID string `json:"oid"`
 		}
 		if err := idToken.Claims(&claims); err != nil {
-			http.Error(w, "failed to parse token claims", http.StatusInternalServerError)
+			a.fail(w, r, fmt.Errorf("parse token claims: %w", err), http.StatusInternalServerError)
 			return
 		}
 
 		// 4) Look up is_admin in your users table
-		var isAdmin bool
-		err = a.DB.QueryRowContext(
-			r.Context(),
-			"SELECT is_admin FROM users WHERE id = ?",
-			claims.OID,
-		).Scan(&isAdmin)
-
-		if err == sql.ErrNoRows {
-			http.Error(w, "user not found", http.StatusUnauthorized)
+		isAdmin, err := db.IsAdmin(r.Context(), a.DB, claims.OID)
+		if errors.Is(err, db.ErrNotFound) {
+			a.fail(w, r, ErrUnknownUser, http.StatusUnauthorized)
 			return
 		} else if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			a.fail(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
 		if !isAdmin {
-			http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+			a.fail(w, r, ErrForbidden, http.StatusForbidden)
 			return
 		}
 
 		// 5) Inject the user ID into context for downstream handlers
+		logging.Annotate(r.Context(), slog.String("user_id", claims.OID))
 		ctx := context.WithValue(r.Context(), ContextKeyUser, claims.OID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -107,7 +132,7 @@ func (a *App) Root(w http.ResponseWriter, r *http.Request) {
 	loginURL := a.OAuthCfg.AuthCodeURL(state, oauth2.AccessTypeOffline)
 	data := PageData{LoginURL: loginURL, RedirectURL: a.OAuthCfg.RedirectURL}
 	if err := a.Tmpl.ExecuteTemplate(w, "index.html", data); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.fail(w, r, err, http.StatusInternalServerError)
 	}
 }
 
@@ -123,15 +148,19 @@ func (a *App) Login(w http.ResponseWriter, r *http.Request) {
 func (a *App) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 	code := r.URL.Query().Get("code")
 	if code == "" {
-		http.Error(w, "missing code", http.StatusBadRequest)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		a.fail(w, r, ErrMissingCode, http.StatusBadRequest)
 		return
 	}
 
-	token, err := a.OAuthCfg.Exchange(context.Background(), code)
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, tracing.HTTPClient)
+	token, err := a.OAuthCfg.Exchange(ctx, code)
 	if err != nil {
-		http.Error(w, "token exchange failed: "+err.Error(), http.StatusInternalServerError)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		a.fail(w, r, fmt.Errorf("%w: %v", ErrTokenExchange, err), http.StatusBadGateway)
 		return
 	}
+	metrics.Logins.WithLabelValues("success").Inc()
 
 	// Extract raw ID token + access token
 	idt, _ := token.Extra("id_token").(string)
@@ -155,6 +184,17 @@ func (a *App) OAuthCallback(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteNoneMode,
 	})
 
+	if a.OnLogin != nil {
+		if tok, err := a.Verifier.Verify(r.Context(), idt); err == nil {
+			var claims struct {
+				OID string `json:"oid"`
+			}
+			if tok.Claims(&claims) == nil && claims.OID != "" {
+				a.OnLogin(w, r, claims.OID)
+			}
+		}
+	}
+
 	// Redirect back to your front‑end
 	http.Redirect(w, r, "http://localhost:3000/admin/add-item", http.StatusFound)
 }
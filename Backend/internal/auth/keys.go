@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"nexus.local/internal/tracing"
+)
+
+// keysCacheTTL is how long a successful key check is trusted.
+const keysCacheTTL = 5 * time.Minute
+
+// keyCheck remembers the last successful signing‑key fetch.
+type keyCheck struct {
+	mu     sync.Mutex
+	lastOK time.Time
+}
+
+// CheckKeys reports whether the provider's signing keys (JWKSURL) can be
+// loaded, i.e. whether we are able to verify ID tokens at all. Successes
+// are cached for keysCacheTTL so readiness probes don't hammer Entra ID.
+func (a *App) CheckKeys(ctx context.Context) error {
+	if a.JWKSURL == "" {
+		return errors.New("no JWKS URL configured")
+	}
+	a.keys.mu.Lock()
+	fresh := time.Since(a.keys.lastOK) < keysCacheTTL
+	a.keys.mu.Unlock()
+	if fresh {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.JWKSURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := tracing.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS endpoint returned %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode JWKS: %w", err)
+	}
+	if len(set.Keys) == 0 {
+		return errors.New("JWKS contains no keys")
+	}
+
+	a.keys.mu.Lock()
+	a.keys.lastOK = time.Now()
+	a.keys.mu.Unlock()
+	return nil
+}
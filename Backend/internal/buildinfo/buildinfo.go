@@ -0,0 +1,40 @@
+// internal/buildinfo/buildinfo.go
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version and Commit are set at link time, e.g.
+//
+//	go build -ldflags "-X nexus.local/internal/buildinfo.Version=v1.2.0 \
+//	  -X nexus.local/internal/buildinfo.Commit=$(git rev-parse HEAD)" ./cmd/server
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+// Info describes the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info. If Commit wasn't injected it falls back to
+// the VCS revision the Go toolchain stamps into module builds.
+func Get() Info {
+	commit := Commit
+	if commit == "" {
+		commit = "unknown"
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range bi.Settings {
+				if s.Key == "vcs.revision" {
+					commit = s.Value
+				}
+			}
+		}
+	}
+	return Info{Version: Version, Commit: commit, GoVersion: runtime.Version()}
+}
@@ -0,0 +1,279 @@
+// internal/config/config.go
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexus.local/internal/logging"
+)
+
+// Config holds every setting the server reads from the environment.
+type Config struct {
+	Addr      string // LISTEN_ADDR
+	AdminAddr string // ADMIN_ADDR: private listener for /metrics
+
+	IdempotencyTTL time.Duration // IDEMPOTENCY_TTL: how long order Idempotency-Keys are kept, default 24h
+	HoldTTL        time.Duration // STOCK_HOLD_TTL: how long checkout stock holds last, default 10m
+
+	DB      DB
+	Blob    Blob
+	Payment Payment
+	Azure   Azure
+	Log     Log
+	Tracing Tracing
+}
+
+// DB holds the database connection settings.
+type DB struct {
+	Driver string // DB_DRIVER: mysql (default), sqlite or postgres
+
+	User string // DB_USER
+	Pass string // DB_PASS
+	Host string // DB_HOST
+	Port string // DB_PORT
+	Name string // DB_NAME: the database, or for sqlite the file path (default nexus.db)
+
+	SSLMode string // DB_SSLMODE: postgres sslmode, default prefer
+
+	QueryTimeout time.Duration // DB_QUERY_TIMEOUT: per data‑access call, default 5s
+
+	MaxOpenConns    int           // DB_MAX_OPEN_CONNS, default 25
+	MaxIdleConns    int           // DB_MAX_IDLE_CONNS, default 10
+	ConnMaxLifetime time.Duration // DB_CONN_MAX_LIFETIME, default 5m
+	ConnMaxIdleTime time.Duration // DB_CONN_MAX_IDLE_TIME, default 1m
+	ConnectTimeout  time.Duration // DB_CONNECT_TIMEOUT: how long startup waits for the DB, default 60s
+}
+
+// Blob selects where uploaded images are kept and how their URLs look.
+type Blob struct {
+	Store      string        // BLOB_STORE: local (default) or s3
+	Dir        string        // BLOB_DIR: directory for the local store, default uploads
+	Path       string        // BLOB_PATH: URL path the local store is served under, default /uploads
+	URLTTL     time.Duration // BLOB_URL_TTL: lifetime of signed URLs; 0 (default) means public URLs
+	SigningKey string        // BLOB_SIGNING_KEY: HMAC key for signed local URLs
+
+	S3 S3
+}
+
+// S3 describes an S3‑compatible bucket (AWS, MinIO, …).
+type S3 struct {
+	Endpoint  string // S3_ENDPOINT, e.g. https://s3.eu-west-1.amazonaws.com
+	Region    string // S3_REGION, default us-east-1
+	Bucket    string // S3_BUCKET
+	AccessKey string // S3_ACCESS_KEY
+	SecretKey string // S3_SECRET_KEY
+	PublicURL string // S3_PUBLIC_URL: base for public URLs, e.g. a CDN; default endpoint/bucket
+}
+
+// Payment selects the payment gateway.
+type Payment struct {
+	Gateway       string // PAYMENT_GATEWAY: mock (default, in‑process) or http
+	URL           string // PAYMENT_URL: base URL of the http gateway, e.g. cmd/mockpay
+	APIKey        string // PAYMENT_API_KEY
+	WebhookSecret string // PAYMENT_WEBHOOK_SECRET: verifies webhook signatures
+	Currency      string // PAYMENT_CURRENCY: ISO 4217 code, default usd
+}
+
+// Azure holds the Entra ID app registration.
+type Azure struct {
+	TenantID     string // AZUREAD_TENANT_ID
+	ClientID     string // AZUREAD_APP_ID
+	ClientSecret string // AZUREAD_VALUE
+}
+
+// Log controls the structured logger.
+type Log struct {
+	Format string     // LOG_FORMAT: "text" (default) or "json"
+	Level  slog.Level // LOG_LEVEL: debug, info (default), warn or error
+}
+
+// Tracing selects where OpenTelemetry spans are exported.
+type Tracing struct {
+	Exporter    string  // TRACE_EXPORTER: none (default), stdout, file or otlp
+	File        string  // TRACE_FILE: output path for the file exporter
+	SampleRatio float64 // TRACE_SAMPLE_RATIO: fraction of new traces kept, default 1
+}
+
+// Load reads the configuration from the environment. It reports every
+// missing or malformed setting at once.
+func Load() (*Config, error) {
+	var errs []error
+	cfg := &Config{
+		Addr:      getenv("LISTEN_ADDR", ":8080"),
+		AdminAddr: getenv("ADMIN_ADDR", "127.0.0.1:9090"),
+		DB:        loadDB(&errs),
+		Blob: Blob{
+			Store:      strings.ToLower(getenv("BLOB_STORE", "local")),
+			Dir:        getenv("BLOB_DIR", "uploads"),
+			Path:       strings.TrimSuffix(getenv("BLOB_PATH", "/uploads"), "/"),
+			SigningKey: os.Getenv("BLOB_SIGNING_KEY"),
+			S3: S3{
+				Endpoint:  os.Getenv("S3_ENDPOINT"),
+				Region:    getenv("S3_REGION", "us-east-1"),
+				Bucket:    os.Getenv("S3_BUCKET"),
+				AccessKey: os.Getenv("S3_ACCESS_KEY"),
+				SecretKey: os.Getenv("S3_SECRET_KEY"),
+				PublicURL: os.Getenv("S3_PUBLIC_URL"),
+			},
+		},
+		Payment: Payment{
+			Gateway:       strings.ToLower(getenv("PAYMENT_GATEWAY", "mock")),
+			URL:           os.Getenv("PAYMENT_URL"),
+			APIKey:        os.Getenv("PAYMENT_API_KEY"),
+			WebhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+			Currency:      strings.ToLower(getenv("PAYMENT_CURRENCY", "usd")),
+		},
+		Azure: Azure{
+			TenantID:     os.Getenv("AZUREAD_TENANT_ID"),
+			ClientID:     os.Getenv("AZUREAD_APP_ID"),
+			ClientSecret: os.Getenv("AZUREAD_VALUE"),
+		},
+		Log: Log{
+			Format: strings.ToLower(getenv("LOG_FORMAT", "text")),
+		},
+		Tracing: Tracing{
+			Exporter: strings.ToLower(getenv("TRACE_EXPORTER", "none")),
+			File:     getenv("TRACE_FILE", "traces.jsonl"),
+		},
+	}
+
+	if cfg.Azure.TenantID == "" || cfg.Azure.ClientID == "" || cfg.Azure.ClientSecret == "" {
+		errs = append(errs, errors.New("missing one of AZUREAD_TENANT_ID, AZUREAD_APP_ID, AZUREAD_VALUE"))
+	}
+	if cfg.Log.Format != "text" && cfg.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT must be text or json, got %q", cfg.Log.Format))
+	}
+	level, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %w", err))
+	}
+	cfg.Log.Level = level
+	cfg.IdempotencyTTL = getDuration("IDEMPOTENCY_TTL", 24*time.Hour, &errs)
+	cfg.HoldTTL = getDuration("STOCK_HOLD_TTL", 10*time.Minute, &errs)
+	cfg.Blob.URLTTL = getDuration("BLOB_URL_TTL", 0, &errs)
+	switch cfg.Blob.Store {
+	case "local":
+		if cfg.Blob.URLTTL > 0 && cfg.Blob.SigningKey == "" {
+			errs = append(errs, errors.New("BLOB_URL_TTL needs BLOB_SIGNING_KEY for the local store"))
+		}
+		if !strings.HasPrefix(cfg.Blob.Path, "/") || cfg.Blob.Path == "" {
+			errs = append(errs, fmt.Errorf("BLOB_PATH must be an absolute URL path, got %q", cfg.Blob.Path))
+		}
+	case "s3":
+		if cfg.Blob.S3.Endpoint == "" || cfg.Blob.S3.Bucket == "" || cfg.Blob.S3.AccessKey == "" || cfg.Blob.S3.SecretKey == "" {
+			errs = append(errs, errors.New("BLOB_STORE=s3 needs S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("BLOB_STORE must be local or s3, got %q", cfg.Blob.Store))
+	}
+	switch cfg.Payment.Gateway {
+	case "mock":
+	case "http":
+		if cfg.Payment.URL == "" || cfg.Payment.WebhookSecret == "" {
+			errs = append(errs, errors.New("PAYMENT_GATEWAY=http needs PAYMENT_URL and PAYMENT_WEBHOOK_SECRET"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("PAYMENT_GATEWAY must be mock or http, got %q", cfg.Payment.Gateway))
+	}
+	if len(cfg.Payment.Currency) != 3 {
+		errs = append(errs, fmt.Errorf("PAYMENT_CURRENCY must be a 3-letter ISO 4217 code, got %q", cfg.Payment.Currency))
+	}
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "file", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("TRACE_EXPORTER must be none, stdout, file or otlp, got %q", cfg.Tracing.Exporter))
+	}
+	ratio, err := strconv.ParseFloat(getenv("TRACE_SAMPLE_RATIO", "1"), 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		errs = append(errs, fmt.Errorf("TRACE_SAMPLE_RATIO must be a number between 0 and 1"))
+	}
+	cfg.Tracing.SampleRatio = ratio
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadDB reads just the database settings, for tools that only need the
+// database.
+func LoadDB() (*DB, error) {
+	var errs []error
+	cfg := loadDB(&errs)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func loadDB(errs *[]error) DB {
+	cfg := DB{
+		Driver: strings.ToLower(getenv("DB_DRIVER", "mysql")),
+		User:   os.Getenv("DB_USER"),
+		Pass:   os.Getenv("DB_PASS"),
+		Host:   os.Getenv("DB_HOST"),
+		Port:   os.Getenv("DB_PORT"),
+		Name:   os.Getenv("DB_NAME"),
+
+		SSLMode: getenv("DB_SSLMODE", "prefer"),
+	}
+	switch cfg.Driver {
+	case "mysql", "postgres":
+	case "sqlite":
+		if cfg.Name == "" {
+			cfg.Name = "nexus.db"
+		}
+	default:
+		*errs = append(*errs, fmt.Errorf("DB_DRIVER must be mysql, sqlite or postgres, got %q", cfg.Driver))
+	}
+	cfg.QueryTimeout = getDuration("DB_QUERY_TIMEOUT", 5*time.Second, errs)
+	cfg.MaxOpenConns = getInt("DB_MAX_OPEN_CONNS", 25, errs)
+	cfg.MaxIdleConns = getInt("DB_MAX_IDLE_CONNS", 10, errs)
+	cfg.ConnMaxLifetime = getDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute, errs)
+	cfg.ConnMaxIdleTime = getDuration("DB_CONN_MAX_IDLE_TIME", time.Minute, errs)
+	cfg.ConnectTimeout = getDuration("DB_CONNECT_TIMEOUT", time.Minute, errs)
+	return cfg
+}
+
+// getenv returns the value of key, or def if it is unset or empty.
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// getInt parses key as a non‑negative integer, recording a problem in errs.
+func getInt(key string, def int, errs *[]error) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		*errs = append(*errs, fmt.Errorf("%s must be a non-negative integer, got %q", key, v))
+		return def
+	}
+	return n
+}
+
+// getDuration parses key as a time.Duration ("500ms", "2m"), recording a
+// problem in errs.
+func getDuration(key string, def time.Duration, errs *[]error) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		*errs = append(*errs, fmt.Errorf("%s must be a duration such as 5s, got %q", key, v))
+		return def
+	}
+	return d
+}
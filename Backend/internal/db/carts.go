@@ -0,0 +1,292 @@
+// internal/db/carts.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CartLine is one item in a cart, with the item's current price and the
+// stock the cart can have of it.
+type CartLine struct {
+	ItemID   int     `json:"item_id"`
+	Name     string  `json:"name"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+	Stock    int     `json:"stock"` // less what others hold; checked again at checkout
+}
+
+// UserCart returns the ID of userID's cart, creating it if needed.
+func UserCart(ctx context.Context, db *DB, userID string) (_ int64, err error) {
+	ctx, end := db.startOp(ctx, "UserCart")
+	defer end(&err)
+	return cartFor(ctx, db, "user_id", userID, true)
+}
+
+// TokenCart returns the ID of the anonymous cart with the given cookie
+// token. With create it makes the cart if needed; without, a missing cart
+// is ErrNotFound.
+func TokenCart(ctx context.Context, db *DB, token string, create bool) (_ int64, err error) {
+	ctx, end := db.startOp(ctx, "TokenCart")
+	defer end(&err)
+	return cartFor(ctx, db, "token", token, create)
+}
+
+// cartFor finds the cart whose column (user_id or token) equals value.
+// Two requests may race to create the same cart; the loser sees the
+// unique‑key violation and reads the winner's row.
+func cartFor(ctx context.Context, db *DB, column, value string, create bool) (int64, error) {
+	query := "SELECT id FROM carts WHERE " + column + " = ?"
+	var id int64
+	err := db.QueryRowContext(ctx, query, value).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+	if !create {
+		return 0, fmt.Errorf("cart: %w", ErrNotFound)
+	}
+	now := time.Now().UTC()
+	id, err = db.insertID(ctx, db,
+		"INSERT INTO carts ("+column+", created_at, updated_at) VALUES (?, ?, ?)",
+		value, now, now,
+	)
+	if err != nil && db.dialect.constraint(err) {
+		err = db.QueryRowContext(ctx, query, value).Scan(&id)
+	}
+	return id, err
+}
+
+// GetCart returns the lines of a cart, in the order they were added.
+func GetCart(ctx context.Context, db *DB, cartID int64) (_ []CartLine, err error) {
+	ctx, end := db.startOp(ctx, "GetCart")
+	defer end(&err)
+	return cartLines(ctx, db, cartID)
+}
+
+// querier is what cartLines needs; both *DB and *dbTx provide it.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func cartLines(ctx context.Context, q querier, cartID int64) ([]CartLine, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT ci.item_id, items.name, items.price, ci.quantity, items.stock - `+heldByOthers+`
+        FROM cart_items ci
+        JOIN items ON items.id = ci.item_id
+        WHERE ci.cart_id = ?
+        ORDER BY items.name, ci.item_id`,
+		CartHolder(cartID), time.Now().UTC(), cartID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lines := []CartLine{}
+	for rows.Next() {
+		var l CartLine
+		if err := rows.Scan(&l.ItemID, &l.Name, &l.Price, &l.Quantity, &l.Stock); err != nil {
+			return nil, err
+		}
+		l.Stock = max(l.Stock, 0)
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+// SetCartItem puts quantity of an item in the cart, or with add, adds
+// quantity to what is already there. It fails with ErrNotFound for an
+// unknown item and ErrInsufficientStock if the cart would hold more than
+// is in stock and not held by others. Stock isn't reserved unless the cart
+// is held (see HoldStock): checkout checks it again.
+func SetCartItem(ctx context.Context, db *DB, cartID int64, itemID, quantity int, add bool) (err error) {
+	ctx, end := db.startOp(ctx, "SetCartItem")
+	defer end(&err)
+	return db.inTx(ctx, nil, func(tx *dbTx) error {
+		var stock int
+		err := tx.QueryRowContext(ctx,
+			"SELECT stock - "+heldByOthers+" FROM items WHERE id = ?",
+			CartHolder(cartID), time.Now().UTC(), itemID,
+		).Scan(&stock)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("item %d: %w", itemID, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if add {
+			var have int
+			err := tx.QueryRowContext(ctx,
+				"SELECT quantity FROM cart_items WHERE cart_id = ? AND item_id = ?", cartID, itemID,
+			).Scan(&have)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			quantity += have
+		}
+		if quantity > stock {
+			return fmt.Errorf("item %d: %d requested, %d available: %w", itemID, quantity, max(stock, 0), ErrInsufficientStock)
+		}
+		return putCartLine(ctx, tx, cartID, itemID, quantity)
+	})
+}
+
+// putCartLine upserts one cart line and bumps the cart's updated_at.
+func putCartLine(ctx context.Context, tx *dbTx, cartID int64, itemID, quantity int) error {
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO cart_items (cart_id, item_id, quantity) VALUES (?, ?, ?) "+
+			tx.dialect.upsert("cart_id, item_id", []string{"quantity"}),
+		cartID, itemID, quantity,
+	); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "UPDATE carts SET updated_at = ? WHERE id = ?", time.Now().UTC(), cartID)
+	return err
+}
+
+// RemoveCartItem takes an item out of the cart. Removing an item that
+// isn't there is not an error.
+func RemoveCartItem(ctx context.Context, db *DB, cartID int64, itemID int) (err error) {
+	ctx, end := db.startOp(ctx, "RemoveCartItem")
+	defer end(&err)
+	_, err = db.ExecContext(ctx, "DELETE FROM cart_items WHERE cart_id = ? AND item_id = ?", cartID, itemID)
+	return err
+}
+
+// MergeCarts moves every line of the anonymous cart fromID into intoID and
+// deletes fromID. Quantities of items in both carts are added up, but
+// capped at what intoID can have of the item's stock so the merged cart
+// stays valid. fromID's holds move to intoID with its lines, added to what
+// intoID holds but never more than the merged line.
+func MergeCarts(ctx context.Context, db *DB, fromID, intoID int64) (err error) {
+	ctx, end := db.startOp(ctx, "MergeCarts")
+	defer end(&err)
+	if fromID == intoID {
+		return nil
+	}
+	return db.inTx(ctx, nil, func(tx *dbTx) error {
+		now := time.Now().UTC()
+		from, err := cartLines(ctx, tx, fromID)
+		if err != nil {
+			return err
+		}
+		into, err := cartLines(ctx, tx, intoID)
+		if err != nil {
+			return err
+		}
+		fromHolds, err := liveHolds(ctx, tx, CartHolder(fromID), now)
+		if err != nil {
+			return err
+		}
+		intoHolds, err := liveHolds(ctx, tx, CartHolder(intoID), now)
+		if err != nil {
+			return err
+		}
+		heldInto := make(map[int]Hold, len(intoHolds))
+		for _, h := range intoHolds {
+			heldInto[h.ItemID] = h
+		}
+
+		// 1) the lines; fromID's Stock counts intoID's holds as others', but
+		// they are intoID's own
+		have := make(map[int]int, len(into))
+		for _, l := range into {
+			have[l.ItemID] = l.Quantity
+		}
+		for _, l := range from {
+			qty := min(have[l.ItemID]+l.Quantity, l.Stock+heldInto[l.ItemID].Quantity)
+			if qty <= 0 {
+				continue
+			}
+			if err := putCartLine(ctx, tx, intoID, l.ItemID, qty); err != nil {
+				return err
+			}
+			have[l.ItemID] = qty
+		}
+
+		// 2) the holds, so signing in doesn't give up the stock held
+		for _, h := range fromHolds {
+			in := heldInto[h.ItemID]
+			qty := min(h.Quantity+in.Quantity, have[h.ItemID])
+			expires := h.ExpiresAt
+			if in.ExpiresAt.After(expires) {
+				expires = in.ExpiresAt
+			}
+			if _, err := tx.ExecContext(ctx,
+				"DELETE FROM stock_holds WHERE holder = ? AND item_id = ?", CartHolder(intoID), h.ItemID,
+			); err != nil {
+				return err
+			}
+			if qty <= 0 {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO stock_holds (holder, item_id, quantity, expires_at, renewals) VALUES (?, ?, ?, ?, ?)",
+				CartHolder(intoID), h.ItemID, qty, expires, max(h.renewals, in.renewals),
+			); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM stock_holds WHERE holder = ?", CartHolder(fromID),
+		); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM carts WHERE id = ?", fromID)
+		return err
+	})
+}
+
+// ErrEmptyCart is returned when checking out a cart with nothing in it.
+var ErrEmptyCart = errors.New("cart is empty")
+
+// CheckoutCart turns a cart into an order of its lines, paid with pay, in
+// one transaction: the cart is emptied and the order placed exactly as
+// PlaceOrder does, or neither happens; o.Items and o.Holder are the
+// cart's, so its holds turn into the order's deduction. It fails with
+// ErrEmptyCart or ErrInsufficientStock, or with ErrConflict if the cart no
+// longer adds up to pay.Amount.
+func CheckoutCart(ctx context.Context, db *DB, cartID int64, o NewOrder, pay Payment) (_ int64, err error) {
+	ctx, end := db.startOp(ctx, "CheckoutCart")
+	defer end(&err)
+
+	var orderID int64
+	err = db.inTx(ctx, orderTxOptions, func(tx *dbTx) error {
+		// 1) lock the cart so a second checkout of it waits for this one
+		var id int64
+		if err := tx.QueryRowContext(ctx,
+			"SELECT id FROM carts WHERE id = ?"+db.dialect.forUpdate, cartID,
+		).Scan(&id); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrEmptyCart
+			}
+			return err
+		}
+		lines, err := cartLines(ctx, tx, cartID)
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return ErrEmptyCart
+		}
+		o.Holder = CartHolder(cartID)
+		o.Items = make(map[int]int, len(lines))
+		for _, l := range lines {
+			o.Items[l.ItemID] = l.Quantity
+		}
+
+		// 2) place the order, then empty the cart
+		orderID, err = placeOrder(ctx, db, tx, o, pay)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE cart_id = ?", cartID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return orderID, nil
+}
@@ -0,0 +1,103 @@
+// internal/db/conn.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"nexus.local/internal/logging"
+)
+
+// DB is the connection pool plus the settings every query runs with.
+type DB struct {
+	*sql.DB
+
+	// QueryTimeout bounds each data‑access call (a whole transaction counts
+	// as one call). Zero means only the caller's context applies.
+	QueryTimeout time.Duration
+
+	dialect *dialect
+
+	// afterOrderInsert, when a test sets it, runs in placeOrder right after
+	// the order header is inserted, e.g. to cancel the transaction there.
+	afterOrderInsert func(ctx context.Context)
+}
+
+// Options describes how to reach the database and size the pool.
+type Options struct {
+	Driver string // DriverMySQL (the default), DriverSQLite or DriverPostgres
+
+	// User, Pass, Host and Port are ignored by SQLite, for which Name is
+	// the path of the database file.
+	User, Pass, Host, Port, Name string
+	SSLMode                      string // Postgres only: disable, prefer, require, verify-full, …
+
+	MaxOpenConns    int           // 0 means unlimited
+	MaxIdleConns    int           // idle connections kept for reuse
+	ConnMaxLifetime time.Duration // recycle connections after this long; 0 keeps them
+	ConnMaxIdleTime time.Duration // close connections idle this long; 0 keeps them
+	QueryTimeout    time.Duration // see DB.QueryTimeout
+}
+
+// Connect opens & verifies a database connection. If the server isn't
+// reachable yet (as on every `docker compose up`), it keeps retrying with
+// exponential backoff until ctx is done.
+func Connect(ctx context.Context, opts Options) (*DB, error) {
+	d, err := dialectFor(opts.Driver)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(d.driver, d.dsn(opts))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+
+	if err := waitForDB(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{DB: db, QueryTimeout: opts.QueryTimeout, dialect: d}, nil
+}
+
+// waitForDB pings db until it answers or ctx is done.
+func waitForDB(ctx context.Context, db *sql.DB) error {
+	const maxDelay = 5 * time.Second
+	delay := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		logging.FromContext(ctx).Warn("database not reachable yet",
+			slog.Int("attempt", attempt), slog.Duration("retry_in", delay), slog.Any("error", err))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for database after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// ExecContext, QueryContext and QueryRowContext shadow the *sql.DB methods
+// so that every query, written with ? placeholders, is rebound for the
+// connected engine.
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.dialect.rebind(query), args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.dialect.rebind(query), args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.dialect.rebind(query), args...)
+}
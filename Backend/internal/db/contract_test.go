@@ -0,0 +1,138 @@
+// internal/db/contract_test.go
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"nexus.local/internal/promo"
+	"nexus.local/internal/tax"
+)
+
+// The tests in this file pin down what each dialect must agree on: how
+// a new row's ID comes back, how upserts behave and which errors become
+// ErrConflict. Run them on every supported engine (see testdb_test.go)
+// after touching dialect.go or a migration.
+
+// TestContractInsertID covers insertID: RETURNING id on Postgres,
+// LastInsertId elsewhere.
+func TestContractInsertID(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+
+	a, err := AddVendor(ctx, d, "Farm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := AddVendor(ctx, d, "Dairy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID <= 0 || b.ID <= a.ID {
+		t.Errorf("vendor IDs %d then %d", a.ID, b.ID)
+	}
+
+	id := addTestItem(t, d, "eggs", 4, 10, b.ID)
+	it, err := GetItem(ctx, d, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.ID != id || it.Name != "eggs" || it.VendorID != b.ID {
+		t.Errorf("item %d read back as %+v", id, it)
+	}
+}
+
+// TestContractUpsert covers dialect.upsert: a second insert with the same
+// key updates the row in place.
+func TestContractUpsert(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"Ann", "Ann Lee"} {
+		if err := UpsertUser(ctx, d, User{ID: "u1", DisplayName: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var name string
+	if err := d.QueryRowContext(ctx, "SELECT display_name FROM users WHERE id = ?", "u1").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, d, "users", "1 = 1"); n != 1 || name != "Ann Lee" {
+		t.Errorf("%d users, display name %q; want 1 and Ann Lee", n, name)
+	}
+
+	// a composite key, and the stored row's ID
+	first, err := PutTaxRate(ctx, d, tax.Rate{Jurisdiction: "97", Category: "food", BasisPoints: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := PutTaxRate(ctx, d, tax.Rate{Jurisdiction: "97", Category: "food", BasisPoints: 825})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("rate ID %d after the update, was %d", second.ID, first.ID)
+	}
+	rates, err := ListTaxRates(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 1 || rates[0].BasisPoints != 825 {
+		t.Errorf("rates %+v, want one at 825", rates)
+	}
+
+	// set replaces a cart line's quantity, add adds to it
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0)
+	cartID, err := UserCart(ctx, d, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []struct {
+		quantity int
+		add      bool
+		want     int
+	}{{3, false, 3}, {2, false, 2}, {4, true, 6}} {
+		if err := SetCartItem(ctx, d, cartID, eggs, step.quantity, step.add); err != nil {
+			t.Fatal(err)
+		}
+		lines, err := GetCart(ctx, d, cartID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != 1 || lines[0].Quantity != step.want {
+			t.Errorf("after %+v: cart %+v, want %d eggs", step, lines, step.want)
+		}
+	}
+}
+
+// TestContractConflict covers dialect.constraint: unique and foreign‑key
+// violations come back as ErrConflict.
+func TestContractConflict(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+
+	if _, err := AddVendor(ctx, d, "Farm"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddVendor(ctx, d, "Farm"); !errors.Is(err, ErrConflict) {
+		t.Errorf("duplicate vendor: %v, want ErrConflict", err)
+	}
+
+	p := promo.Promotion{Code: "SPRING", Name: "Spring", Kind: promo.Percent, Value: 1000, Active: true}
+	if _, err := AddPromotion(ctx, d, p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddPromotion(ctx, d, p); !errors.Is(err, ErrConflict) {
+		t.Errorf("duplicate promo code: %v, want ErrConflict", err)
+	}
+
+	// order_items still references it
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0)
+	if _, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: 1}}, Payment{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteItem(ctx, d, eggs); !errors.Is(err, ErrConflict) {
+		t.Errorf("delete ordered item: %v, want ErrConflict", err)
+	}
+}
@@ -2,11 +2,31 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"nexus.local/internal/logging"
+	"nexus.local/internal/tax"
+)
+
+// Errors returned by the data‑access functions. Callers should test for
+// them with errors.Is, since they are usually wrapped with more detail.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrInsufficientStock = errors.New("insufficient stock")
+
+	// ErrConflict wraps a unique or foreign‑key violation from any engine,
+	// e.g. deleting an item that orders still refer to.
+	ErrConflict = errors.New("conflicts with existing data")
 )
 
 type Item struct {
@@ -15,41 +35,104 @@ type Item struct {
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
 	Stock       int     `json:"stock"`
-	ImageURL    string  `json:"image_url,omitempty"`
+	Available   int     `json:"available"` // Stock less active holds, see holds.go
+	VendorID    int64   `json:"vendor_id,omitempty"`
+	TaxCategory string  `json:"tax_category"`        // see internal/tax
+	ImageURL    string  `json:"image_url,omitempty"` // same as Images.Full
+
+	// Images links each generated size of the primary image.
+	Images *ImageVariants `json:"images,omitempty"`
+
+	// Gallery is every image of the item in display order, primary
+	// included.
+	Gallery []ItemImage `json:"gallery"`
+
+	// ImageKey is the primary image's blob‑store key (of its full‑size
+	// variant). The server turns keys into URLs for each response, so
+	// only keys are stored.
+	ImageKey string `json:"-"`
+}
+
+// ImageVariants are the URLs of an image's generated sizes.
+type ImageVariants struct {
+	Thumb  string `json:"thumb"`  // at most 200px on the long side
+	Medium string `json:"medium"` // at most 600px
+	Full   string `json:"full"`   // at most 1600px
 }
 
 type Order struct {
 	ID        int64     `json:"id"`
 	UserID    string    `json:"user_id"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// Payment: see payments.go for the statuses. Amount and Refunded are
+	// in minor units (cents) of Currency.
+	PaymentStatus string `json:"payment_status"`
+	PaymentID     string `json:"-"`
+	Amount        int64  `json:"amount"`
+	Refunded      int64  `json:"refunded"`
+	Net           int64  `json:"net"` // Amount less Refunded
+	Currency      string `json:"currency,omitempty"`
+
+	// Amount is Subtotal less Discount plus Tax and FulfillmentFee, taxed
+	// by PostalCode; see tax.go, promotions.go and fulfillment.go.
+	PostalCode string `json:"postal_code,omitempty"`
+	Subtotal   int64  `json:"subtotal"`
+	Discount   int64  `json:"discount"`
+	Tax        int64  `json:"tax"`
+	PromoCode  string `json:"promo_code,omitempty"`
+
+	// The pickup or delivery slot, if the order was booked into one.
+	SlotID            int64  `json:"slot_id,omitempty"`
+	FulfillmentMethod string `json:"fulfillment_method,omitempty"`
+	FulfillmentFee    int64  `json:"fulfillment_fee"`
+	DeliveryAddress   string `json:"delivery_address,omitempty"`
+}
+
+// orderColumns are the columns scanOrder reads, in order.
+const orderColumns = "id, user_id, created_at, payment_status, payment_id, amount, refunded, currency, " +
+	"postal_code, subtotal, discount, tax, promo_code, slot_id, fulfillment_method, fulfillment_fee, delivery_address"
+
+func scanOrder(row interface{ Scan(...any) error }, o *Order) error {
+	var (
+		paymentID, promoCode sql.NullString
+		slotID               sql.NullInt64
+	)
+	err := row.Scan(&o.ID, &o.UserID, &o.CreatedAt, &o.PaymentStatus, &paymentID, &o.Amount, &o.Refunded, &o.Currency,
+		&o.PostalCode, &o.Subtotal, &o.Discount, &o.Tax, &promoCode,
+		&slotID, &o.FulfillmentMethod, &o.FulfillmentFee, &o.DeliveryAddress)
+	o.PaymentID = paymentID.String
+	o.PromoCode = promoCode.String
+	o.SlotID = slotID.Int64
+	o.Net = o.Amount - o.Refunded
+	return err
 }
 
 type OrderItem struct {
 	OrderID  int64 `json:"order_id"`
 	ItemID   int   `json:"item_id"`
 	Quantity int   `json:"quantity"`
-}
 
-// Connect opens & verifies a MySQL database connection.
-func Connect(user, pass, host, port, name string) (*sql.DB, error) {
-	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?parseTime=true",
-		user, pass, host, port, name,
-	)
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
-	}
-	if err := db.Ping(); err != nil {
-		return nil, err
-	}
-	return db, nil
+	UnitPrice        int64 `json:"unit_price"`        // cents, as sold
+	RefundedQuantity int   `json:"refunded_quantity"` // see refunds.go
+
+	// The line's vendor and tax as placed; see tax.go. TaxJurisdiction is
+	// empty for an untaxed line.
+	VendorID        int64  `json:"vendor_id,omitempty"`
+	TaxCategory     string `json:"tax_category"`
+	TaxJurisdiction string `json:"tax_jurisdiction,omitempty"`
+	TaxRate         int64  `json:"tax_rate"` // basis points
+	Tax             int64  `json:"tax"`
+	Discount        int64  `json:"discount"` // see promotions.go
 }
 
-// GetAllItems returns every item in the items table, including image_url.
-func GetAllItems(db *sql.DB) ([]Item, error) {
-	rows, err := db.Query(
-		"SELECT id, name, description, price, stock, image_url FROM items",
+// GetAllItems returns every item in the items table with its gallery.
+func GetAllItems(ctx context.Context, db *DB) (_ []Item, err error) {
+	ctx, end := db.startOp(ctx, "GetAllItems")
+	defer end(&err)
+	rows, err := db.QueryContext(ctx,
+		"SELECT id, name, description, price, stock, stock - "+heldByOthers+", vendor_id, tax_category FROM items",
+		"", time.Now().UTC(),
 	)
 	if err != nil {
 		return nil, err
@@ -59,68 +142,87 @@ func GetAllItems(db *sql.DB) ([]Item, error) {
 	var items []Item
 	for rows.Next() {
 		var it Item
-		var img sql.NullString
+		var vendorID sql.NullInt64
 		if err := rows.Scan(
 			&it.ID,
 			&it.Name,
 			&it.Description,
 			&it.Price,
 			&it.Stock,
-			&img,
+			&it.Available,
+			&vendorID,
+			&it.TaxCategory,
 		); err != nil {
 			return nil, err
 		}
-		if img.Valid {
-			it.ImageURL = img.String
-		}
+		it.VendorID = vendorID.Int64
+		it.Available = max(it.Available, 0)
 		items = append(items, it)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := loadGalleries(ctx, db, items, ""); err != nil {
+		return nil, err
+	}
 	return items, nil
 }
 
-// GetItem fetches a single item by its ID, including image_url.
-func GetItem(db *sql.DB, itemID int) (*Item, error) {
+// GetItem fetches a single item by its ID, with its gallery.
+func GetItem(ctx context.Context, db *DB, itemID int) (_ *Item, err error) {
+	ctx, end := db.startOp(ctx, "GetItem")
+	defer end(&err)
 	var it Item
-	var img sql.NullString
-	err := db.QueryRow(
-		"SELECT id, name, description, price, stock, image_url FROM items WHERE id = ?",
-		itemID,
+	var vendorID sql.NullInt64
+	err = db.QueryRowContext(ctx,
+		"SELECT id, name, description, price, stock, stock - "+heldByOthers+", vendor_id, tax_category FROM items WHERE id = ?",
+		"", time.Now().UTC(), itemID,
 	).Scan(
 		&it.ID,
 		&it.Name,
 		&it.Description,
 		&it.Price,
 		&it.Stock,
-		&img,
+		&it.Available,
+		&vendorID,
+		&it.TaxCategory,
 	)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("item %d not found", itemID)
+		return nil, fmt.Errorf("item %d: %w", itemID, ErrNotFound)
 	}
 	if err != nil {
 		return nil, err
 	}
-	if img.Valid {
-		it.ImageURL = img.String
+	it.VendorID = vendorID.Int64
+	it.Available = max(it.Available, 0)
+	items := []Item{it}
+	if err := loadGalleries(ctx, db, items, "WHERE item_id = ?", itemID); err != nil {
+		return nil, err
 	}
-	return &it, nil
+	return &items[0], nil
 }
 
-// AddItem inserts a new product into the items table.
+// AddItem inserts a new product into the items table. An empty
+// TaxCategory is tax.DefaultCategory, and a zero VendorID no vendor.
 // It returns the newly created item's ID.
-func AddItem(db *sql.DB, name, description string, price float64, stock int) (int64, error) {
-	res, err := db.Exec(
-		"INSERT INTO items (name, description, price, stock) VALUES (?, ?, ?, ?)",
-		name, description, price, stock,
-	)
-	if err != nil {
-		return 0, err
+func AddItem(ctx context.Context, db *DB, item Item) (_ int64, err error) {
+	ctx, end := db.startOp(ctx, "AddItem")
+	defer end(&err)
+	if item.TaxCategory == "" {
+		item.TaxCategory = tax.DefaultCategory
 	}
-	return res.LastInsertId()
+	return db.insertID(ctx, db,
+		"INSERT INTO items (name, description, price, stock, vendor_id, tax_category) VALUES (?, ?, ?, ?, ?, ?)",
+		item.Name, item.Description, item.Price, item.Stock, nullInt64(item.VendorID), item.TaxCategory,
+	)
 }
 
 // UpdateItemStock sets the stock for a given item.
-func UpdateItemStock(db *sql.DB, itemID, newStock int) error {
-	res, err := db.Exec(
+func UpdateItemStock(ctx context.Context, db *DB, itemID, newStock int) (err error) {
+	ctx, end := db.startOp(ctx, "UpdateItemStock")
+	defer end(&err)
+	res, err := db.ExecContext(ctx,
 		"UPDATE items SET stock = ? WHERE id = ?",
 		newStock, itemID,
 	)
@@ -128,88 +230,206 @@ func UpdateItemStock(db *sql.DB, itemID, newStock int) error {
 		return err
 	}
 	if rows, _ := res.RowsAffected(); rows == 0 {
-		return fmt.Errorf("no item with id %d", itemID)
+		return fmt.Errorf("item %d: %w", itemID, ErrNotFound)
 	}
 	return nil
 }
 
 // UpdateItem updates all modifiable fields of an item.
-func UpdateItem(db *sql.DB, item Item) error {
-	res, err := db.Exec(
-		"UPDATE items SET name = ?, description = ?, price = ?, stock = ? WHERE id = ?",
-		item.Name, item.Description, item.Price, item.Stock, item.ID,
+func UpdateItem(ctx context.Context, db *DB, item Item) (err error) {
+	ctx, end := db.startOp(ctx, "UpdateItem")
+	defer end(&err)
+	if item.TaxCategory == "" {
+		item.TaxCategory = tax.DefaultCategory
+	}
+	res, err := db.ExecContext(ctx,
+		"UPDATE items SET name = ?, description = ?, price = ?, stock = ?, vendor_id = ?, tax_category = ? WHERE id = ?",
+		item.Name, item.Description, item.Price, item.Stock, nullInt64(item.VendorID), item.TaxCategory, item.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("item %d: %w", item.ID, ErrNotFound)
+	}
+	return nil
+}
+
+// SetItemTax sets an item's vendor (0 for none) and tax category.
+func SetItemTax(ctx context.Context, db *DB, itemID int, vendorID int64, category string) (err error) {
+	ctx, end := db.startOp(ctx, "SetItemTax")
+	defer end(&err)
+	res, err := db.ExecContext(ctx,
+		"UPDATE items SET vendor_id = ?, tax_category = ? WHERE id = ?",
+		nullInt64(vendorID), category, itemID,
 	)
 	if err != nil {
 		return err
 	}
 	if rows, _ := res.RowsAffected(); rows == 0 {
-		return fmt.Errorf("no item with id %d", item.ID)
+		return fmt.Errorf("item %d: %w", itemID, ErrNotFound)
 	}
 	return nil
 }
 
+// nullInt64 stores 0 as NULL, for optional references.
+func nullInt64(n int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: n, Valid: n != 0}
+}
+
 // DeleteItem removes an item from the database.
-func DeleteItem(db *sql.DB, itemID int) error {
-	res, err := db.Exec("DELETE FROM items WHERE id = ?", itemID)
+func DeleteItem(ctx context.Context, db *DB, itemID int) (err error) {
+	ctx, end := db.startOp(ctx, "DeleteItem")
+	defer end(&err)
+	res, err := db.ExecContext(ctx, "DELETE FROM items WHERE id = ?", itemID)
 	if err != nil {
 		return err
 	}
 	if rows, _ := res.RowsAffected(); rows == 0 {
-		return fmt.Errorf("no item with id %d", itemID)
+		return fmt.Errorf("item %d: %w", itemID, ErrNotFound)
 	}
 	return nil
 }
 
-// PlaceOrder creates an order + order_items, and deducts stock.
-func PlaceOrder(db *sql.DB, userID string, orderItems map[int]int) (int64, error) {
-	tx, err := db.Begin()
+// orderTxOptions is used for the order transaction. READ COMMITTED is
+// enough because stock is checked under the item's row lock, and it
+// avoids the gap locks REPEATABLE READ would take.
+var orderTxOptions = &sql.TxOptions{Isolation: sql.LevelReadCommitted}
+
+// NewOrder is an order to place: quantities by item ID, for delivery to
+// PostalCode, which decides its tax, with an optional PromoCode and an
+// optional pickup or delivery slot (SlotID 0 for none). Holder names the
+// stock holds the order may use (see holds.go); they're released once
+// it's placed.
+type NewOrder struct {
+	UserID          string
+	Items           map[int]int
+	PostalCode      string
+	PromoCode       string
+	SlotID          int64
+	DeliveryAddress string
+	Holder          string
+}
+
+// PlaceOrder creates an order + order_items, split into one sub-order per
+// vendor, and deducts stock. pay is the order's payment, already
+// authorized, so stock is only ever committed for paid orders. It fails
+// with ErrInsufficientStock if any item would go below zero or below what
+// others hold, in which case
+// the caller should void the payment, with ErrPromotionUnavailable if its
+// promo code has been used up meanwhile, with ErrSlotUnavailable if its
+// slot has filled up, and with ErrConflict if the order no longer adds up
+// to pay.Amount.
+// The transaction is retried if the database aborts it as a deadlock victim.
+func PlaceOrder(ctx context.Context, db *DB, o NewOrder, pay Payment) (_ int64, err error) {
+	ctx, end := db.startOp(ctx, "PlaceOrder")
+	defer end(&err)
+
+	var orderID int64
+	err = db.inTx(ctx, orderTxOptions, func(tx *dbTx) error {
+		var err error
+		orderID, err = placeOrder(ctx, db, tx, o, pay)
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
+	logging.FromContext(ctx).Debug("order committed",
+		slog.Int64("order_id", orderID), slog.Int("lines", len(o.Items)))
+	return orderID, nil
+}
 
-	// 1) create the order header
-	res, err := tx.Exec(
-		"INSERT INTO orders (user_id, created_at) VALUES (?, ?)",
-		userID, time.Now(),
-	)
+// placeOrder is the body of the order transaction, shared by PlaceOrder
+// and CheckoutCart.
+func placeOrder(ctx context.Context, db *DB, tx *dbTx, o NewOrder, pay Payment) (int64, error) {
+	// 1) price, discount, tax and book the order as it stands now
+	q, err := quoteOrder(ctx, tx, o)
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
-	orderID, err := res.LastInsertId()
+	if pay.ID != "" && q.Total != pay.Amount {
+		// a price, promotion or tax rate changed since the payment was
+		// authorized
+		return 0, fmt.Errorf("order total %d, authorized %d: %w", q.Total, pay.Amount, ErrConflict)
+	}
+
+	// 2) create the order header
+	var method, address string
+	if f := q.Fulfillment; f != nil {
+		method, address = f.Method, f.DeliveryAddress
+	}
+	orderID, err := db.insertID(ctx, tx, `
+        INSERT INTO orders (user_id, created_at, payment_status, payment_id, amount, currency,
+                            postal_code, subtotal, discount, tax, promo_code,
+                            slot_id, fulfillment_method, fulfillment_fee, delivery_address)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		o.UserID, time.Now().UTC(), pay.status(), pay.nullID(), pay.Amount, pay.Currency,
+		q.PostalCode, q.Subtotal, q.Discount, q.Tax, q.promoCode(),
+		nullInt64(o.SlotID), method, q.FulfillmentFee, address,
+	)
 	if err != nil {
-		tx.Rollback()
 		return 0, err
 	}
+	if db.afterOrderInsert != nil {
+		db.afterOrderInsert(ctx)
+	}
 
-	// 2) insert line‐items & decrement stock
-	for itemID, qty := range orderItems {
-		if _, err := tx.Exec(
-			"INSERT INTO order_items (order_id, item_id, quantity) VALUES (?, ?, ?)",
-			orderID, itemID, qty,
+	// 3) insert line‐items as priced & decrement stock, turning the
+	// order's holds into the deduction
+	now := time.Now().UTC()
+	for _, l := range q.Lines {
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO order_items (order_id, item_id, quantity, unit_price,
+                                     vendor_id, tax_category, tax_jurisdiction, tax_rate, tax, discount)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			orderID, l.ItemID, l.Quantity, l.UnitPrice,
+			nullInt64(l.VendorID), l.TaxCategory, l.jurisdiction(), l.TaxRate, l.Tax, l.Discount,
 		); err != nil {
-			tx.Rollback()
 			return 0, err
 		}
-		if _, err := tx.Exec(
-			"UPDATE items SET stock = stock - ? WHERE id = ?",
-			qty, itemID,
+		avail, err := lockAvailable(ctx, db, tx, l.ItemID, o.Holder, now)
+		if err != nil {
+			return 0, err
+		}
+		if l.Quantity > avail {
+			return 0, fmt.Errorf("item %d: %w", l.ItemID, ErrInsufficientStock)
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE items SET stock = stock - ? WHERE id = ?", l.Quantity, l.ItemID,
 		); err != nil {
-			tx.Rollback()
 			return 0, err
 		}
 	}
+	if o.Holder != "" {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM stock_holds WHERE holder = ?", o.Holder); err != nil {
+			return 0, err
+		}
+	}
+
+	// 4) split it into one sub-order per vendor
+	if err := splitOrder(ctx, db, tx, orderID, q); err != nil {
+		return 0, err
+	}
 
-	// 3) commit transaction
-	if err := tx.Commit(); err != nil {
+	// 5) count the promotions against their limits
+	if err := redeemPromotions(ctx, tx, orderID, o.UserID, q.Promotions); err != nil {
 		return 0, err
 	}
+
+	// 6) take a place in the slot
+	if o.SlotID != 0 {
+		if err := bookSlot(ctx, tx, o.SlotID); err != nil {
+			return 0, err
+		}
+	}
 	return orderID, nil
 }
 
 // GetAllOrders returns every order header.
-func GetAllOrders(db *sql.DB) ([]Order, error) {
-	rows, err := db.Query("SELECT id, user_id, created_at FROM orders")
+func GetAllOrders(ctx context.Context, db *DB) (_ []Order, err error) {
+	ctx, end := db.startOp(ctx, "GetAllOrders")
+	defer end(&err)
+	rows, err := db.QueryContext(ctx, "SELECT "+orderColumns+" FROM orders")
 	if err != nil {
 		return nil, err
 	}
@@ -218,7 +438,7 @@ func GetAllOrders(db *sql.DB) ([]Order, error) {
 	var orders []Order
 	for rows.Next() {
 		var o Order
-		if err := rows.Scan(&o.ID, &o.UserID, &o.CreatedAt); err != nil {
+		if err := scanOrder(rows, &o); err != nil {
 			return nil, err
 		}
 		orders = append(orders, o)
@@ -227,76 +447,118 @@ func GetAllOrders(db *sql.DB) ([]Order, error) {
 }
 
 // GetOrderByID fetches one order and its line‐items.
-func GetOrderByID(db *sql.DB, orderID int64) (*Order, []OrderItem, error) {
+func GetOrderByID(ctx context.Context, db *DB, orderID int64) (_ *Order, _ []OrderItem, err error) {
+	ctx, end := db.startOp(ctx, "GetOrderByID")
+	defer end(&err)
 	var o Order
-	err := db.QueryRow(
-		"SELECT id, user_id, created_at FROM orders WHERE id = ?",
+	err = scanOrder(db.QueryRowContext(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE id = ?",
 		orderID,
-	).Scan(&o.ID, &o.UserID, &o.CreatedAt)
+	), &o)
 	if err == sql.ErrNoRows {
-		return nil, nil, fmt.Errorf("order %d not found", orderID)
+		return nil, nil, fmt.Errorf("order %d: %w", orderID, ErrNotFound)
 	}
 	if err != nil {
 		return nil, nil, err
 	}
 
-	rows, err := db.Query(
-		"SELECT order_id, item_id, quantity FROM order_items WHERE order_id = ?",
+	lines, err := orderLines(ctx, db, orderID)
+	if err != nil {
+		return &o, nil, err
+	}
+	return &o, lines, nil
+}
+
+// orderLines returns the line‐items of an order.
+func orderLines(ctx context.Context, q querier, orderID int64) ([]OrderItem, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT order_id, item_id, quantity, unit_price, refunded_quantity,
+               vendor_id, tax_category, tax_jurisdiction, tax_rate, tax, discount
+        FROM order_items WHERE order_id = ? ORDER BY item_id`,
 		orderID,
 	)
 	if err != nil {
-		return &o, nil, err
+		return nil, err
 	}
 	defer rows.Close()
 
 	var lines []OrderItem
 	for rows.Next() {
-		var li OrderItem
-		if err := rows.Scan(&li.OrderID, &li.ItemID, &li.Quantity); err != nil {
-			return &o, nil, err
+		var (
+			li           OrderItem
+			vendorID     sql.NullInt64
+			jurisdiction sql.NullString
+		)
+		if err := rows.Scan(&li.OrderID, &li.ItemID, &li.Quantity, &li.UnitPrice, &li.RefundedQuantity,
+			&vendorID, &li.TaxCategory, &jurisdiction, &li.TaxRate, &li.Tax, &li.Discount); err != nil {
+			return nil, err
 		}
+		li.VendorID = vendorID.Int64
+		li.TaxJurisdiction = jurisdiction.String
 		lines = append(lines, li)
 	}
-	return &o, lines, nil
-}
-
-// DeleteOrder deletes an order (and cascades to order_items).
-func DeleteOrder(db *sql.DB, orderID int64) error {
-	res, err := db.Exec("DELETE FROM orders WHERE id = ?", orderID)
-	if err != nil {
-		return err
-	}
-	if rows, _ := res.RowsAffected(); rows == 0 {
-		return fmt.Errorf("no order with id %d", orderID)
-	}
-	return nil
+	return lines, rows.Err()
 }
 
-// AddItemWithImageURL inserts a new item and allows setting image_url.
-func AddItemWithImageURL(db *sql.DB, name, desc string, price float64, stock int, imageURL string) (int64, error) {
-	res, err := db.Exec(
-		"INSERT INTO items (name, description, price, stock, image_url) VALUES (?, ?, ?, ?, ?)",
-		name, desc, price, stock, imageURL,
-	)
-	if err != nil {
-		return 0, err
-	}
-	return res.LastInsertId()
-}
+// DeleteOrder deletes an order (and cascades to order_items and
+// sub_orders). The uses of its promotions are given back. It fails with
+// ErrConflict once a vendor has accepted any of its sub-orders.
+func DeleteOrder(ctx context.Context, db *DB, orderID int64) (err error) {
+	ctx, end := db.startOp(ctx, "DeleteOrder")
+	defer end(&err)
+	return db.inTx(ctx, nil, func(tx *dbTx) error {
+		// lock the sub-orders, so none moves on while the order goes
+		rows, err := tx.QueryContext(ctx,
+			"SELECT status FROM sub_orders WHERE order_id = ?"+db.dialect.forUpdate, orderID,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var status string
+			if err := rows.Scan(&status); err != nil {
+				return err
+			}
+			if status != SubOrderPending && status != SubOrderCancelled {
+				return fmt.Errorf("order %d has a sub-order %s: %w", orderID, status, ErrConflict)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
 
-// UpdateItemImageURL updates only the image_url column for an item.
-func UpdateItemImageURL(db *sql.DB, itemID int, imageURL string) error {
-	_, err := db.Exec(
-		"UPDATE items SET image_url = ? WHERE id = ?",
-		imageURL, itemID,
-	)
-	return err
+		if _, err := tx.ExecContext(ctx, `
+            UPDATE promotions SET uses = uses - 1
+            WHERE id IN (SELECT promotion_id FROM promotion_redemptions WHERE order_id = ?)`,
+			orderID,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE fulfillment_slots SET booked = booked - 1 WHERE id = (SELECT slot_id FROM orders WHERE id = ?)",
+			orderID,
+		); err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, "DELETE FROM orders WHERE id = ?", orderID)
+		if err != nil {
+			return err
+		}
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return fmt.Errorf("order %d: %w", orderID, ErrNotFound)
+		}
+		return nil
+	})
 }
 
 // GetOrdersByUser returns every order belonging to userID.
-func GetOrdersByUser(db *sql.DB, userID string) ([]Order, error) {
-	rows, err := db.Query(
-		"SELECT id, user_id, created_at FROM orders WHERE user_id = ?",
+func GetOrdersByUser(ctx context.Context, db *DB, userID string) (_ []Order, err error) {
+	ctx, end := db.startOp(ctx, "GetOrdersByUser")
+	defer end(&err)
+	rows, err := db.QueryContext(ctx,
+		"SELECT "+orderColumns+" FROM orders WHERE user_id = ?",
 		userID,
 	)
 	if err != nil {
@@ -307,10 +569,69 @@ func GetOrdersByUser(db *sql.DB, userID string) ([]Order, error) {
 	var orders []Order
 	for rows.Next() {
 		var o Order
-		if err := rows.Scan(&o.ID, &o.UserID, &o.CreatedAt); err != nil {
+		if err := scanOrder(rows, &o); err != nil {
 			return nil, err
 		}
 		orders = append(orders, o)
 	}
 	return orders, nil
 }
+
+var tracer = otel.Tracer("nexus.local/internal/db")
+
+// startOp begins a data‑access call: it opens a span (see startSpan) and
+// applies db.QueryTimeout. The returned func must be deferred with a
+// pointer to the caller's named error result; it also turns constraint
+// violations into ErrConflict, whatever the engine.
+func (db *DB) startOp(ctx context.Context, op string) (context.Context, func(*error)) {
+	cancel := context.CancelFunc(func() {})
+	if db.QueryTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, db.QueryTimeout)
+	}
+	ctx, end := db.startSpan(ctx, op)
+	return ctx, func(errp *error) {
+		if *errp != nil && db.dialect.constraint(*errp) {
+			*errp = fmt.Errorf("%w: %w", ErrConflict, *errp)
+		}
+		end(errp)
+		cancel()
+	}
+}
+
+// startSpan opens a span for the data‑access function op. Pass a pointer
+// to the function's named error result to end so failures are recorded;
+// ErrNotFound is an answer, not a failure, and is left unmarked.
+func (db *DB) startSpan(ctx context.Context, op string) (context.Context, func(*error)) {
+	ctx, span := tracer.Start(ctx, "db."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(db.dialect.system, semconv.DBOperationName(op)),
+	)
+	return ctx, func(errp *error) {
+		if err := *errp; err != nil && !errors.Is(err, ErrNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// execer is what insertID needs; both *DB and *dbTx provide it.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertID runs an INSERT into a table with an auto‑increment id column
+// and returns the id of the new row.
+func (db *DB) insertID(ctx context.Context, ex execer, query string, args ...any) (int64, error) {
+	if db.dialect.returning {
+		var id int64
+		err := ex.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	res, err := ex.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
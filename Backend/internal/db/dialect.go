@@ -0,0 +1,226 @@
+// internal/db/dialect.go
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dialect is everything that differs between the database engines we run
+// on. The data‑access functions stick to SQL all of them understand and
+// ask the dialect for the rest.
+type dialect struct {
+	name   string             // Options.Driver value, also the migrations/ subdirectory
+	driver string             // database/sql driver name
+	system attribute.KeyValue // db.system span attribute
+
+	// dsn builds the connection string from opts.
+	dsn func(opts Options) string
+
+	// numbered is set when placeholders are written $1, $2, … instead of
+	// ?. Queries in this package always use ?; rebind converts them.
+	numbered bool
+
+	// returning is set when an INSERT reports its new id through
+	// "RETURNING id" rather than sql.Result.LastInsertId.
+	returning bool
+
+	// timestamp is the column type for a point in time.
+	timestamp string
+
+	// forUpdate is appended to a SELECT to lock the rows it reads until
+	// the transaction ends. SQLite has no row locks; its transactions
+	// already hold the database write lock (see _txlock below).
+	forUpdate string
+
+	// upsert returns the clause appended to an INSERT so that a row
+	// colliding on the key column updates cols instead.
+	upsert func(key string, cols []string) string
+
+	// retryable reports whether err means the transaction should be rolled
+	// back and can safely be run again.
+	retryable func(err error) bool
+
+	// constraint reports whether err is a unique or foreign‑key violation,
+	// which callers see as ErrConflict.
+	constraint func(err error) bool
+}
+
+// Drivers supported by Connect.
+const (
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+var dialects = map[string]*dialect{
+	DriverMySQL: {
+		name:   DriverMySQL,
+		driver: "mysql",
+		system: semconv.DBSystemMySQL,
+		dsn: func(o Options) string {
+			return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", o.User, o.Pass, o.Host, o.Port, o.Name)
+		},
+		timestamp: "DATETIME",
+		forUpdate: " FOR UPDATE",
+		upsert: func(_ string, cols []string) string {
+			set := make([]string, len(cols))
+			for i, c := range cols {
+				set[i] = fmt.Sprintf("%s = VALUES(%s)", c, c)
+			}
+			return "ON DUPLICATE KEY UPDATE " + strings.Join(set, ", ")
+		},
+		retryable: func(err error) bool {
+			var myErr *mysql.MySQLError
+			return errors.As(err, &myErr) &&
+				(myErr.Number == errLockDeadlock || myErr.Number == errLockWaitTimeout)
+		},
+		constraint: func(err error) bool {
+			var myErr *mysql.MySQLError
+			if !errors.As(err, &myErr) {
+				return false
+			}
+			switch myErr.Number {
+			case 1062, // ER_DUP_ENTRY
+				1451, // ER_ROW_IS_REFERENCED_2
+				1452: // ER_NO_REFERENCED_ROW_2
+				return true
+			}
+			return false
+		},
+	},
+
+	// SQLite is the CGO‑free modernc.org/sqlite driver, for single‑vendor
+	// installs and development. Name is a file path. Foreign keys are off
+	// by default in SQLite and switched on here; transactions take the
+	// write lock up front (_txlock=immediate) so two writers wait for each
+	// other via busy_timeout instead of failing on a lock upgrade.
+	DriverSQLite: {
+		name:   DriverSQLite,
+		driver: "sqlite",
+		system: semconv.DBSystemSqlite,
+		dsn: func(o Options) string {
+			q := url.Values{}
+			q.Add("_pragma", "foreign_keys(1)")
+			q.Add("_pragma", "busy_timeout(5000)")
+			q.Add("_pragma", "journal_mode(WAL)")
+			q.Set("_txlock", "immediate")
+			q.Set("_time_format", "sqlite")
+			return "file:" + o.Name + "?" + q.Encode()
+		},
+		timestamp: "DATETIME",
+		upsert:    excludedUpsert,
+		retryable: func(err error) bool {
+			var liteErr *sqlite.Error
+			return errors.As(err, &liteErr) && liteErr.Code()&0xff == sqlite3.SQLITE_BUSY
+		},
+		constraint: func(err error) bool {
+			var liteErr *sqlite.Error
+			if !errors.As(err, &liteErr) {
+				return false
+			}
+			switch liteErr.Code() {
+			case sqlite3.SQLITE_CONSTRAINT_UNIQUE,
+				sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY,
+				sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+				return true
+			}
+			return false
+		},
+	},
+
+	// Postgres goes through pgx's database/sql adapter. SSLMode is passed
+	// through as sslmode; managed offerings usually want "require".
+	DriverPostgres: {
+		name:   DriverPostgres,
+		driver: "pgx",
+		system: semconv.DBSystemPostgreSQL,
+		dsn: func(o Options) string {
+			u := url.URL{
+				Scheme: "postgres",
+				User:   url.UserPassword(o.User, o.Pass),
+				Host:   net.JoinHostPort(o.Host, o.Port),
+				Path:   "/" + o.Name,
+			}
+			if o.SSLMode != "" {
+				u.RawQuery = url.Values{"sslmode": {o.SSLMode}}.Encode()
+			}
+			return u.String()
+		},
+		numbered:  true,
+		returning: true,
+		timestamp: "TIMESTAMPTZ",
+		forUpdate: " FOR UPDATE",
+		upsert:    excludedUpsert,
+		retryable: func(err error) bool {
+			var pgErr *pgconn.PgError
+			return errors.As(err, &pgErr) &&
+				(pgErr.Code == "40001" || pgErr.Code == "40P01") // serialization_failure, deadlock_detected
+		},
+		constraint: func(err error) bool {
+			var pgErr *pgconn.PgError
+			return errors.As(err, &pgErr) &&
+				(pgErr.Code == "23505" || pgErr.Code == "23503") // unique_violation, foreign_key_violation
+		},
+	},
+}
+
+// excludedUpsert is the standard ON CONFLICT … DO UPDATE form, which
+// refers to the proposed row as "excluded".
+func excludedUpsert(key string, cols []string) string {
+	set := make([]string, len(cols))
+	for i, c := range cols {
+		set[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+	}
+	return fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", key, strings.Join(set, ", "))
+}
+
+// rebind rewrites the ? placeholders in query for d. A ? inside a quoted
+// string literal is left alone.
+func (d *dialect) rebind(query string) string {
+	if !d.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n, quoted := 0, false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dialectFor looks up the dialect for a configured driver name; "" means
+// MySQL, the original and default backend.
+func dialectFor(driver string) (*dialect, error) {
+	if driver == "" {
+		driver = DriverMySQL
+	}
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	return d, nil
+}
+
+// Driver reports which engine db is connected to.
+func (db *DB) Driver() string { return db.dialect.name }
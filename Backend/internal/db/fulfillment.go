@@ -0,0 +1,427 @@
+// internal/db/fulfillment.go
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"nexus.local/internal/tax"
+)
+
+// Fulfillment methods.
+const (
+	FulfillmentPickup   = "pickup"   // collected at the option's address
+	FulfillmentDelivery = "delivery" // delivered within the option's zone
+)
+
+// ErrSlotUnavailable is returned for a time slot that is full, over, or
+// switched off, or that doesn't serve the order's items or postal code.
+var ErrSlotUnavailable = errors.New("time slot unavailable")
+
+// FulfillmentOption is a pickup location or a delivery zone. VendorID 0 is
+// the store's own; a vendor's option only takes that vendor's items.
+type FulfillmentOption struct {
+	ID           int64     `json:"id"`
+	VendorID     int64     `json:"vendor_id,omitempty"`
+	Method       string    `json:"method"`
+	Name         string    `json:"name"`
+	Address      string    `json:"address,omitempty"`       // pickup only
+	PostalPrefix string    `json:"postal_prefix,omitempty"` // delivery only; "" is everywhere
+	Fee          int64     `json:"fee"`                     // cents
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// serves reports whether the option covers postalCode, already normalized.
+func (fo FulfillmentOption) serves(postalCode string) bool {
+	return fo.Method != FulfillmentDelivery || strings.HasPrefix(postalCode, fo.PostalPrefix)
+}
+
+// Slot is a window in which an option takes up to Capacity orders.
+type Slot struct {
+	ID        int64     `json:"id"`
+	OptionID  int64     `json:"option_id"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Capacity  int       `json:"capacity"`
+	Booked    int       `json:"booked"`
+	Available int       `json:"available"` // Capacity less Booked
+}
+
+const fulfillmentOptionColumns = "id, vendor_id, method, name, address, postal_prefix, fee, active, created_at"
+
+func scanFulfillmentOption(row interface{ Scan(...any) error }, fo *FulfillmentOption) error {
+	var vendorID sql.NullInt64
+	err := row.Scan(&fo.ID, &vendorID, &fo.Method, &fo.Name, &fo.Address, &fo.PostalPrefix, &fo.Fee, &fo.Active, &fo.CreatedAt)
+	fo.VendorID = vendorID.Int64
+	return err
+}
+
+const slotColumns = "id, option_id, starts_at, ends_at, capacity, booked"
+
+func scanSlot(row interface{ Scan(...any) error }, s *Slot) error {
+	err := row.Scan(&s.ID, &s.OptionID, &s.StartsAt, &s.EndsAt, &s.Capacity, &s.Booked)
+	s.Available = max(s.Capacity-s.Booked, 0)
+	return err
+}
+
+// AddFulfillmentOption creates a pickup location or delivery zone. An
+// unknown vendor is ErrConflict.
+func AddFulfillmentOption(ctx context.Context, db *DB, fo FulfillmentOption) (_ FulfillmentOption, err error) {
+	ctx, end := db.startOp(ctx, "AddFulfillmentOption")
+	defer end(&err)
+	fo.PostalPrefix = tax.PostalCode(fo.PostalPrefix)
+	fo.CreatedAt = time.Now().UTC()
+	fo.ID, err = db.insertID(ctx, db, `
+        INSERT INTO fulfillment_options (vendor_id, method, name, address, postal_prefix, fee, active, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullInt64(fo.VendorID), fo.Method, fo.Name, fo.Address, fo.PostalPrefix, fo.Fee, fo.Active, fo.CreatedAt,
+	)
+	return fo, err
+}
+
+// ListFulfillmentOptions returns the fulfillment options, only the active
+// ones if activeOnly, and only vendorID's if it isn't 0.
+func ListFulfillmentOptions(ctx context.Context, db *DB, vendorID int64, activeOnly bool) (_ []FulfillmentOption, err error) {
+	ctx, end := db.startOp(ctx, "ListFulfillmentOptions")
+	defer end(&err)
+	query := "SELECT " + fulfillmentOptionColumns + " FROM fulfillment_options WHERE 1 = 1"
+	var args []any
+	if vendorID != 0 {
+		query += " AND vendor_id = ?"
+		args = append(args, vendorID)
+	}
+	if activeOnly {
+		query += " AND active = ?"
+		args = append(args, true)
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	options := []FulfillmentOption{}
+	for rows.Next() {
+		var fo FulfillmentOption
+		if err := scanFulfillmentOption(rows, &fo); err != nil {
+			return nil, err
+		}
+		options = append(options, fo)
+	}
+	return options, rows.Err()
+}
+
+// GetFulfillmentOption fetches one fulfillment option, active or not.
+func GetFulfillmentOption(ctx context.Context, db *DB, optionID int64) (_ FulfillmentOption, err error) {
+	ctx, end := db.startOp(ctx, "GetFulfillmentOption")
+	defer end(&err)
+	var fo FulfillmentOption
+	err = scanFulfillmentOption(db.QueryRowContext(ctx,
+		"SELECT "+fulfillmentOptionColumns+" FROM fulfillment_options WHERE id = ?", optionID,
+	), &fo)
+	if err == sql.ErrNoRows {
+		return FulfillmentOption{}, fmt.Errorf("fulfillment option %d: %w", optionID, ErrNotFound)
+	}
+	return fo, err
+}
+
+// SetFulfillmentOptionActive switches an option on or off. Orders already
+// booked into its slots keep them.
+func SetFulfillmentOptionActive(ctx context.Context, db *DB, optionID int64, active bool) (err error) {
+	ctx, end := db.startOp(ctx, "SetFulfillmentOptionActive")
+	defer end(&err)
+	res, err := db.ExecContext(ctx, "UPDATE fulfillment_options SET active = ? WHERE id = ?", active, optionID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("fulfillment option %d: %w", optionID, ErrNotFound)
+	}
+	return nil
+}
+
+// AddSlot creates a time slot. An unknown option is ErrConflict.
+func AddSlot(ctx context.Context, db *DB, s Slot) (_ Slot, err error) {
+	ctx, end := db.startOp(ctx, "AddSlot")
+	defer end(&err)
+	s.StartsAt, s.EndsAt = s.StartsAt.UTC(), s.EndsAt.UTC()
+	s.Booked, s.Available = 0, s.Capacity
+	s.ID, err = db.insertID(ctx, db,
+		"INSERT INTO fulfillment_slots (option_id, starts_at, ends_at, capacity) VALUES (?, ?, ?, ?)",
+		s.OptionID, s.StartsAt, s.EndsAt, s.Capacity,
+	)
+	return s, err
+}
+
+// ListSlots returns optionID's slots starting in [from, to), full or not.
+func ListSlots(ctx context.Context, db *DB, optionID int64, from, to time.Time) (_ []Slot, err error) {
+	ctx, end := db.startOp(ctx, "ListSlots")
+	defer end(&err)
+	rows, err := db.QueryContext(ctx,
+		"SELECT "+slotColumns+" FROM fulfillment_slots WHERE option_id = ? AND starts_at >= ? AND starts_at < ? ORDER BY starts_at, id",
+		optionID, from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	slots := []Slot{}
+	for rows.Next() {
+		var s Slot
+		if err := scanSlot(rows, &s); err != nil {
+			return nil, err
+		}
+		slots = append(slots, s)
+	}
+	return slots, rows.Err()
+}
+
+// QuoteFulfillment is the slot a quoted order is booked into.
+type QuoteFulfillment struct {
+	SlotID          int64     `json:"slot_id"`
+	Method          string    `json:"method"`
+	Option          string    `json:"option"` // the location or zone's name
+	Address         string    `json:"address,omitempty"`
+	DeliveryAddress string    `json:"delivery_address,omitempty"`
+	StartsAt        time.Time `json:"starts_at"`
+	EndsAt          time.Time `json:"ends_at"`
+	Fee             int64     `json:"fee"`
+}
+
+// quoteFulfillment checks that o can be booked into its slot: the slot is
+// upcoming with room left, its option is active, serves quote's postal
+// code and holds only lines of its vendor, and a delivery has an address.
+// Placing the order books the slot again, atomically.
+func quoteFulfillment(ctx context.Context, q querier, o NewOrder, quote *Quote) error {
+	if o.SlotID == 0 {
+		return nil
+	}
+	rows, err := q.QueryContext(ctx, `
+        SELECT s.id, s.option_id, s.starts_at, s.ends_at, s.capacity, s.booked,
+               fo.id, fo.vendor_id, fo.method, fo.name, fo.address, fo.postal_prefix, fo.fee, fo.active, fo.created_at
+        FROM fulfillment_slots s
+        JOIN fulfillment_options fo ON fo.id = s.option_id
+        WHERE s.id = ?`, o.SlotID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("slot %d: %w", o.SlotID, ErrNotFound)
+	}
+	var (
+		s        Slot
+		fo       FulfillmentOption
+		vendorID sql.NullInt64
+	)
+	if err := rows.Scan(&s.ID, &s.OptionID, &s.StartsAt, &s.EndsAt, &s.Capacity, &s.Booked,
+		&fo.ID, &vendorID, &fo.Method, &fo.Name, &fo.Address, &fo.PostalPrefix, &fo.Fee, &fo.Active, &fo.CreatedAt); err != nil {
+		return err
+	}
+	fo.VendorID = vendorID.Int64
+	rows.Close()
+
+	address := strings.TrimSpace(o.DeliveryAddress)
+	switch {
+	case !fo.Active:
+		return fmt.Errorf("%s is not taking orders: %w", fo.Name, ErrSlotUnavailable)
+	case !s.StartsAt.After(time.Now()):
+		return fmt.Errorf("slot %d has already started: %w", s.ID, ErrSlotUnavailable)
+	case s.Booked >= s.Capacity:
+		return fmt.Errorf("slot %d is full: %w", s.ID, ErrSlotUnavailable)
+	case !fo.serves(quote.PostalCode):
+		return fmt.Errorf("%s doesn't deliver to %q: %w", fo.Name, quote.PostalCode, ErrSlotUnavailable)
+	case fo.Method == FulfillmentDelivery && address == "":
+		return fmt.Errorf("delivery needs an address: %w", ErrSlotUnavailable)
+	}
+	if fo.VendorID != 0 {
+		for _, l := range quote.Lines {
+			if l.VendorID != fo.VendorID {
+				return fmt.Errorf("%s doesn't carry item %d: %w", fo.Name, l.ItemID, ErrSlotUnavailable)
+			}
+		}
+	}
+	if fo.Method != FulfillmentDelivery {
+		address = ""
+	}
+	quote.Fulfillment = &QuoteFulfillment{
+		SlotID:          s.ID,
+		Method:          fo.Method,
+		Option:          fo.Name,
+		Address:         fo.Address,
+		DeliveryAddress: address,
+		StartsAt:        s.StartsAt,
+		EndsAt:          s.EndsAt,
+		Fee:             fo.Fee,
+	}
+	quote.FulfillmentFee = fo.Fee
+	return nil
+}
+
+// bookSlot takes one place in slotID for an order. Like the stock update
+// it is a conditional UPDATE, so the row lock it takes makes concurrent
+// orders count against Capacity one at a time.
+func bookSlot(ctx context.Context, tx *dbTx, slotID int64) error {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE fulfillment_slots SET booked = booked + 1 WHERE id = ? AND booked < capacity", slotID,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("slot %d is full: %w", slotID, ErrSlotUnavailable)
+	}
+	return nil
+}
+
+// PickItem is a quantity of one item to pick.
+type PickItem struct {
+	ItemID   int    `json:"item_id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// PickOrder is one order to pack for a slot.
+type PickOrder struct {
+	OrderID         int64      `json:"order_id"`
+	UserID          string     `json:"user_id"`
+	DeliveryAddress string     `json:"delivery_address,omitempty"`
+	PostalCode      string     `json:"postal_code,omitempty"`
+	Items           []PickItem `json:"items"`
+}
+
+// PickSlot is the pick list for one slot: what to pick in total, then
+// order by order.
+type PickSlot struct {
+	Slot   Slot              `json:"slot"`
+	Option FulfillmentOption `json:"option"`
+	Items  []PickItem        `json:"items"`
+	Orders []PickOrder       `json:"orders"`
+}
+
+// PickList returns the slots starting on day (a UTC date) with the orders
+// booked into them, optionally for one vendor's options only. Refunded
+// quantities are left out, and so are voided orders, which never took any
+// money, and the lines of cancelled sub-orders; slots with nothing to pick
+// are still listed.
+func PickList(ctx context.Context, db *DB, day time.Time, vendorID int64) (_ []PickSlot, err error) {
+	ctx, end := db.startOp(ctx, "PickList")
+	defer end(&err)
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	// 1) the day's slots, with their options
+	query := `
+        SELECT s.id, s.option_id, s.starts_at, s.ends_at, s.capacity, s.booked,
+               fo.id, fo.vendor_id, fo.method, fo.name, fo.address, fo.postal_prefix, fo.fee, fo.active, fo.created_at
+        FROM fulfillment_slots s
+        JOIN fulfillment_options fo ON fo.id = s.option_id
+        WHERE s.starts_at >= ? AND s.starts_at < ?`
+	args := []any{from, to}
+	if vendorID != 0 {
+		query += " AND fo.vendor_id = ?"
+		args = append(args, vendorID)
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY s.starts_at, s.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []PickSlot{}
+	bySlot := make(map[int64]int)
+	for rows.Next() {
+		var (
+			ps       = PickSlot{Items: []PickItem{}, Orders: []PickOrder{}}
+			vendorID sql.NullInt64
+		)
+		if err := rows.Scan(&ps.Slot.ID, &ps.Slot.OptionID, &ps.Slot.StartsAt, &ps.Slot.EndsAt, &ps.Slot.Capacity, &ps.Slot.Booked,
+			&ps.Option.ID, &vendorID, &ps.Option.Method, &ps.Option.Name, &ps.Option.Address, &ps.Option.PostalPrefix,
+			&ps.Option.Fee, &ps.Option.Active, &ps.Option.CreatedAt); err != nil {
+			return nil, err
+		}
+		ps.Option.VendorID = vendorID.Int64
+		ps.Slot.Available = max(ps.Slot.Capacity-ps.Slot.Booked, 0)
+		bySlot[ps.Slot.ID] = len(list)
+		list = append(list, ps)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	// 2) what is left to pick of the orders booked into them, less the
+	// lines of cancelled sub-orders (vendor_id NULL is the store's own)
+	rows, err = db.QueryContext(ctx, `
+        SELECT o.slot_id, o.id, o.user_id, o.delivery_address, o.postal_code,
+               oi.item_id, i.name, oi.quantity - oi.refunded_quantity
+        FROM orders o
+        JOIN fulfillment_slots s ON s.id = o.slot_id
+        JOIN order_items oi ON oi.order_id = o.id
+        JOIN sub_orders so ON so.order_id = o.id
+                          AND COALESCE(so.vendor_id, 0) = COALESCE(oi.vendor_id, 0)
+        JOIN items i ON i.id = oi.item_id
+        WHERE s.starts_at >= ? AND s.starts_at < ?
+          AND o.payment_status <> ?
+          AND so.status <> ?
+          AND oi.quantity > oi.refunded_quantity
+        ORDER BY o.slot_id, o.id, oi.item_id`,
+		from, to, PaymentVoided, SubOrderCancelled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			slotID int64
+			po     PickOrder
+			it     PickItem
+		)
+		if err := rows.Scan(&slotID, &po.OrderID, &po.UserID, &po.DeliveryAddress, &po.PostalCode,
+			&it.ItemID, &it.Name, &it.Quantity); err != nil {
+			return nil, err
+		}
+		i, ok := bySlot[slotID]
+		if !ok {
+			continue // another vendor's slot
+		}
+		ps := &list[i]
+		if n := len(ps.Orders); n == 0 || ps.Orders[n-1].OrderID != po.OrderID {
+			po.Items = []PickItem{}
+			ps.Orders = append(ps.Orders, po)
+		}
+		last := &ps.Orders[len(ps.Orders)-1]
+		last.Items = append(last.Items, it)
+		addPickItem(&ps.Items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, ps := range list {
+		slices.SortFunc(ps.Items, func(a, b PickItem) int { return cmp.Compare(a.ItemID, b.ItemID) })
+	}
+	return list, nil
+}
+
+// addPickItem adds it to a slot's totals.
+func addPickItem(items *[]PickItem, it PickItem) {
+	for i := range *items {
+		if (*items)[i].ItemID == it.ItemID {
+			(*items)[i].Quantity += it.Quantity
+			return
+		}
+	}
+	*items = append(*items, it)
+}
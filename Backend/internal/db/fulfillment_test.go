@@ -0,0 +1,106 @@
+// internal/db/fulfillment_test.go
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// addTestSlot adds a store pickup option with one slot tomorrow.
+func addTestSlot(t *testing.T, d *DB, capacity int) Slot {
+	t.Helper()
+	ctx := context.Background()
+	fo, err := AddFulfillmentOption(ctx, d, FulfillmentOption{Method: FulfillmentPickup, Name: "Shop", Address: "1 Lane", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Hour)
+	slot, err := AddSlot(ctx, d, Slot{OptionID: fo.ID, StartsAt: start, EndsAt: start.Add(time.Hour), Capacity: capacity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return slot
+}
+
+// bookedOf returns how many places of slotID are taken.
+func bookedOf(t *testing.T, d *DB, slotID int64) int {
+	t.Helper()
+	var n int
+	if err := d.QueryRowContext(context.Background(), "SELECT booked FROM fulfillment_slots WHERE id = ?", slotID).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSlotCapacity(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	mug := addTestItem(t, d, "mug", 9, 10, 0)
+	slot := addTestSlot(t, d, 2)
+	order := NewOrder{UserID: "u1", Items: map[int]int{mug: 1}, SlotID: slot.ID}
+
+	for range 2 {
+		if _, err := PlaceOrder(ctx, d, order, Payment{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := QuoteOrder(ctx, d, order); !errors.Is(err, ErrSlotUnavailable) {
+		t.Errorf("quote for a full slot: %v, want ErrSlotUnavailable", err)
+	}
+	if _, err := PlaceOrder(ctx, d, order, Payment{}); !errors.Is(err, ErrSlotUnavailable) {
+		t.Errorf("order into a full slot: %v, want ErrSlotUnavailable", err)
+	}
+
+	// an order quoted while there was room still can't take a place
+	err := d.inTx(ctx, nil, func(tx *dbTx) error { return bookSlot(ctx, tx, slot.ID) })
+	if !errors.Is(err, ErrSlotUnavailable) {
+		t.Errorf("booking a full slot: %v, want ErrSlotUnavailable", err)
+	}
+	if got := bookedOf(t, d, slot.ID); got != 2 {
+		t.Errorf("%d booked, want 2", got)
+	}
+	if got := stockOf(t, d, mug); got != 8 {
+		t.Errorf("stock %d, want 8", got)
+	}
+}
+
+// TestSlotCapacityConcurrent places orders into one slot at the same
+// time: no more than its capacity may get in.
+func TestSlotCapacityConcurrent(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	mug := addTestItem(t, d, "mug", 9, 100, 0)
+	slot := addTestSlot(t, d, 3)
+
+	const n = 8
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = PlaceOrder(ctx, d, NewOrder{UserID: fmt.Sprintf("u%d", i), Items: map[int]int{mug: 1}, SlotID: slot.ID}, Payment{})
+		}()
+	}
+	wg.Wait()
+
+	placed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !errors.Is(err, ErrSlotUnavailable):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if placed != 3 || bookedOf(t, d, slot.ID) != 3 {
+		t.Errorf("%d orders placed, %d booked; want 3", placed, bookedOf(t, d, slot.ID))
+	}
+	if got := stockOf(t, d, mug); got != 97 {
+		t.Errorf("stock %d, want 97", got)
+	}
+}
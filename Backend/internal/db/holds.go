@@ -0,0 +1,180 @@
+// internal/db/holds.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ErrHoldLimit is returned by HoldStock for a holder that has renewed its
+// holds as often as it may.
+var ErrHoldLimit = errors.New("hold renewal limit reached")
+
+// Hold is stock set aside for a holder until ExpiresAt.
+type Hold struct {
+	ItemID    int       `json:"item_id"`
+	Quantity  int       `json:"quantity"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	renewals int
+}
+
+// CartHolder names the holds of a cart's checkout.
+func CartHolder(cartID int64) string { return "cart:" + strconv.FormatInt(cartID, 10) }
+
+// UserHolder names the holds of a signed‑in user's checkout of POST /orders.
+func UserHolder(userID string) string { return "user:" + userID }
+
+// heldByOthers is the stock of items.id held by holders other than the
+// first argument ("" for every holder) and not expired at the second:
+// what an item's stock less it leaves is what that holder can have.
+const heldByOthers = `COALESCE((SELECT SUM(h.quantity) FROM stock_holds h
+        WHERE h.item_id = items.id AND h.holder <> ? AND h.expires_at > ?), 0)`
+
+// lockAvailable locks an item's row and returns how much of its stock
+// holder can have: its stock less what others hold. The row lock is what
+// makes holds and orders of an item take their turn, and the holds are
+// summed by a statement of their own, after the lock is granted, so a
+// hold committed while waiting for it is counted.
+func lockAvailable(ctx context.Context, db *DB, tx *dbTx, itemID int, holder string, now time.Time) (int, error) {
+	var stock int
+	err := tx.QueryRowContext(ctx,
+		"SELECT stock FROM items WHERE id = ?"+db.dialect.forUpdate, itemID,
+	).Scan(&stock)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("item %d: %w", itemID, ErrNotFound)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var held int
+	if err := tx.QueryRowContext(ctx,
+		"SELECT "+heldByOthers+" FROM items WHERE id = ?", holder, now, itemID,
+	).Scan(&held); err != nil {
+		return 0, err
+	}
+	return stock - held, nil
+}
+
+// HoldStock sets aside items (quantities by item ID) for holder until ttl
+// from now, replacing whatever holder held before; empty items releases
+// everything. A call while holder still holds something renews its holds,
+// and with maxRenewals above 0 it may do so only that many times in a row.
+// It fails with ErrNotFound for an unknown item, ErrInsufficientStock if
+// others already hold too much of one and ErrHoldLimit past maxRenewals,
+// in which cases holder keeps what it held.
+func HoldStock(ctx context.Context, db *DB, holder string, items map[int]int, ttl time.Duration, maxRenewals int) (_ []Hold, err error) {
+	ctx, end := db.startOp(ctx, "HoldStock")
+	defer end(&err)
+	now := time.Now().UTC()
+	expires := now.Add(ttl)
+	ids := make([]int, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids) // lock items in the same order as placeOrder
+
+	holds := []Hold{}
+	err = db.inTx(ctx, orderTxOptions, func(tx *dbTx) error {
+		holds = holds[:0]
+		// 1) count the renewal, if holder still holds anything
+		held, err := liveHolds(ctx, tx, holder, now)
+		if err != nil {
+			return err
+		}
+		renewals := 0
+		for _, h := range held {
+			renewals = max(renewals, h.renewals+1)
+		}
+		if maxRenewals > 0 && renewals > maxRenewals && len(ids) > 0 {
+			return fmt.Errorf("%s renewed its holds %d times: %w", holder, renewals-1, ErrHoldLimit)
+		}
+
+		// 2) lock the items and check there is enough for holder
+		for _, id := range ids {
+			avail, err := lockAvailable(ctx, db, tx, id, holder, now)
+			if err != nil {
+				return err
+			}
+			if qty := items[id]; qty > avail {
+				return fmt.Errorf("item %d: %d requested, %d available: %w", id, qty, max(avail, 0), ErrInsufficientStock)
+			}
+		}
+
+		// 3) replace holder's holds
+		if _, err := tx.ExecContext(ctx, "DELETE FROM stock_holds WHERE holder = ?", holder); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if items[id] <= 0 {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO stock_holds (holder, item_id, quantity, expires_at, renewals) VALUES (?, ?, ?, ?, ?)",
+				holder, id, items[id], expires, renewals,
+			); err != nil {
+				return err
+			}
+			holds = append(holds, Hold{ItemID: id, Quantity: items[id], ExpiresAt: expires, renewals: renewals})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// GetHolds returns holder's holds that haven't expired, by item ID.
+func GetHolds(ctx context.Context, db *DB, holder string) (_ []Hold, err error) {
+	ctx, end := db.startOp(ctx, "GetHolds")
+	defer end(&err)
+	return liveHolds(ctx, db, holder, time.Now().UTC())
+}
+
+// liveHolds returns holder's holds that haven't expired at now.
+func liveHolds(ctx context.Context, q querier, holder string, now time.Time) ([]Hold, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT item_id, quantity, expires_at, renewals FROM stock_holds WHERE holder = ? AND expires_at > ? ORDER BY item_id",
+		holder, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	holds := []Hold{}
+	for rows.Next() {
+		var h Hold
+		if err := rows.Scan(&h.ItemID, &h.Quantity, &h.ExpiresAt, &h.renewals); err != nil {
+			return nil, err
+		}
+		holds = append(holds, h)
+	}
+	return holds, rows.Err()
+}
+
+// ReleaseHolds gives back everything holder holds.
+func ReleaseHolds(ctx context.Context, db *DB, holder string) (err error) {
+	ctx, end := db.startOp(ctx, "ReleaseHolds")
+	defer end(&err)
+	_, err = db.ExecContext(ctx, "DELETE FROM stock_holds WHERE holder = ?", holder)
+	return err
+}
+
+// ReleaseExpiredHolds deletes the holds that have expired and returns how
+// many there were. Expired holds already no longer count against stock;
+// this only keeps the table small.
+func ReleaseExpiredHolds(ctx context.Context, db *DB) (_ int64, err error) {
+	ctx, end := db.startOp(ctx, "ReleaseExpiredHolds")
+	defer end(&err)
+	res, err := db.ExecContext(ctx, "DELETE FROM stock_holds WHERE expires_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
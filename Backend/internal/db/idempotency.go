@@ -0,0 +1,150 @@
+// internal/db/idempotency.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrIdempotencyMismatch is returned when an idempotency key is reused
+// with a different request than the one it was first sent with.
+var ErrIdempotencyMismatch = errors.New("idempotency key reused with a different request")
+
+// errKeyTaken aborts the order transaction when the key row already exists.
+var errKeyTaken = errors.New("idempotency key taken")
+
+// IdempotencyKey identifies one client attempt at a request.
+type IdempotencyKey struct {
+	UserID      string
+	Key         string        // Idempotency-Key header
+	RequestHash string        // hex SHA‑256 of the canonical request
+	TTL         time.Duration // how long the response is kept for replay
+}
+
+// StoredResponse is the response kept for an idempotency key.
+type StoredResponse struct {
+	Status int
+	Body   []byte
+}
+
+// PlaceOrderIdempotent places an order like PlaceOrder, at most once per
+// key. The key row is written in the same transaction as the order, along
+// with the response render builds for it, so either both exist or neither
+// does; a failed attempt (say, out of stock) leaves the key free to retry.
+//
+// If the key was already used within its TTL, nothing is placed and the
+// stored response comes back with replayed set, or ErrIdempotencyMismatch
+// if the request hash differs. A concurrent duplicate blocks on the key's
+// primary key until the first attempt commits, and then replays it; it
+// never touches stock, so it can't fail where the first attempt succeeded.
+func PlaceOrderIdempotent(ctx context.Context, db *DB, key IdempotencyKey, o NewOrder, pay Payment, render func(orderID int64) (StoredResponse, error)) (resp StoredResponse, replayed bool, err error) {
+	ctx, end := db.startOp(ctx, "PlaceOrderIdempotent")
+	defer end(&err)
+
+	now := time.Now().UTC()
+	err = db.inTx(ctx, orderTxOptions, func(tx *dbTx) error {
+		// 1) drop the user's expired keys, so an expired key can be reused
+		if _, err := tx.ExecContext(ctx,
+			"DELETE FROM idempotency_keys WHERE user_id = ? AND expires_at <= ?", key.UserID, now,
+		); err != nil {
+			return err
+		}
+
+		// 2) claim the key. If another attempt holds it, this waits until
+		//    that one commits or rolls back.
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO idempotency_keys
+                (user_id, idem_key, request_hash, response_status, response_body, created_at, expires_at)
+            VALUES (?, ?, ?, 0, '', ?, ?)`,
+			key.UserID, key.Key, key.RequestHash, now, now.Add(key.TTL),
+		); err != nil {
+			if db.dialect.constraint(err) {
+				return errKeyTaken
+			}
+			return err
+		}
+
+		// 3) place the order and keep its response with the key
+		o.UserID = key.UserID
+		orderID, err := placeOrder(ctx, db, tx, o, pay)
+		if err != nil {
+			return err
+		}
+		resp, err = render(orderID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+            UPDATE idempotency_keys SET response_status = ?, response_body = ?
+            WHERE user_id = ? AND idem_key = ?`,
+			resp.Status, string(resp.Body), key.UserID, key.Key,
+		)
+		return err
+	})
+	if errors.Is(err, errKeyTaken) {
+		resp, err = storedResponse(ctx, db, key)
+		return resp, err == nil, err
+	}
+	if err != nil {
+		return StoredResponse{}, false, err
+	}
+	return resp, false, nil
+}
+
+// LookupIdempotencyKey returns the response stored for key, if the key
+// was used within its TTL, or ErrIdempotencyMismatch. It lets a retry be
+// answered before any payment is taken; PlaceOrderIdempotent still makes
+// the final decision.
+func LookupIdempotencyKey(ctx context.Context, db *DB, key IdempotencyKey) (_ StoredResponse, found bool, err error) {
+	ctx, end := db.startOp(ctx, "LookupIdempotencyKey")
+	defer end(&err)
+	var expires time.Time
+	err = db.QueryRowContext(ctx,
+		"SELECT expires_at FROM idempotency_keys WHERE user_id = ? AND idem_key = ?",
+		key.UserID, key.Key,
+	).Scan(&expires)
+	if err == sql.ErrNoRows {
+		return StoredResponse{}, false, nil
+	}
+	if err != nil {
+		return StoredResponse{}, false, err
+	}
+	if !expires.After(time.Now()) {
+		return StoredResponse{}, false, nil
+	}
+	resp, err := storedResponse(ctx, db, key)
+	if err != nil {
+		return StoredResponse{}, false, err
+	}
+	return resp, true, nil
+}
+
+// storedResponse reads back the response kept for key.
+func storedResponse(ctx context.Context, db *DB, key IdempotencyKey) (StoredResponse, error) {
+	var (
+		hash string
+		body string
+		resp StoredResponse
+	)
+	err := db.QueryRowContext(ctx, `
+        SELECT request_hash, response_status, response_body
+        FROM idempotency_keys
+        WHERE user_id = ? AND idem_key = ?`,
+		key.UserID, key.Key,
+	).Scan(&hash, &resp.Status, &body)
+	if err == sql.ErrNoRows {
+		// the first attempt rolled back, or the key expired in between
+		return resp, fmt.Errorf("idempotency key %q changed during the request: %w", key.Key, ErrConflict)
+	}
+	if err != nil {
+		return resp, err
+	}
+	if hash != key.RequestHash {
+		return resp, ErrIdempotencyMismatch
+	}
+	resp.Body = []byte(body)
+	return resp, nil
+}
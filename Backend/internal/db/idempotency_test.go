@@ -0,0 +1,161 @@
+// internal/db/idempotency_test.go
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// renderOrder is the response the tests store with an order.
+func renderOrder(orderID int64) (StoredResponse, error) {
+	return StoredResponse{Status: 201, Body: []byte(fmt.Sprintf(`{"order_id":%d}`, orderID))}, nil
+}
+
+func TestPlaceOrderIdempotent(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0)
+	order := NewOrder{Items: map[int]int{eggs: 2}}
+	key := IdempotencyKey{UserID: "u1", Key: "k1", RequestHash: "h1", TTL: time.Hour}
+
+	first, replayed, err := PlaceOrderIdempotent(ctx, d, key, order, Payment{}, renderOrder)
+	if err != nil || replayed {
+		t.Fatalf("first attempt: replayed %v, %v", replayed, err)
+	}
+
+	// a retry gets the same response and places nothing
+	if resp, found, err := LookupIdempotencyKey(ctx, d, key); err != nil || !found || string(resp.Body) != string(first.Body) {
+		t.Errorf("lookup: %s found %v, %v; want %s", resp.Body, found, err, first.Body)
+	}
+	again, replayed, err := PlaceOrderIdempotent(ctx, d, key, order, Payment{}, renderOrder)
+	if err != nil || !replayed || again.Status != 201 || string(again.Body) != string(first.Body) {
+		t.Errorf("retry: %d %s replayed %v, %v; want %s replayed", again.Status, again.Body, replayed, err, first.Body)
+	}
+	if n := count(t, d, "orders", "1 = 1"); n != 1 {
+		t.Errorf("%d orders, want 1", n)
+	}
+	if got := stockOf(t, d, eggs); got != 8 {
+		t.Errorf("stock %d, want 8", got)
+	}
+
+	// the same key with a different request is refused
+	changed := key
+	changed.RequestHash = "h2"
+	if _, _, err := LookupIdempotencyKey(ctx, d, changed); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("lookup with another request: %v, want ErrIdempotencyMismatch", err)
+	}
+	if _, _, err := PlaceOrderIdempotent(ctx, d, changed, order, Payment{}, renderOrder); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("retry with another request: %v, want ErrIdempotencyMismatch", err)
+	}
+
+	// keys belong to a user
+	other := key
+	other.UserID = "u2"
+	if _, replayed, err := PlaceOrderIdempotent(ctx, d, other, order, Payment{}, renderOrder); err != nil || replayed {
+		t.Errorf("another user's key: replayed %v, %v", replayed, err)
+	}
+	if n := count(t, d, "orders", "1 = 1"); n != 2 {
+		t.Errorf("%d orders, want 2", n)
+	}
+}
+
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0)
+	order := NewOrder{Items: map[int]int{eggs: 1}}
+	key := IdempotencyKey{UserID: "u1", Key: "k1", RequestHash: "h1", TTL: -time.Second}
+
+	if _, _, err := PlaceOrderIdempotent(ctx, d, key, order, Payment{}, renderOrder); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := LookupIdempotencyKey(ctx, d, key); err != nil || found {
+		t.Errorf("lookup of an expired key: found %v, %v", found, err)
+	}
+
+	// once expired the key is free again, even for a different request
+	key.RequestHash, key.TTL = "h2", time.Hour
+	if _, replayed, err := PlaceOrderIdempotent(ctx, d, key, order, Payment{}, renderOrder); err != nil || replayed {
+		t.Fatalf("reuse after expiry: replayed %v, %v", replayed, err)
+	}
+	if n := count(t, d, "orders", "1 = 1"); n != 2 {
+		t.Errorf("%d orders, want 2", n)
+	}
+	if n := count(t, d, "idempotency_keys", "1 = 1"); n != 1 {
+		t.Errorf("%d keys kept, want 1", n)
+	}
+}
+
+// TestIdempotencyKeyFailedAttempt checks a failed order doesn't use up
+// its key.
+func TestIdempotencyKeyFailedAttempt(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 1, 0)
+	order := NewOrder{Items: map[int]int{eggs: 2}}
+	key := IdempotencyKey{UserID: "u1", Key: "k1", RequestHash: "h1", TTL: time.Hour}
+
+	if _, _, err := PlaceOrderIdempotent(ctx, d, key, order, Payment{}, renderOrder); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("err %v, want ErrInsufficientStock", err)
+	}
+	if n := count(t, d, "idempotency_keys", "1 = 1"); n != 0 {
+		t.Errorf("%d keys left by a failed attempt", n)
+	}
+	if err := UpdateItemStock(ctx, d, eggs, 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, replayed, err := PlaceOrderIdempotent(ctx, d, key, order, Payment{}, renderOrder); err != nil || replayed {
+		t.Errorf("retry after restock: replayed %v, %v", replayed, err)
+	}
+}
+
+// TestIdempotencyKeyConcurrent sends a duplicate while the first attempt's
+// transaction is still open: it must wait for it and then replay it.
+func TestIdempotencyKeyConcurrent(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 3, 0)
+	order := NewOrder{Items: map[int]int{eggs: 2}}
+	key := IdempotencyKey{UserID: "u1", Key: "k1", RequestHash: "h1", TTL: time.Hour}
+
+	type result struct {
+		resp     StoredResponse
+		replayed bool
+		err      error
+	}
+	dup := make(chan result, 1)
+	var once sync.Once
+	d.afterOrderInsert = func(context.Context) {
+		once.Do(func() {
+			go func() {
+				resp, replayed, err := PlaceOrderIdempotent(ctx, d, key, order, Payment{}, renderOrder)
+				dup <- result{resp, replayed, err}
+			}()
+			select {
+			case r := <-dup:
+				t.Errorf("duplicate finished while the first attempt was open: %+v", r)
+				dup <- r
+			case <-time.After(200 * time.Millisecond):
+			}
+		})
+	}
+
+	first, replayed, err := PlaceOrderIdempotent(ctx, d, key, order, Payment{}, renderOrder)
+	if err != nil || replayed {
+		t.Fatalf("first attempt: replayed %v, %v", replayed, err)
+	}
+	r := <-dup
+	if r.err != nil || !r.replayed || string(r.resp.Body) != string(first.Body) {
+		t.Errorf("duplicate: %s replayed %v, %v; want %s replayed", r.resp.Body, r.replayed, r.err, first.Body)
+	}
+	if n := count(t, d, "orders", "1 = 1"); n != 1 {
+		t.Errorf("%d orders, want 1", n)
+	}
+	if got := stockOf(t, d, eggs); got != 1 {
+		t.Errorf("stock %d, want 1", got)
+	}
+}
@@ -0,0 +1,228 @@
+// internal/db/item_images.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ItemImage is one picture in an item's gallery.
+type ItemImage struct {
+	ID        int64  `json:"id"`
+	ItemID    int    `json:"item_id"`
+	AltText   string `json:"alt_text"`
+	SortOrder int    `json:"sort_order"`
+	Primary   bool   `json:"primary"`
+
+	// URLs links each generated size; filled in by the server from Key.
+	URLs ImageVariants `json:"urls"`
+
+	Key string `json:"-"` // blob‑store key of the full‑size variant
+}
+
+// loadGalleries fills in Gallery and ImageKey for items from the
+// item_images rows selected by where (e.g. "WHERE item_id = ?").
+func loadGalleries(ctx context.Context, db *DB, items []Item, where string, args ...any) error {
+	byID := make(map[int]*Item, len(items))
+	for i := range items {
+		items[i].Gallery = []ItemImage{}
+		byID[items[i].ID] = &items[i]
+	}
+	rows, err := db.QueryContext(ctx, `
+        SELECT id, item_id, image_key, alt_text, sort_order, is_primary
+        FROM item_images `+where+`
+        ORDER BY item_id, sort_order, id`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var img ItemImage
+		if err := rows.Scan(&img.ID, &img.ItemID, &img.Key, &img.AltText, &img.SortOrder, &img.Primary); err != nil {
+			return err
+		}
+		it := byID[img.ItemID]
+		if it == nil {
+			continue
+		}
+		it.Gallery = append(it.Gallery, img)
+		if img.Primary {
+			it.ImageKey = img.Key
+		}
+	}
+	return rows.Err()
+}
+
+// GetItemImages returns an item's gallery in display order.
+func GetItemImages(ctx context.Context, db *DB, itemID int) (_ []ItemImage, err error) {
+	ctx, end := db.startOp(ctx, "GetItemImages")
+	defer end(&err)
+	items := []Item{{ID: itemID}}
+	if err := loadGalleries(ctx, db, items, "WHERE item_id = ?", itemID); err != nil {
+		return nil, err
+	}
+	return items[0].Gallery, nil
+}
+
+// AddItemImage appends an image to the end of an item's gallery. The
+// first image an item gets becomes its primary one.
+func AddItemImage(ctx context.Context, db *DB, itemID int, key, altText string) (_ *ItemImage, err error) {
+	ctx, end := db.startOp(ctx, "AddItemImage")
+	defer end(&err)
+
+	img := &ItemImage{ItemID: itemID, AltText: altText, Key: key}
+	err = db.inTx(ctx, nil, func(tx *dbTx) error {
+		// 1) the item must exist; locking it also serialises concurrent
+		//    uploads so two images can't both become primary
+		var id int
+		err := tx.QueryRowContext(ctx,
+			"SELECT id FROM items WHERE id = ?"+db.dialect.forUpdate, itemID,
+		).Scan(&id)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("item %d: %w", itemID, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		// 2) next position, and primary if the gallery is empty
+		var count int
+		var last sql.NullInt64
+		if err := tx.QueryRowContext(ctx,
+			"SELECT COUNT(*), MAX(sort_order) FROM item_images WHERE item_id = ?", itemID,
+		).Scan(&count, &last); err != nil {
+			return err
+		}
+		if last.Valid {
+			img.SortOrder = int(last.Int64) + 1
+		}
+		img.Primary = count == 0
+
+		// 3) insert
+		img.ID, err = db.insertID(ctx, tx, `
+            INSERT INTO item_images (item_id, image_key, alt_text, sort_order, is_primary, created_at)
+            VALUES (?, ?, ?, ?, ?, ?)`,
+			itemID, key, altText, img.SortOrder, img.Primary, time.Now().UTC(),
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// ReorderItemImages sets the gallery order to imageIDs, which must name
+// every image of the item exactly once, and makes primaryID the primary
+// image (0 leaves the primary alone). It fails with ErrNotFound if the
+// IDs don't match the item's gallery.
+func ReorderItemImages(ctx context.Context, db *DB, itemID int, imageIDs []int64, primaryID int64) (err error) {
+	ctx, end := db.startOp(ctx, "ReorderItemImages")
+	defer end(&err)
+	return db.inTx(ctx, nil, func(tx *dbTx) error {
+		// 1) imageIDs must be a permutation of the gallery
+		have, err := galleryIDs(ctx, tx, itemID)
+		if err != nil {
+			return err
+		}
+		seen := make(map[int64]bool, len(imageIDs))
+		for _, id := range imageIDs {
+			if !have[id] || seen[id] {
+				return fmt.Errorf("image %d of item %d: %w", id, itemID, ErrNotFound)
+			}
+			seen[id] = true
+		}
+		if len(seen) != len(have) {
+			return fmt.Errorf("item %d has %d images, got %d: %w", itemID, len(have), len(seen), ErrNotFound)
+		}
+		if primaryID != 0 && !have[primaryID] {
+			return fmt.Errorf("image %d of item %d: %w", primaryID, itemID, ErrNotFound)
+		}
+
+		// 2) renumber, and move the primary flag
+		for pos, id := range imageIDs {
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE item_images SET sort_order = ? WHERE id = ?",
+				pos, id,
+			); err != nil {
+				return err
+			}
+		}
+		if primaryID != 0 {
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE item_images SET is_primary = (id = ?) WHERE item_id = ?",
+				primaryID, itemID,
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteItemImage removes one image from an item's gallery and returns
+// its blob key so the caller can delete the files. If it was the primary
+// image, the next one in display order takes over.
+func DeleteItemImage(ctx context.Context, db *DB, itemID int, imageID int64) (_ string, err error) {
+	ctx, end := db.startOp(ctx, "DeleteItemImage")
+	defer end(&err)
+	var key string
+	err = db.inTx(ctx, nil, func(tx *dbTx) error {
+		var primary bool
+		err := tx.QueryRowContext(ctx,
+			"SELECT image_key, is_primary FROM item_images WHERE id = ? AND item_id = ?"+db.dialect.forUpdate,
+			imageID, itemID,
+		).Scan(&key, &primary)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("image %d of item %d: %w", imageID, itemID, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM item_images WHERE id = ?", imageID); err != nil {
+			return err
+		}
+		if !primary {
+			return nil
+		}
+		var next int64
+		err = tx.QueryRowContext(ctx,
+			"SELECT id FROM item_images WHERE item_id = ? ORDER BY sort_order, id LIMIT 1",
+			itemID,
+		).Scan(&next)
+		if err == sql.ErrNoRows {
+			return nil // that was the last image
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE item_images SET is_primary = TRUE WHERE id = ?", next)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// galleryIDs returns the set of image IDs an item has.
+func galleryIDs(ctx context.Context, tx *dbTx, itemID int) (map[int64]bool, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM item_images WHERE item_id = ?", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,159 @@
+// internal/db/migrate.go
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"nexus.local/internal/logging"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFS embed.FS
+
+// migration is one numbered schema change, e.g. "0001_init".
+type migration struct {
+	version string
+	sql     string
+}
+
+// migrations returns the embedded migrations for d in the order they
+// apply. Each dialect has its own copy of every migration under
+// migrations/<driver>/, with the same version names.
+func migrations(d *dialect) ([]migration, error) {
+	dir := "migrations/" + d.name + "/"
+	names, err := fs.Glob(migrationFS, dir+"*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var out []migration
+	for _, name := range names {
+		body, err := migrationFS.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		version := strings.TrimSuffix(strings.TrimPrefix(name, dir), ".sql")
+		out = append(out, migration{version: version, sql: string(body)})
+	}
+	return out, nil
+}
+
+// Migrate applies every migration not yet recorded in schema_migrations.
+// Each migration runs and is recorded in its own transaction. SQLite and
+// Postgres roll a failed migration back entirely; MySQL auto‑commits each
+// DDL statement, so a MySQL migration that fails partway leaves the
+// statements before the failing one applied, and running it again fails
+// on them (duplicate column or index). Recover by hand: undo those
+// statements, or apply the rest of the file and insert its version into
+// schema_migrations, then start the server again.
+// Migrations are not subject to db.QueryTimeout.
+func Migrate(ctx context.Context, db *DB) (err error) {
+	ctx, end := db.startSpan(ctx, "Migrate")
+	defer end(&err)
+	if _, err := db.ExecContext(ctx, `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version    VARCHAR(255) NOT NULL PRIMARY KEY,
+            applied_at `+db.dialect.timestamp+` NOT NULL
+        )`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	pending, err := PendingMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+	all, err := migrations(db.dialect)
+	if err != nil {
+		return err
+	}
+	for _, m := range all {
+		if !slices.Contains(pending, m.version) {
+			continue
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.version, err)
+		}
+		logging.FromContext(ctx).Info("applied migration", slog.String("version", m.version))
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *DB, m migration) error {
+	return db.runTx(ctx, nil, func(tx *dbTx) error {
+		for _, stmt := range splitStatements(m.sql) {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+			m.version, time.Now().UTC(),
+		)
+		return err
+	})
+}
+
+// PendingMigrations lists the embedded migrations the database hasn't
+// recorded yet. An empty result means the schema is up to date.
+func PendingMigrations(ctx context.Context, db *DB) (_ []string, err error) {
+	ctx, end := db.startSpan(ctx, "PendingMigrations")
+	defer end(&err)
+	rows, err := db.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	all, err := migrations(db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, m := range all {
+		if !applied[m.version] {
+			pending = append(pending, m.version)
+		}
+	}
+	return pending, nil
+}
+
+// splitStatements splits a migration file on semicolons that end a line,
+// dropping "--" comment lines.
+func splitStatements(src string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(cur.String()), ";"))
+			cur.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(cur.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
@@ -0,0 +1,64 @@
+// internal/db/migrate_test.go
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+
+	pending, err := PendingMigrations(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("pending after Migrate: %v", pending)
+	}
+	all, err := migrations(d.dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, d, "schema_migrations", "1 = 1"); n != len(all) {
+		t.Errorf("%d migrations recorded, %d embedded", n, len(all))
+	}
+
+	// a second run has nothing to do
+	if err := Migrate(ctx, d); err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+}
+
+// TestMigrationsMatchAcrossDialects checks every dialect has its own copy
+// of every migration.
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	var want []string
+	for _, driver := range []string{DriverMySQL, DriverSQLite, DriverPostgres} {
+		d, err := dialectFor(driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms, err := migrations(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var versions []string
+		for _, m := range ms {
+			versions = append(versions, m.version)
+		}
+		if want == nil {
+			want = versions
+			continue
+		}
+		if len(versions) != len(want) {
+			t.Fatalf("%s has migrations %v, mysql has %v", driver, versions, want)
+		}
+		for i := range want {
+			if versions[i] != want[i] {
+				t.Errorf("%s migration %d is %s, mysql has %s", driver, i, versions[i], want[i])
+			}
+		}
+	}
+}
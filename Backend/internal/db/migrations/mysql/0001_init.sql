@@ -0,0 +1,42 @@
+-- Baseline schema. Uses IF NOT EXISTS so databases created by hand before
+-- migrations existed are adopted as-is.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                  VARCHAR(64)  NOT NULL PRIMARY KEY,
+    display_name        VARCHAR(255),
+    given_name          VARCHAR(255),
+    surname             VARCHAR(255),
+    job_title           VARCHAR(255),
+    mail                VARCHAR(255),
+    mobile_phone        VARCHAR(64),
+    office_location     VARCHAR(255),
+    preferred_language  VARCHAR(32),
+    user_principal_name VARCHAR(255),
+    business_phones     JSON,
+    is_admin            BOOLEAN      NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS items (
+    id          INT           NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name        VARCHAR(255)  NOT NULL,
+    description TEXT          NOT NULL,
+    price       DECIMAL(10,2) NOT NULL,
+    stock       INT           NOT NULL DEFAULT 0,
+    image_url   VARCHAR(512)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id         BIGINT      NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    user_id    VARCHAR(64) NOT NULL,
+    created_at DATETIME    NOT NULL,
+    INDEX idx_orders_user (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id BIGINT NOT NULL,
+    item_id  INT    NOT NULL,
+    quantity INT    NOT NULL,
+    PRIMARY KEY (order_id, item_id),
+    FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items (id)
+);
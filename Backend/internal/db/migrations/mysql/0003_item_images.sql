@@ -0,0 +1,21 @@
+-- A gallery per item. sort_order sets the display order and exactly one
+-- image per item is primary (kept so by the data‑access functions); the
+-- primary image is what image_url reports. Existing single images become
+-- each item's primary gallery image.
+
+CREATE TABLE IF NOT EXISTS item_images (
+    id         BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    item_id    INT          NOT NULL,
+    image_key  VARCHAR(512) NOT NULL,
+    alt_text   VARCHAR(255) NOT NULL DEFAULT '',
+    sort_order INTEGER      NOT NULL DEFAULT 0,
+    is_primary BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at DATETIME     NOT NULL,
+    INDEX idx_item_images_item (item_id, sort_order),
+    FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+);
+
+INSERT INTO item_images (item_id, image_key, alt_text, sort_order, is_primary, created_at)
+SELECT id, image_key, '', 0, TRUE, CURRENT_TIMESTAMP
+FROM items
+WHERE image_key IS NOT NULL;
@@ -0,0 +1,20 @@
+-- Server-side shopping carts. A cart belongs either to a signed-in user
+-- (user_id) or to an anonymous browser (token, kept in a cookie); an
+-- anonymous cart is merged into the user's cart once they sign in.
+
+CREATE TABLE IF NOT EXISTS carts (
+    id         BIGINT      NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    user_id    VARCHAR(64) UNIQUE,
+    token      VARCHAR(64) UNIQUE,
+    created_at DATETIME    NOT NULL,
+    updated_at DATETIME    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    cart_id  BIGINT  NOT NULL,
+    item_id  INT     NOT NULL,
+    quantity INTEGER NOT NULL,
+    PRIMARY KEY (cart_id, item_id),
+    FOREIGN KEY (cart_id) REFERENCES carts (id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+);
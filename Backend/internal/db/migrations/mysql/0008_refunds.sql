@@ -0,0 +1,34 @@
+-- Refunds. Each refund is a ledger entry tied to its order, with the lines
+-- and quantities it gives back. order_items now remembers the price each
+-- line was sold at (in cents), so a line is refunded at what was paid, and
+-- how much of it has been refunded. Lines of older orders take the item's
+-- current price.
+
+ALTER TABLE order_items ADD COLUMN unit_price BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN refunded_quantity INTEGER NOT NULL DEFAULT 0;
+
+UPDATE order_items SET unit_price = (SELECT ROUND(price * 100) FROM items WHERE items.id = order_items.item_id);
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id                BIGINT       NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    order_id          BIGINT       NOT NULL,
+    amount            BIGINT       NOT NULL,
+    restock           BOOLEAN      NOT NULL,
+    reason            VARCHAR(500) NOT NULL DEFAULT '',
+    status            VARCHAR(16)  NOT NULL,
+    gateway_refund_id VARCHAR(128),
+    created_by        VARCHAR(64)  NOT NULL,
+    created_at        DATETIME     NOT NULL,
+    FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS refund_items (
+    refund_id BIGINT  NOT NULL,
+    item_id   INTEGER NOT NULL,
+    quantity  INTEGER NOT NULL,
+    amount    BIGINT  NOT NULL,
+    PRIMARY KEY (refund_id, item_id),
+    FOREIGN KEY (refund_id) REFERENCES refunds (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_refunds_order ON refunds (order_id);
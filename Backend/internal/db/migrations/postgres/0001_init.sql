@@ -0,0 +1,43 @@
+-- Baseline schema, Postgres flavour of mysql/0001_init.sql. Identity
+-- columns replace AUTO_INCREMENT and indexes are declared separately.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                  VARCHAR(64)  NOT NULL PRIMARY KEY,
+    display_name        VARCHAR(255),
+    given_name          VARCHAR(255),
+    surname             VARCHAR(255),
+    job_title           VARCHAR(255),
+    mail                VARCHAR(255),
+    mobile_phone        VARCHAR(64),
+    office_location     VARCHAR(255),
+    preferred_language  VARCHAR(32),
+    user_principal_name VARCHAR(255),
+    business_phones     JSONB,
+    is_admin            BOOLEAN      NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS items (
+    id          INTEGER       GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name        VARCHAR(255)  NOT NULL,
+    description TEXT          NOT NULL,
+    price       NUMERIC(10,2) NOT NULL,
+    stock       INTEGER       NOT NULL DEFAULT 0,
+    image_url   VARCHAR(512)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id         BIGINT      GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id    VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user ON orders (user_id);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id BIGINT  NOT NULL,
+    item_id  INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    PRIMARY KEY (order_id, item_id),
+    FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items (id)
+);
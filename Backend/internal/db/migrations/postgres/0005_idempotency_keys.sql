@@ -0,0 +1,14 @@
+-- Idempotency-Key support for POST /orders. A key is scoped to the user
+-- who sent it and remembers a hash of the request and the response that
+-- was sent, so a retry gets the same answer instead of a second order.
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id         VARCHAR(64)  NOT NULL,
+    idem_key        VARCHAR(255) NOT NULL,
+    request_hash    CHAR(64)     NOT NULL,
+    response_status INTEGER      NOT NULL,
+    response_body   TEXT         NOT NULL,
+    created_at      TIMESTAMPTZ  NOT NULL,
+    expires_at      TIMESTAMPTZ  NOT NULL,
+    PRIMARY KEY (user_id, idem_key)
+);
@@ -0,0 +1,11 @@
+-- Orders are paid through a payment gateway. payment_status follows the
+-- payment: authorized when the order is placed, then captured or voided.
+-- Orders placed before payments existed keep the status 'none'. amount is
+-- in minor units (cents) of currency.
+
+ALTER TABLE orders ADD COLUMN payment_status VARCHAR(16) NOT NULL DEFAULT 'none';
+ALTER TABLE orders ADD COLUMN payment_id VARCHAR(128);
+ALTER TABLE orders ADD COLUMN amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN currency VARCHAR(3) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_orders_payment ON orders (payment_id);
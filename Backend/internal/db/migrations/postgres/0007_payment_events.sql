@@ -0,0 +1,18 @@
+-- Payment webhooks. Every verified event is kept, keyed by the provider's
+-- event ID, so a redelivered event is recognised and applied only once;
+-- the raw payload is kept so events can be replayed for testing.
+-- orders.refunded is the amount refunded so far, in cents.
+
+ALTER TABLE orders ADD COLUMN refunded BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS payment_events (
+    id          VARCHAR(128) NOT NULL PRIMARY KEY,
+    type        VARCHAR(64)  NOT NULL,
+    payment_id  VARCHAR(128) NOT NULL,
+    payload     TEXT         NOT NULL,
+    received_at TIMESTAMPTZ  NOT NULL,
+    order_id    BIGINT,
+    outcome     VARCHAR(32)  NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_events_received ON payment_events (received_at);
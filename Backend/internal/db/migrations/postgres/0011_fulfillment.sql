@@ -0,0 +1,40 @@
+-- Fulfillment: how an order reaches the customer. A fulfillment option is
+-- a pickup location (method pickup, with an address) or a delivery zone
+-- (method delivery, serving postal codes starting with postal_prefix),
+-- belonging to a vendor or, with vendor_id NULL, to the store, with a fee
+-- in cents. Each option has time slots holding up to capacity orders;
+-- booked is bumped with a conditional UPDATE in the transaction that
+-- takes the order's stock, so a full slot fails the order as a whole.
+-- orders.amount now also includes fulfillment_fee.
+
+CREATE TABLE IF NOT EXISTS fulfillment_options (
+    id            BIGINT       GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    vendor_id     BIGINT      ,
+    method        VARCHAR(16)  NOT NULL,
+    name          VARCHAR(255) NOT NULL,
+    address       VARCHAR(255) NOT NULL DEFAULT '',
+    postal_prefix VARCHAR(16)  NOT NULL DEFAULT '',
+    fee           BIGINT       NOT NULL DEFAULT 0,
+    active        BOOLEAN      NOT NULL,
+    created_at    TIMESTAMPTZ  NOT NULL,
+    FOREIGN KEY (vendor_id) REFERENCES vendors (id)
+);
+
+CREATE TABLE IF NOT EXISTS fulfillment_slots (
+    id        BIGINT       GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    option_id BIGINT       NOT NULL,
+    starts_at TIMESTAMPTZ  NOT NULL,
+    ends_at   TIMESTAMPTZ  NOT NULL,
+    capacity  INTEGER      NOT NULL,
+    booked    INTEGER      NOT NULL DEFAULT 0,
+    FOREIGN KEY (option_id) REFERENCES fulfillment_options (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_fulfillment_slots_starts ON fulfillment_slots (starts_at);
+
+ALTER TABLE orders ADD COLUMN slot_id BIGINT REFERENCES fulfillment_slots (id);
+ALTER TABLE orders ADD COLUMN fulfillment_method VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN fulfillment_fee BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN delivery_address VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_orders_slot ON orders (slot_id);
@@ -0,0 +1,44 @@
+-- Baseline schema, SQLite flavour of mysql/0001_init.sql. SQLite has no
+-- JSON or DECIMAL column types (TEXT and NUMERIC stand in) and declares
+-- indexes outside CREATE TABLE.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                  VARCHAR(64)  NOT NULL PRIMARY KEY,
+    display_name        VARCHAR(255),
+    given_name          VARCHAR(255),
+    surname             VARCHAR(255),
+    job_title           VARCHAR(255),
+    mail                VARCHAR(255),
+    mobile_phone        VARCHAR(64),
+    office_location     VARCHAR(255),
+    preferred_language  VARCHAR(32),
+    user_principal_name VARCHAR(255),
+    business_phones     TEXT,
+    is_admin            BOOLEAN      NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS items (
+    id          INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    name        VARCHAR(255) NOT NULL,
+    description TEXT         NOT NULL,
+    price       NUMERIC      NOT NULL,
+    stock       INTEGER      NOT NULL DEFAULT 0,
+    image_url   VARCHAR(512)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id         INTEGER     NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id    VARCHAR(64) NOT NULL,
+    created_at DATETIME    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user ON orders (user_id);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id INTEGER NOT NULL,
+    item_id  INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    PRIMARY KEY (order_id, item_id),
+    FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE,
+    FOREIGN KEY (item_id) REFERENCES items (id)
+);
@@ -0,0 +1,8 @@
+-- Images now live in a pluggable blob store. items.image_key holds the
+-- store key; the public URL is worked out per request, since signed URLs
+-- expire. image_url is kept for rollbacks but no longer written.
+
+ALTER TABLE items ADD COLUMN image_key VARCHAR(512);
+
+UPDATE items SET image_key = SUBSTR(image_url, 10)
+WHERE image_url LIKE '/uploads/%';
@@ -0,0 +1,22 @@
+-- A gallery per item. sort_order sets the display order and exactly one
+-- image per item is primary (kept so by the data‑access functions); the
+-- primary image is what image_url reports. Existing single images become
+-- each item's primary gallery image.
+
+CREATE TABLE IF NOT EXISTS item_images (
+    id         INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    item_id    INTEGER      NOT NULL,
+    image_key  VARCHAR(512) NOT NULL,
+    alt_text   VARCHAR(255) NOT NULL DEFAULT '',
+    sort_order INTEGER      NOT NULL DEFAULT 0,
+    is_primary BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at DATETIME     NOT NULL,
+    FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_item_images_item ON item_images (item_id, sort_order);
+
+INSERT INTO item_images (item_id, image_key, alt_text, sort_order, is_primary, created_at)
+SELECT id, image_key, '', 0, TRUE, CURRENT_TIMESTAMP
+FROM items
+WHERE image_key IS NOT NULL;
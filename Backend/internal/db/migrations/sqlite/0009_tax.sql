@@ -0,0 +1,38 @@
+-- Sales tax. Items belong to a vendor and a tax category; tax_rates holds
+-- the rate (in basis points) for a category in a jurisdiction, which is a
+-- postal-code prefix, optionally for one vendor only (vendor_id 0 is every
+-- vendor). Orders are taxed by their postal code when placed, and each
+-- line keeps the vendor, category, jurisdiction, rate and tax it was
+-- placed with, so later changes to rates don't rewrite history.
+-- orders.amount stays the total charged: subtotal plus tax.
+
+CREATE TABLE IF NOT EXISTS vendors (
+    id         INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    name       VARCHAR(255) NOT NULL UNIQUE,
+    created_at DATETIME     NOT NULL
+);
+
+ALTER TABLE items ADD COLUMN vendor_id BIGINT REFERENCES vendors (id);
+ALTER TABLE items ADD COLUMN tax_category VARCHAR(32) NOT NULL DEFAULT 'general';
+
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id           INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    jurisdiction VARCHAR(16)  NOT NULL,
+    category     VARCHAR(32)  NOT NULL,
+    vendor_id    BIGINT       NOT NULL DEFAULT 0,
+    basis_points INTEGER      NOT NULL,
+    rounding     VARCHAR(16)  NOT NULL DEFAULT 'half_up',
+    UNIQUE (jurisdiction, category, vendor_id)
+);
+
+ALTER TABLE orders ADD COLUMN postal_code VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN subtotal BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN tax BIGINT NOT NULL DEFAULT 0;
+
+UPDATE orders SET subtotal = (SELECT COALESCE(SUM(unit_price * quantity), 0) FROM order_items WHERE order_items.order_id = orders.id);
+
+ALTER TABLE order_items ADD COLUMN vendor_id BIGINT;
+ALTER TABLE order_items ADD COLUMN tax_category VARCHAR(32) NOT NULL DEFAULT 'general';
+ALTER TABLE order_items ADD COLUMN tax_jurisdiction VARCHAR(16);
+ALTER TABLE order_items ADD COLUMN tax_rate INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN tax BIGINT NOT NULL DEFAULT 0;
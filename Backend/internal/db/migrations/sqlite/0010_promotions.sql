@@ -0,0 +1,43 @@
+-- Promotions: discounts applied automatically (code NULL) or with a promo
+-- code. kind is percent (value in basis points), fixed (value in cents)
+-- or buy_x_get_y; zero conditions mean none. uses counts redemptions and
+-- is bumped with a conditional UPDATE when an order is placed, so
+-- max_uses holds under concurrency; promotion_redemptions records which
+-- orders used which promotion, for max_uses_per_user. Each order line
+-- keeps its share of the discount, and tax is charged on what is left.
+
+CREATE TABLE IF NOT EXISTS promotions (
+    id                INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    code              VARCHAR(64)  UNIQUE,
+    name              VARCHAR(255) NOT NULL,
+    kind              VARCHAR(16)  NOT NULL,
+    value             BIGINT       NOT NULL DEFAULT 0,
+    buy_quantity      INTEGER      NOT NULL DEFAULT 0,
+    get_quantity      INTEGER      NOT NULL DEFAULT 0,
+    min_order         BIGINT       NOT NULL DEFAULT 0,
+    vendor_id         BIGINT       NOT NULL DEFAULT 0,
+    item_id           INTEGER      NOT NULL DEFAULT 0,
+    starts_at         DATETIME    ,
+    ends_at           DATETIME    ,
+    max_uses          INTEGER      NOT NULL DEFAULT 0,
+    max_uses_per_user INTEGER      NOT NULL DEFAULT 0,
+    uses              INTEGER      NOT NULL DEFAULT 0,
+    active            BOOLEAN      NOT NULL,
+    created_at        DATETIME     NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    promotion_id INTEGER     NOT NULL,
+    order_id     BIGINT      NOT NULL,
+    user_id      VARCHAR(64) NOT NULL,
+    amount       BIGINT      NOT NULL,
+    PRIMARY KEY (promotion_id, order_id),
+    FOREIGN KEY (promotion_id) REFERENCES promotions (id),
+    FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotion_redemptions_user ON promotion_redemptions (promotion_id, user_id);
+
+ALTER TABLE orders ADD COLUMN discount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN promo_code VARCHAR(64);
+ALTER TABLE order_items ADD COLUMN discount BIGINT NOT NULL DEFAULT 0;
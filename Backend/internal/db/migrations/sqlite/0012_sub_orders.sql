@@ -0,0 +1,31 @@
+-- Sub-orders: an order is split into one sub-order per vendor (vendor_id
+-- NULL for the store's own items), each with its own status, so each
+-- vendor fulfils only its own lines. A line belongs to the sub-order of
+-- its order and vendor. subtotal, discount and tax are the sums over the
+-- sub-order's lines; the fulfillment fee stays on the order. Orders
+-- placed before this are split as they stand, as pending. users.vendor_id
+-- makes a user one of a vendor's staff.
+
+CREATE TABLE IF NOT EXISTS sub_orders (
+    id         INTEGER      NOT NULL PRIMARY KEY AUTOINCREMENT,
+    order_id   BIGINT       NOT NULL,
+    vendor_id  BIGINT      ,
+    status     VARCHAR(16)  NOT NULL,
+    subtotal   BIGINT       NOT NULL,
+    discount   BIGINT       NOT NULL,
+    tax        BIGINT       NOT NULL,
+    updated_at DATETIME     NOT NULL,
+    UNIQUE (order_id, vendor_id),
+    FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE,
+    FOREIGN KEY (vendor_id) REFERENCES vendors (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sub_orders_vendor ON sub_orders (vendor_id, status);
+
+INSERT INTO sub_orders (order_id, vendor_id, status, subtotal, discount, tax, updated_at)
+SELECT oi.order_id, oi.vendor_id, 'pending', SUM(oi.unit_price * oi.quantity), SUM(oi.discount), SUM(oi.tax), MAX(o.created_at)
+FROM order_items oi
+JOIN orders o ON o.id = oi.order_id
+GROUP BY oi.order_id, oi.vendor_id;
+
+ALTER TABLE users ADD COLUMN vendor_id BIGINT REFERENCES vendors (id);
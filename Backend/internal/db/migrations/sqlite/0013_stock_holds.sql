@@ -0,0 +1,21 @@
+-- Stock holds: stock set aside for a checkout for a while, so it can't
+-- sell out from under the customer while they pay. holder is the cart
+-- ("cart:<id>") or signed-in user ("user:<id>") the hold is for. An item's
+-- available stock is its stock less the holds on it that haven't expired;
+-- expired holds are ignored at once and deleted by a background reaper.
+-- Placing the holder's order turns its holds into stock deductions.
+-- renewals counts how often the holder renewed its holds without a break,
+-- so anonymous carts can be stopped from holding stock indefinitely.
+
+CREATE TABLE IF NOT EXISTS stock_holds (
+    holder     VARCHAR(80) NOT NULL,
+    item_id    INTEGER     NOT NULL,
+    quantity   INTEGER     NOT NULL,
+    expires_at DATETIME    NOT NULL,
+    renewals   INTEGER     NOT NULL DEFAULT 0,
+    PRIMARY KEY (holder, item_id),
+    FOREIGN KEY (item_id) REFERENCES items (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_holds_item ON stock_holds (item_id, expires_at);
+CREATE INDEX IF NOT EXISTS idx_stock_holds_expires ON stock_holds (expires_at);
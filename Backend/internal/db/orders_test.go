@@ -0,0 +1,364 @@
+// internal/db/orders_test.go
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPlaceOrder(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	farm, err := AddVendor(ctx, d, "Farm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eggs := addTestItem(t, d, "eggs", 4, 10, farm.ID)
+	mug := addTestItem(t, d, "mug", 9, 5, 0)
+
+	orderID, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: 3, mug: 1}}, Payment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stockOf(t, d, eggs); got != 7 {
+		t.Errorf("eggs stock %d, want 7", got)
+	}
+	if got := stockOf(t, d, mug); got != 4 {
+		t.Errorf("mug stock %d, want 4", got)
+	}
+	o, lines, err := GetOrderByID(ctx, d, orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.UserID != "u1" || o.Subtotal != 3*400+900 || len(lines) != 2 {
+		t.Errorf("order %+v with %d lines", o, len(lines))
+	}
+
+	// one sub-order per vendor, the store's own included
+	subs, err := GetSubOrders(ctx, d, orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("%d sub-orders, want 2", len(subs))
+	}
+	if status := OrderStatus(subs); status != SubOrderPending {
+		t.Errorf("status %s, want pending", status)
+	}
+}
+
+func TestPlaceOrderInsufficientStock(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 2, 0)
+	mug := addTestItem(t, d, "mug", 9, 5, 0)
+
+	_, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{mug: 1, eggs: 3}}, Payment{})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("err %v, want ErrInsufficientStock", err)
+	}
+	if n := count(t, d, "orders", "1 = 1"); n != 0 {
+		t.Errorf("%d orders left behind", n)
+	}
+	if got := stockOf(t, d, mug); got != 5 {
+		t.Errorf("mug stock %d, want 5", got)
+	}
+}
+
+func TestCheckoutCart(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0)
+
+	cartID, err := UserCart(ctx, d, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCartItem(ctx, d, cartID, eggs, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCartItem(ctx, d, cartID, eggs, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCartItem(ctx, d, cartID, eggs, 11, false); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("11 eggs: %v, want ErrInsufficientStock", err)
+	}
+	if _, err := CheckoutCart(ctx, d, cartID, NewOrder{UserID: "u1"}, Payment{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stockOf(t, d, eggs); got != 7 {
+		t.Errorf("eggs stock %d, want 7", got)
+	}
+	lines, err := GetCart(ctx, d, cartID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("cart not emptied: %+v", lines)
+	}
+	if _, err := CheckoutCart(ctx, d, cartID, NewOrder{UserID: "u1"}, Payment{}); !errors.Is(err, ErrEmptyCart) {
+		t.Errorf("second checkout: %v, want ErrEmptyCart", err)
+	}
+}
+
+func TestStockHolds(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	pie := addTestItem(t, d, "pie", 5, 20, 0)
+	a, b := UserHolder("a"), UserHolder("b")
+
+	if _, err := HoldStock(ctx, d, a, map[int]int{pie: 15}, time.Minute, 0); err != nil {
+		t.Fatal(err)
+	}
+	it, err := GetItem(ctx, d, pie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.Stock != 20 || it.Available != 5 {
+		t.Errorf("stock %d available %d, want 20 and 5", it.Stock, it.Available)
+	}
+
+	// others can't have what a holds, with or without a hold of their own
+	if _, err := HoldStock(ctx, d, b, map[int]int{pie: 6}, time.Minute, 0); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("hold 6 of 5 available: %v", err)
+	}
+	if _, err := PlaceOrder(ctx, d, NewOrder{UserID: "b", Items: map[int]int{pie: 6}, Holder: b}, Payment{}); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("order 6 of 5 available: %v", err)
+	}
+
+	// a's order uses a's hold
+	if _, err := PlaceOrder(ctx, d, NewOrder{UserID: "a", Items: map[int]int{pie: 15}, Holder: a}, Payment{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stockOf(t, d, pie); got != 5 {
+		t.Errorf("stock %d, want 5", got)
+	}
+	if n := count(t, d, "stock_holds", "holder = ?", a); n != 0 {
+		t.Errorf("%d holds left after the order", n)
+	}
+
+	// an expired hold no longer counts, and the reaper deletes it
+	if _, err := HoldStock(ctx, d, b, map[int]int{pie: 5}, -time.Second, 0); err != nil {
+		t.Fatal(err)
+	}
+	if it, _ := GetItem(ctx, d, pie); it.Available != 5 {
+		t.Errorf("available %d with an expired hold, want 5", it.Available)
+	}
+	n, err := ReleaseExpiredHolds(ctx, d)
+	if err != nil || n != 1 {
+		t.Errorf("released %d, %v; want 1", n, err)
+	}
+}
+
+func TestHoldRenewals(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	pie := addTestItem(t, d, "pie", 5, 20, 0)
+	a := CartHolder(1)
+
+	for i := range 3 { // the first hold and two renewals
+		if _, err := HoldStock(ctx, d, a, map[int]int{pie: 2}, time.Minute, 2); err != nil {
+			t.Fatalf("hold %d: %v", i+1, err)
+		}
+	}
+	if _, err := HoldStock(ctx, d, a, map[int]int{pie: 2}, time.Minute, 2); !errors.Is(err, ErrHoldLimit) {
+		t.Errorf("third renewal: %v, want ErrHoldLimit", err)
+	}
+	if holds, err := GetHolds(ctx, d, a); err != nil || len(holds) != 1 || holds[0].Quantity != 2 {
+		t.Errorf("holds after a refused renewal: %+v, %v", holds, err)
+	}
+
+	// once the holds are gone the count starts again
+	if err := ReleaseHolds(ctx, d, a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HoldStock(ctx, d, a, map[int]int{pie: 2}, time.Minute, 2); err != nil {
+		t.Errorf("hold after a release: %v", err)
+	}
+}
+
+// TestMergeCartsMovesHolds signs in with a held anonymous cart: what it
+// held stays held, now for the user's cart.
+func TestMergeCartsMovesHolds(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 6, 0)
+	mug := addTestItem(t, d, "mug", 9, 5, 0)
+
+	anonID, err := TokenCart(ctx, d, "t1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, err := UserCart(ctx, d, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []struct {
+		cartID   int64
+		itemID   int
+		quantity int
+	}{{anonID, eggs, 4}, {anonID, mug, 2}, {userID, eggs, 2}} {
+		if err := SetCartItem(ctx, d, l.cartID, l.itemID, l.quantity, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := HoldStock(ctx, d, CartHolder(anonID), map[int]int{eggs: 4, mug: 2}, time.Minute, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HoldStock(ctx, d, CartHolder(userID), map[int]int{eggs: 2}, time.Hour, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MergeCarts(ctx, d, anonID, userID); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := GetCart(ctx, d, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{eggs: 6, mug: 2}
+	if len(lines) != 2 || lines[0].Quantity != want[lines[0].ItemID] || lines[1].Quantity != want[lines[1].ItemID] {
+		t.Errorf("merged cart %+v, want %v", lines, want)
+	}
+	holds, err := GetHolds(ctx, d, CartHolder(userID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holds) != 2 || holds[0].Quantity != want[holds[0].ItemID] || holds[1].Quantity != want[holds[1].ItemID] {
+		t.Errorf("merged holds %+v, want %v", holds, want)
+	}
+	if n := count(t, d, "stock_holds", "holder = ?", CartHolder(anonID)); n != 0 {
+		t.Errorf("%d holds left on the anonymous cart", n)
+	}
+	if it, _ := GetItem(ctx, d, eggs); it.Available != 0 {
+		t.Errorf("eggs available %d, want 0", it.Available)
+	}
+
+	// the held stock is the user's to check out
+	if _, err := CheckoutCart(ctx, d, userID, NewOrder{UserID: "u1"}, Payment{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stockOf(t, d, eggs); got != 0 {
+		t.Errorf("eggs stock %d, want 0", got)
+	}
+	if n := count(t, d, "stock_holds", "1 = 1"); n != 0 {
+		t.Errorf("%d holds left after checkout", n)
+	}
+}
+
+func TestDeleteOrder(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	farm, err := AddVendor(ctx, d, "Farm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eggs := addTestItem(t, d, "eggs", 4, 10, farm.ID)
+
+	pending, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: 1}}, Payment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteOrder(ctx, d, pending); err != nil {
+		t.Errorf("delete pending order: %v", err)
+	}
+	if n := count(t, d, "sub_orders", "order_id = ?", pending); n != 0 {
+		t.Errorf("%d sub-orders left", n)
+	}
+
+	// once the vendor has accepted it, it stays
+	accepted, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: 1}}, Payment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs, err := GetSubOrders(ctx, d, accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSubOrderStatus(ctx, d, subs[0].ID, SubOrderAccepted); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteOrder(ctx, d, accepted); !errors.Is(err, ErrConflict) {
+		t.Errorf("delete accepted order: %v, want ErrConflict", err)
+	}
+	if n := count(t, d, "orders", "id = ?", accepted); n != 1 {
+		t.Error("accepted order was deleted")
+	}
+	if err := DeleteOrder(ctx, d, 9999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete unknown order: %v, want ErrNotFound", err)
+	}
+}
+
+func TestPickListSkipsCancelledSubOrders(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	farm, err := AddVendor(ctx, d, "Farm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eggs := addTestItem(t, d, "eggs", 4, 10, farm.ID)
+	mug := addTestItem(t, d, "mug", 9, 10, 0)
+
+	fo, err := AddFulfillmentOption(ctx, d, FulfillmentOption{Method: FulfillmentPickup, Name: "Barn", Address: "1 Lane", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Hour)
+	slot, err := AddSlot(ctx, d, Slot{OptionID: fo.ID, StartsAt: start, EndsAt: start.Add(time.Hour), Capacity: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderID, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: 2, mug: 1}, SlotID: slot.ID}, Payment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs, err := GetSubOrders(ctx, d, orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, so := range subs {
+		if so.VendorID == farm.ID {
+			if err := SetSubOrderStatus(ctx, d, so.ID, SubOrderCancelled); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	list, err := PickList(ctx, d, start, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("%d slots, want 1", len(list))
+	}
+	items := list[0].Items
+	if len(items) != 1 || items[0].ItemID != mug || items[0].Quantity != 1 {
+		t.Errorf("pick items %+v, want just the mug", items)
+	}
+}
+
+// TestPlaceOrderCanceled cancels the context halfway through the order
+// transaction, after the order row is written: nothing of it may remain.
+func TestPlaceOrderCanceled(t *testing.T) {
+	d := openTestDB(t)
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.afterOrderInsert = func(context.Context) { cancel() }
+
+	_, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: 3}}, Payment{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err %v, want context.Canceled", err)
+	}
+	for _, table := range []string{"orders", "order_items", "sub_orders"} {
+		if n := count(t, d, table, "1 = 1"); n != 0 {
+			t.Errorf("%d rows left in %s", n, table)
+		}
+	}
+	if got := stockOf(t, d, eggs); got != 10 {
+		t.Errorf("stock %d, want 10", got)
+	}
+}
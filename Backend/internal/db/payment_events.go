@@ -0,0 +1,163 @@
+// internal/db/payment_events.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"nexus.local/internal/payments"
+)
+
+// Outcomes of a payment event, as stored with it.
+const (
+	EventApplied        = "applied"         // the order was updated
+	EventIgnored        = "ignored"         // nothing to change, e.g. an old capture
+	EventUnknownPayment = "unknown_payment" // no order has this payment
+)
+
+// PaymentEvent is a verified webhook event as stored.
+type PaymentEvent struct {
+	payments.Event
+	Payload    []byte // the body exactly as received
+	ReceivedAt time.Time
+	OrderID    int64 // 0 if no order matched
+	Outcome    string
+}
+
+// errDuplicateEvent aborts the event transaction for a redelivery.
+var errDuplicateEvent = errors.New("duplicate payment event")
+
+// ApplyPaymentEvent records ev and applies it to the order with its
+// payment, in one transaction, so an event is applied exactly once however
+// often it is delivered. duplicate reports an event that was already
+// recorded, in which case nothing changes.
+//
+// Transitions never go backwards, whatever order events arrive in: a
+// capture only moves an authorized order, and the refunded amount only
+// grows.
+func ApplyPaymentEvent(ctx context.Context, db *DB, ev payments.Event, payload []byte) (_ PaymentEvent, duplicate bool, err error) {
+	ctx, end := db.startOp(ctx, "ApplyPaymentEvent")
+	defer end(&err)
+
+	rec := PaymentEvent{Event: ev, Payload: payload, ReceivedAt: time.Now().UTC()}
+	err = db.inTx(ctx, nil, func(tx *dbTx) error {
+		// 1) record the event; its ID is the primary key
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO payment_events (id, type, payment_id, payload, received_at) VALUES (?, ?, ?, ?, ?)",
+			ev.ID, ev.Type, ev.PaymentID, string(payload), rec.ReceivedAt,
+		); err != nil {
+			if db.dialect.constraint(err) {
+				return errDuplicateEvent
+			}
+			return err
+		}
+
+		// 2) lock the order and work out its new payment state
+		var o Order
+		err := tx.QueryRowContext(ctx,
+			"SELECT id, payment_status, amount, refunded FROM orders WHERE payment_id = ?"+db.dialect.forUpdate,
+			ev.PaymentID,
+		).Scan(&o.ID, &o.PaymentStatus, &o.Amount, &o.Refunded)
+		switch {
+		case err == sql.ErrNoRows:
+			rec.Outcome = EventUnknownPayment
+		case err != nil:
+			return err
+		default:
+			rec.OrderID = o.ID
+			rec.Outcome = EventIgnored
+			if status, refunded, ok := nextPaymentState(o, ev); ok {
+				if _, err := tx.ExecContext(ctx,
+					"UPDATE orders SET payment_status = ?, refunded = ? WHERE id = ?",
+					status, refunded, o.ID,
+				); err != nil {
+					return err
+				}
+				rec.Outcome = EventApplied
+			}
+		}
+
+		// 3) note what came of it
+		_, err = tx.ExecContext(ctx,
+			"UPDATE payment_events SET order_id = ?, outcome = ? WHERE id = ?",
+			sql.NullInt64{Int64: rec.OrderID, Valid: rec.OrderID != 0}, rec.Outcome, ev.ID,
+		)
+		return err
+	})
+	if errors.Is(err, errDuplicateEvent) {
+		return rec, true, nil
+	}
+	return rec, false, err
+}
+
+// nextPaymentState is the order's payment status and refunded amount
+// after ev, or ok false if ev changes nothing.
+func nextPaymentState(o Order, ev payments.Event) (status string, refunded int64, ok bool) {
+	switch ev.Type {
+	case payments.EventCaptured:
+		if o.PaymentStatus == PaymentAuthorized {
+			return PaymentCaptured, o.Refunded, true
+		}
+	case payments.EventVoided, payments.EventFailed:
+		if o.PaymentStatus == PaymentAuthorized {
+			return PaymentVoided, o.Refunded, true
+		}
+	case payments.EventRefunded:
+		// ev.Amount is the payment's refunded total, not this refund's
+		switch o.PaymentStatus {
+		case PaymentCaptured, PaymentPartiallyRefunded, PaymentRefunded:
+		default:
+			return "", 0, false
+		}
+		total := min(ev.Amount, o.Amount)
+		if total <= o.Refunded {
+			return "", 0, false
+		}
+		if total == o.Amount {
+			return PaymentRefunded, total, true
+		}
+		return PaymentPartiallyRefunded, total, true
+	}
+	return "", 0, false
+}
+
+// ListPaymentEvents returns the stored events received since since, oldest
+// first, or with id set just that one event.
+func ListPaymentEvents(ctx context.Context, db *DB, since time.Time, id string) (_ []PaymentEvent, err error) {
+	ctx, end := db.startOp(ctx, "ListPaymentEvents")
+	defer end(&err)
+	query := `
+        SELECT id, type, payment_id, payload, received_at, order_id, outcome
+        FROM payment_events`
+	args := []any{}
+	if id != "" {
+		query += " WHERE id = ?"
+		args = append(args, id)
+	} else {
+		query += " WHERE received_at >= ?"
+		args = append(args, since.UTC())
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY received_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []PaymentEvent
+	for rows.Next() {
+		var (
+			ev      PaymentEvent
+			payload string
+			orderID sql.NullInt64
+		)
+		if err := rows.Scan(&ev.ID, &ev.Type, &ev.PaymentID, &payload, &ev.ReceivedAt, &orderID, &ev.Outcome); err != nil {
+			return nil, err
+		}
+		ev.Payload = []byte(payload)
+		ev.OrderID = orderID.Int64
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,106 @@
+// internal/db/payment_events_test.go
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"nexus.local/internal/payments"
+)
+
+func TestNextPaymentState(t *testing.T) {
+	order := func(status string, refunded int64) Order {
+		return Order{PaymentStatus: status, Amount: 1000, Refunded: refunded}
+	}
+	tests := []struct {
+		name     string
+		order    Order
+		ev       payments.Event
+		status   string
+		refunded int64
+		ok       bool
+	}{
+		{"capture", order(PaymentAuthorized, 0), payments.Event{Type: payments.EventCaptured, Amount: 1000}, PaymentCaptured, 0, true},
+		{"capture after a void", order(PaymentVoided, 0), payments.Event{Type: payments.EventCaptured}, "", 0, false},
+		{"capture after a refund", order(PaymentPartiallyRefunded, 300), payments.Event{Type: payments.EventCaptured}, "", 0, false},
+		{"capture again", order(PaymentCaptured, 0), payments.Event{Type: payments.EventCaptured}, "", 0, false},
+		{"void", order(PaymentAuthorized, 0), payments.Event{Type: payments.EventVoided}, PaymentVoided, 0, true},
+		{"failure", order(PaymentAuthorized, 0), payments.Event{Type: payments.EventFailed}, PaymentVoided, 0, true},
+		{"void after capture", order(PaymentCaptured, 0), payments.Event{Type: payments.EventVoided}, "", 0, false},
+		{"refund before the capture", order(PaymentAuthorized, 0), payments.Event{Type: payments.EventRefunded, Amount: 300}, "", 0, false},
+		{"partial refund", order(PaymentCaptured, 0), payments.Event{Type: payments.EventRefunded, Amount: 300}, PaymentPartiallyRefunded, 300, true},
+		{"second refund, cumulative", order(PaymentPartiallyRefunded, 300), payments.Event{Type: payments.EventRefunded, Amount: 700}, PaymentPartiallyRefunded, 700, true},
+		{"refunds reach the total", order(PaymentPartiallyRefunded, 700), payments.Event{Type: payments.EventRefunded, Amount: 1000}, PaymentRefunded, 1000, true},
+		{"older refund arriving late", order(PaymentPartiallyRefunded, 700), payments.Event{Type: payments.EventRefunded, Amount: 300}, "", 0, false},
+		{"same refund again", order(PaymentPartiallyRefunded, 300), payments.Event{Type: payments.EventRefunded, Amount: 300}, "", 0, false},
+		{"more than was paid", order(PaymentCaptured, 0), payments.Event{Type: payments.EventRefunded, Amount: 5000}, PaymentRefunded, 1000, true},
+		{"unknown type", order(PaymentAuthorized, 0), payments.Event{Type: "payment.disputed"}, "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, refunded, ok := nextPaymentState(tt.order, tt.ev)
+			if status != tt.status || refunded != tt.refunded || ok != tt.ok {
+				t.Errorf("got %q %d %v, want %q %d %v", status, refunded, ok, tt.status, tt.refunded, tt.ok)
+			}
+		})
+	}
+}
+
+func TestApplyPaymentEvent(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0)
+	orderID, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: 2}}, Payment{ID: "pay_1", Amount: 800, Currency: "usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply := func(ev payments.Event) (PaymentEvent, bool) {
+		t.Helper()
+		payload, _ := json.Marshal(ev)
+		rec, duplicate, err := ApplyPaymentEvent(ctx, d, ev, payload)
+		if err != nil {
+			t.Fatalf("apply %s: %v", ev.ID, err)
+		}
+		return rec, duplicate
+	}
+	paymentOf := func() (string, int64) {
+		t.Helper()
+		o, _, err := GetOrderByID(ctx, d, orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o.PaymentStatus, o.Refunded
+	}
+
+	capture := payments.Event{ID: "evt_1", Type: payments.EventCaptured, PaymentID: "pay_1", Amount: 800}
+	if rec, dup := apply(capture); dup || rec.Outcome != EventApplied || rec.OrderID != orderID {
+		t.Errorf("capture: %+v duplicate %v", rec, dup)
+	}
+	refund := payments.Event{ID: "evt_2", Type: payments.EventRefunded, PaymentID: "pay_1", Amount: 300}
+	apply(refund)
+	if status, refunded := paymentOf(); status != PaymentPartiallyRefunded || refunded != 300 {
+		t.Fatalf("after the refund: %s, %d refunded", status, refunded)
+	}
+
+	// redeliveries change nothing
+	for _, ev := range []payments.Event{refund, capture} {
+		if _, dup := apply(ev); !dup {
+			t.Errorf("redelivered %s not reported as a duplicate", ev.ID)
+		}
+	}
+	if status, refunded := paymentOf(); status != PaymentPartiallyRefunded || refunded != 300 {
+		t.Errorf("after redeliveries: %s, %d refunded", status, refunded)
+	}
+	if n := count(t, d, "payment_events", "1 = 1"); n != 2 {
+		t.Errorf("%d events stored, want 2", n)
+	}
+
+	// a new event with a stale amount is kept but ignored
+	if rec, _ := apply(payments.Event{ID: "evt_3", Type: payments.EventRefunded, PaymentID: "pay_1", Amount: 100}); rec.Outcome != EventIgnored {
+		t.Errorf("stale refund: outcome %s, want ignored", rec.Outcome)
+	}
+	if rec, _ := apply(payments.Event{ID: "evt_4", Type: payments.EventCaptured, PaymentID: "pay_nope"}); rec.Outcome != EventUnknownPayment {
+		t.Errorf("unknown payment: outcome %s", rec.Outcome)
+	}
+}
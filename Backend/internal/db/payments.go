@@ -0,0 +1,57 @@
+// internal/db/payments.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Order payment statuses.
+const (
+	PaymentNone       = "none"       // placed before payments existed
+	PaymentAuthorized = "authorized" // money reserved, stock committed
+	PaymentCaptured   = "captured"   // money taken
+	PaymentVoided     = "voided"     // authorization released
+
+	PaymentPartiallyRefunded = "partially_refunded" // captured, some refunded
+	PaymentRefunded          = "refunded"           // captured, all refunded
+)
+
+// Payment is the authorization an order is placed with. An empty ID means
+// no payment (PaymentNone).
+type Payment struct {
+	ID       string
+	Amount   int64 // minor units
+	Currency string
+}
+
+func (p Payment) status() string {
+	if p.ID == "" {
+		return PaymentNone
+	}
+	return PaymentAuthorized
+}
+
+func (p Payment) nullID() sql.NullString {
+	return sql.NullString{String: p.ID, Valid: p.ID != ""}
+}
+
+// SetPaymentStatus moves an order's payment from one status to another.
+// It fails with ErrConflict if the payment isn't in status from (anymore),
+// so two concurrent transitions can't both win.
+func SetPaymentStatus(ctx context.Context, db *DB, orderID int64, from, to string) (err error) {
+	ctx, end := db.startOp(ctx, "SetPaymentStatus")
+	defer end(&err)
+	res, err := db.ExecContext(ctx,
+		"UPDATE orders SET payment_status = ? WHERE id = ? AND payment_status = ?",
+		to, orderID, from,
+	)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("order %d payment is not %s: %w", orderID, from, ErrConflict)
+	}
+	return nil
+}
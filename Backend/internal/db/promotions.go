@@ -0,0 +1,242 @@
+// internal/db/promotions.go
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"nexus.local/internal/promo"
+)
+
+// ErrPromotionUnavailable is returned for a promo code that doesn't exist,
+// has expired or been used up, or doesn't fit the order.
+var ErrPromotionUnavailable = errors.New("promotion unavailable")
+
+// AppliedPromotion is a promotion taken off a quoted order.
+type AppliedPromotion struct {
+	ID     int64  `json:"id"`
+	Code   string `json:"code,omitempty"`
+	Name   string `json:"name"`
+	Amount int64  `json:"amount"` // cents off
+
+	maxUsesPerUser int
+}
+
+// promoCode is the orders.promo_code of a quote: the code it was placed
+// with, if any.
+func (q Quote) promoCode() sql.NullString {
+	for _, ap := range q.Promotions {
+		if ap.Code != "" {
+			return sql.NullString{String: ap.Code, Valid: true}
+		}
+	}
+	return sql.NullString{}
+}
+
+// promotionColumns are the columns scanPromotion reads, in order.
+const promotionColumns = `id, code, name, kind, value, buy_quantity, get_quantity, min_order, vendor_id, item_id,
+        starts_at, ends_at, max_uses, max_uses_per_user, uses, active, created_at`
+
+func scanPromotion(row interface{ Scan(...any) error }, p *promo.Promotion) error {
+	var (
+		code         sql.NullString
+		starts, ends sql.NullTime
+	)
+	err := row.Scan(&p.ID, &code, &p.Name, &p.Kind, &p.Value, &p.BuyQuantity, &p.GetQuantity, &p.MinOrder,
+		&p.VendorID, &p.ItemID, &starts, &ends, &p.MaxUses, &p.MaxUsesPerUser, &p.Uses, &p.Active, &p.CreatedAt)
+	p.Code = code.String
+	if starts.Valid {
+		p.StartsAt = &starts.Time
+	}
+	if ends.Valid {
+		p.EndsAt = &ends.Time
+	}
+	return err
+}
+
+func queryPromotions(ctx context.Context, q querier, where string, args ...any) ([]promo.Promotion, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+promotionColumns+" FROM promotions WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	promos := []promo.Promotion{}
+	for rows.Next() {
+		var p promo.Promotion
+		if err := scanPromotion(rows, &p); err != nil {
+			return nil, err
+		}
+		promos = append(promos, p)
+	}
+	return promos, rows.Err()
+}
+
+// AddPromotion creates a promotion. A code already taken is ErrConflict.
+func AddPromotion(ctx context.Context, db *DB, p promo.Promotion) (_ promo.Promotion, err error) {
+	ctx, end := db.startOp(ctx, "AddPromotion")
+	defer end(&err)
+	p.Code = promo.NormalizeCode(p.Code)
+	p.Uses = 0
+	p.CreatedAt = time.Now().UTC()
+	var starts, ends sql.NullTime
+	if p.StartsAt != nil {
+		starts = sql.NullTime{Time: p.StartsAt.UTC(), Valid: true}
+	}
+	if p.EndsAt != nil {
+		ends = sql.NullTime{Time: p.EndsAt.UTC(), Valid: true}
+	}
+	p.ID, err = db.insertID(ctx, db, `
+        INSERT INTO promotions (code, name, kind, value, buy_quantity, get_quantity, min_order, vendor_id, item_id,
+                                starts_at, ends_at, max_uses, max_uses_per_user, active, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sql.NullString{String: p.Code, Valid: p.Code != ""}, p.Name, p.Kind, p.Value, p.BuyQuantity, p.GetQuantity,
+		p.MinOrder, p.VendorID, p.ItemID, starts, ends, p.MaxUses, p.MaxUsesPerUser, p.Active, p.CreatedAt,
+	)
+	return p, err
+}
+
+// ListPromotions returns every promotion, active or not.
+func ListPromotions(ctx context.Context, db *DB) (_ []promo.Promotion, err error) {
+	ctx, end := db.startOp(ctx, "ListPromotions")
+	defer end(&err)
+	return queryPromotions(ctx, db, "1 = 1")
+}
+
+// SetPromotionActive switches a promotion on or off. Promotions are never
+// deleted, since orders refer to them.
+func SetPromotionActive(ctx context.Context, db *DB, promotionID int64, active bool) (err error) {
+	ctx, end := db.startOp(ctx, "SetPromotionActive")
+	defer end(&err)
+	res, err := db.ExecContext(ctx, "UPDATE promotions SET active = ? WHERE id = ?", active, promotionID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("promotion %d: %w", promotionID, ErrNotFound)
+	}
+	return nil
+}
+
+// applyPromotions takes every automatic promotion the order qualifies for
+// off quote's lines, then the order's promo code. Each works on what the
+// ones before it left. An automatic promotion that doesn't fit is skipped,
+// but a promo code that doesn't is ErrPromotionUnavailable.
+func applyPromotions(ctx context.Context, q querier, o NewOrder, quote *Quote) error {
+	code := promo.NormalizeCode(o.PromoCode)
+	promos, err := queryPromotions(ctx, q, "active = ? AND (code IS NULL OR code = ?)", true, code)
+	if err != nil {
+		return err
+	}
+	if code != "" && !slices.ContainsFunc(promos, func(p promo.Promotion) bool { return p.Code == code }) {
+		return fmt.Errorf("promo code %q: %w", code, ErrPromotionUnavailable)
+	}
+	slices.SortStableFunc(promos, func(a, b promo.Promotion) int {
+		return cmp.Compare(len(a.Code), len(b.Code)) // automatic ones first
+	})
+
+	lines := make([]promo.Line, len(quote.Lines))
+	for i, l := range quote.Lines {
+		lines[i] = promo.Line{ItemID: l.ItemID, VendorID: l.VendorID, Quantity: l.Quantity, UnitPrice: l.UnitPrice}
+	}
+	now := time.Now()
+	for _, p := range promos {
+		err := promotionAvailable(ctx, q, p, o.UserID, quote.Subtotal, now)
+		if err == nil {
+			if off := p.Apply(lines); off > 0 {
+				quote.Promotions = append(quote.Promotions, AppliedPromotion{
+					ID: p.ID, Code: p.Code, Name: p.Name, Amount: off, maxUsesPerUser: p.MaxUsesPerUser,
+				})
+				quote.Discount += off
+				continue
+			}
+			err = fmt.Errorf("promo code %q doesn't apply to this order: %w", p.Code, ErrPromotionUnavailable)
+		}
+		if p.Code != "" {
+			return err
+		}
+	}
+	for i := range quote.Lines {
+		quote.Lines[i].Discount = lines[i].Discount
+	}
+	return nil
+}
+
+// promotionAvailable checks p's conditions other than which lines it
+// covers. Per‑user limits are only checked for a known user; placing the
+// order checks both limits again, atomically.
+func promotionAvailable(ctx context.Context, q querier, p promo.Promotion, userID string, subtotal int64, now time.Time) error {
+	switch {
+	case !p.Live(now):
+		return fmt.Errorf("promotion %q is not running: %w", p.Name, ErrPromotionUnavailable)
+	case subtotal < p.MinOrder:
+		return fmt.Errorf("promotion %q needs an order of %d: %w", p.Name, p.MinOrder, ErrPromotionUnavailable)
+	case p.MaxUses > 0 && p.Uses >= p.MaxUses:
+		return fmt.Errorf("promotion %q is used up: %w", p.Name, ErrPromotionUnavailable)
+	}
+	if p.MaxUsesPerUser > 0 && userID != "" {
+		used, err := userRedemptions(ctx, q, p.ID, userID)
+		if err != nil {
+			return err
+		}
+		if used >= p.MaxUsesPerUser {
+			return fmt.Errorf("promotion %q already used %d times: %w", p.Name, used, ErrPromotionUnavailable)
+		}
+	}
+	return nil
+}
+
+func userRedemptions(ctx context.Context, q querier, promotionID int64, userID string) (int, error) {
+	rows, err := q.QueryContext(ctx,
+		"SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = ? AND user_id = ?", promotionID, userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var n int
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return 0, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// redeemPromotions counts an order's promotions against their limits. The
+// conditional UPDATE takes each promotion's row lock, so concurrent orders
+// count uses one at a time and the caps hold; the per‑user count is taken
+// under that lock for the same reason.
+func redeemPromotions(ctx context.Context, tx *dbTx, orderID int64, userID string, applied []AppliedPromotion) error {
+	for _, ap := range applied {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE promotions SET uses = uses + 1 WHERE id = ? AND (max_uses = 0 OR uses < max_uses)", ap.ID,
+		)
+		if err != nil {
+			return err
+		}
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return fmt.Errorf("promotion %q is used up: %w", ap.Name, ErrPromotionUnavailable)
+		}
+		if ap.maxUsesPerUser > 0 {
+			used, err := userRedemptions(ctx, tx, ap.ID, userID)
+			if err != nil {
+				return err
+			}
+			if used >= ap.maxUsesPerUser {
+				return fmt.Errorf("promotion %q already used %d times: %w", ap.Name, used, ErrPromotionUnavailable)
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO promotion_redemptions (promotion_id, order_id, user_id, amount) VALUES (?, ?, ?, ?)",
+			ap.ID, orderID, userID, ap.Amount,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// internal/db/promotions_test.go
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"nexus.local/internal/promo"
+)
+
+func addTestPromotion(t *testing.T, d *DB, p promo.Promotion) promo.Promotion {
+	t.Helper()
+	p.Active = true
+	p, err := AddPromotion(context.Background(), d, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPromotionConditions(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0) // 2 of them, 800
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	addTestPromotion(t, d, promo.Promotion{Code: "TENOFF", Name: "10% off", Kind: promo.Percent, Value: 1000})
+	addTestPromotion(t, d, promo.Promotion{Code: "BIG", Name: "for big orders", Kind: promo.Fixed, Value: 100, MinOrder: 1000})
+	addTestPromotion(t, d, promo.Promotion{Code: "SMALL", Name: "for any order", Kind: promo.Fixed, Value: 100, MinOrder: 800})
+	addTestPromotion(t, d, promo.Promotion{Code: "OVER", Name: "ended", Kind: promo.Fixed, Value: 100, EndsAt: &past})
+	addTestPromotion(t, d, promo.Promotion{Code: "SOON", Name: "not started", Kind: promo.Fixed, Value: 100, StartsAt: &future})
+	addTestPromotion(t, d, promo.Promotion{Code: "NOW", Name: "running", Kind: promo.Fixed, Value: 100, StartsAt: &past, EndsAt: &future})
+	addTestPromotion(t, d, promo.Promotion{Code: "MUGS", Name: "mugs only", Kind: promo.Percent, Value: 1000, ItemID: eggs + 1})
+	off := addTestPromotion(t, d, promo.Promotion{Code: "OFF", Name: "switched off", Kind: promo.Fixed, Value: 100})
+	if err := SetPromotionActive(ctx, d, off.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		code     string
+		discount int64
+		err      error
+	}{
+		{"", 0, nil},
+		{"tenoff ", 80, nil},
+		{"BIG", 0, ErrPromotionUnavailable},
+		{"SMALL", 100, nil},
+		{"OVER", 0, ErrPromotionUnavailable},
+		{"SOON", 0, ErrPromotionUnavailable},
+		{"NOW", 100, nil},
+		{"MUGS", 0, ErrPromotionUnavailable},
+		{"OFF", 0, ErrPromotionUnavailable},
+		{"NOPE", 0, ErrPromotionUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("code %q", tt.code), func(t *testing.T) {
+			q, err := QuoteOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: 2}, PromoCode: tt.code})
+			if !errors.Is(err, tt.err) || q.Discount != tt.discount {
+				t.Errorf("discount %d, %v; want %d, %v", q.Discount, err, tt.discount, tt.err)
+			}
+		})
+	}
+
+	// an automatic promotion the order doesn't qualify for is just skipped
+	addTestPromotion(t, d, promo.Promotion{Name: "automatic, big orders", Kind: promo.Fixed, Value: 50, MinOrder: 1000})
+	if q, err := QuoteOrder(ctx, d, NewOrder{Items: map[int]int{eggs: 2}}); err != nil || q.Discount != 0 {
+		t.Errorf("below the minimum: discount %d, %v", q.Discount, err)
+	}
+	if q, err := QuoteOrder(ctx, d, NewOrder{Items: map[int]int{eggs: 3}}); err != nil || q.Discount != 50 {
+		t.Errorf("above the minimum: discount %d, %v", q.Discount, err)
+	}
+}
+
+func TestPromotionCaps(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 100, 0)
+	p := addTestPromotion(t, d, promo.Promotion{Code: "TWICE", Name: "twice, once each", Kind: promo.Fixed, Value: 100,
+		MaxUses: 2, MaxUsesPerUser: 1})
+	place := func(userID string) error {
+		_, err := PlaceOrder(ctx, d, NewOrder{UserID: userID, Items: map[int]int{eggs: 1}, PromoCode: "TWICE"}, Payment{})
+		return err
+	}
+
+	if err := place("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := place("u1"); !errors.Is(err, ErrPromotionUnavailable) {
+		t.Errorf("second use by u1: %v, want ErrPromotionUnavailable", err)
+	}
+	if err := place("u2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := place("u3"); !errors.Is(err, ErrPromotionUnavailable) {
+		t.Errorf("third use: %v, want ErrPromotionUnavailable", err)
+	}
+	if n := count(t, d, "promotion_redemptions", "promotion_id = ?", p.ID); n != 2 {
+		t.Errorf("%d redemptions, want 2", n)
+	}
+	if n := count(t, d, "orders", "1 = 1"); n != 2 {
+		t.Errorf("%d orders, want 2", n)
+	}
+}
+
+// TestRedeemPromotionsCaps checks the caps hold for an order that was
+// quoted before the promotion ran out, i.e. at the conditional UPDATE.
+func TestRedeemPromotionsCaps(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 100, 0)
+	orders := make(map[string]int64) // an order of each user's to redeem for
+	for _, userID := range []string{"u1", "u2"} {
+		orderID, err := PlaceOrder(ctx, d, NewOrder{UserID: userID, Items: map[int]int{eggs: 1}}, Payment{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders[userID] = orderID
+	}
+	global := addTestPromotion(t, d, promo.Promotion{Code: "ONCE", Name: "once", Kind: promo.Fixed, Value: 100, MaxUses: 1})
+	perUser := addTestPromotion(t, d, promo.Promotion{Code: "MINE", Name: "once each", Kind: promo.Fixed, Value: 100, MaxUsesPerUser: 1})
+	redeem := func(userID string, p promo.Promotion) error {
+		return d.inTx(ctx, nil, func(tx *dbTx) error {
+			return redeemPromotions(ctx, tx, orders[userID], userID, []AppliedPromotion{
+				{ID: p.ID, Code: p.Code, Name: p.Name, Amount: 100, maxUsesPerUser: p.MaxUsesPerUser},
+			})
+		})
+	}
+
+	for _, p := range []promo.Promotion{global, perUser} {
+		if err := redeem("u1", p); err != nil {
+			t.Fatalf("%s: %v", p.Code, err)
+		}
+	}
+	if err := redeem("u2", global); !errors.Is(err, ErrPromotionUnavailable) {
+		t.Errorf("over the global cap: %v, want ErrPromotionUnavailable", err)
+	}
+	if err := redeem("u1", perUser); !errors.Is(err, ErrPromotionUnavailable) {
+		t.Errorf("over the per-user cap: %v, want ErrPromotionUnavailable", err)
+	}
+	if err := redeem("u2", perUser); err != nil {
+		t.Errorf("another user: %v", err)
+	}
+
+	// refused redemptions are rolled back, uses included
+	promos, err := ListPromotions(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uses := make(map[string]int)
+	for _, p := range promos {
+		uses[p.Code] = p.Uses
+	}
+	if uses["ONCE"] != 1 || uses["MINE"] != 2 {
+		t.Errorf("uses %v, want ONCE 1 and MINE 2", uses)
+	}
+	if n := count(t, d, "promotion_redemptions", "1 = 1"); n != 3 {
+		t.Errorf("%d redemptions, want 3", n)
+	}
+}
+
+// TestPromotionCapConcurrent places orders with a promo code at the same
+// time from many users: no more than MaxUses of them may get it.
+func TestPromotionCapConcurrent(t *testing.T) {
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 100, 0)
+	p := addTestPromotion(t, d, promo.Promotion{Code: "FIRST3", Name: "first three", Kind: promo.Fixed, Value: 100, MaxUses: 3})
+
+	const n = 8
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = PlaceOrder(ctx, d, NewOrder{UserID: fmt.Sprintf("u%d", i), Items: map[int]int{eggs: 1}, PromoCode: "FIRST3"}, Payment{})
+		}()
+	}
+	wg.Wait()
+
+	placed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			placed++
+		case !errors.Is(err, ErrPromotionUnavailable):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if placed != 3 {
+		t.Errorf("%d orders got the promotion, want 3", placed)
+	}
+	if n := count(t, d, "promotion_redemptions", "promotion_id = ?", p.ID); n != 3 {
+		t.Errorf("%d redemptions, want 3", n)
+	}
+	if got := stockOf(t, d, eggs); got != 97 {
+		t.Errorf("stock %d, want 97", got)
+	}
+}
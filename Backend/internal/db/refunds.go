@@ -0,0 +1,364 @@
+// internal/db/refunds.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Refund statuses. A refund is pending while the payment provider is asked
+// for the money; its quantities and amount already count against the
+// order, so a concurrent refund can't give back the same thing twice.
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed" // the provider refused; nothing was refunded
+)
+
+// ErrInvalidRefund is returned for a refund of items the order doesn't
+// have, or more of them than are left to refund.
+var ErrInvalidRefund = errors.New("invalid refund")
+
+// Refund is one entry in an order's refund ledger.
+type Refund struct {
+	ID              int64        `json:"id"`
+	OrderID         int64        `json:"order_id"`
+	Amount          int64        `json:"amount"` // cents
+	Restock         bool         `json:"restock"`
+	Reason          string       `json:"reason,omitempty"`
+	Status          string       `json:"status"`
+	GatewayRefundID string       `json:"gateway_refund_id,omitempty"`
+	CreatedBy       string       `json:"created_by"`
+	CreatedAt       time.Time    `json:"created_at"`
+	Items           []RefundItem `json:"items"`
+
+	// PaymentID is the order's payment, for the provider call.
+	PaymentID string `json:"-"`
+}
+
+// RefundItem is a quantity of one order line given back by a refund, and
+// what it was paid for it.
+type RefundItem struct {
+	ItemID   int   `json:"item_id"`
+	Quantity int   `json:"quantity"`
+	Amount   int64 `json:"amount"`
+}
+
+// RefundRequest describes a refund to make. An empty Items refunds
+// everything not refunded yet.
+type RefundRequest struct {
+	OrderID   int64
+	Items     map[int]int // item ID → quantity
+	Restock   bool
+	Reason    string
+	CreatedBy string
+}
+
+// refundedStatus is the payment status of a captured order of amount with
+// refunded of it given back.
+func refundedStatus(amount, refunded int64) string {
+	switch {
+	case refunded <= 0:
+		return PaymentCaptured
+	case refunded >= amount:
+		return PaymentRefunded
+	}
+	return PaymentPartiallyRefunded
+}
+
+// BeginRefund records a refund of an order and counts it against the
+// order's lines and net total, in one transaction. Lines are refunded at
+// the price they were sold at, less their share of the line's discount
+// and with their share of its tax, and never for more than is left of the
+// order's amount. The refund that takes the last units also gives back the
+// fulfillment fee.
+//
+// A refund of a paid order is returned pending: the caller asks the
+// payment provider for the money and then calls CompleteRefund or
+// FailRefund. An order with no payment has nothing to give back, so its
+// refund succeeds at once. It fails with ErrConflict if the order's
+// payment isn't captured, and ErrInvalidRefund if the request asks for
+// more than is left.
+func BeginRefund(ctx context.Context, db *DB, req RefundRequest) (_ Refund, err error) {
+	ctx, end := db.startOp(ctx, "BeginRefund")
+	defer end(&err)
+
+	rf := Refund{
+		OrderID:   req.OrderID,
+		Restock:   req.Restock,
+		Reason:    req.Reason,
+		CreatedBy: req.CreatedBy,
+		CreatedAt: time.Now().UTC(),
+		Items:     []RefundItem{},
+	}
+	err = db.inTx(ctx, orderTxOptions, func(tx *dbTx) error {
+		// 1) lock the order so refunds of it happen one at a time
+		var o Order
+		err := scanOrder(tx.QueryRowContext(ctx,
+			"SELECT "+orderColumns+" FROM orders WHERE id = ?"+db.dialect.forUpdate, req.OrderID,
+		), &o)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("order %d: %w", req.OrderID, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		switch o.PaymentStatus {
+		case PaymentNone, PaymentCaptured, PaymentPartiallyRefunded:
+		default:
+			return fmt.Errorf("order %d payment is %s: %w", o.ID, o.PaymentStatus, ErrConflict)
+		}
+		rf.PaymentID = o.PaymentID
+
+		// 2) work out what is refunded, line by line
+		lines, err := orderLines(ctx, tx, o.ID)
+		if err != nil {
+			return err
+		}
+		byItem := make(map[int]OrderItem, len(lines))
+		for _, l := range lines {
+			byItem[l.ItemID] = l
+		}
+		want := req.Items
+		if len(want) == 0 {
+			want = make(map[int]int, len(lines))
+			for _, l := range lines {
+				if left := l.Quantity - l.RefundedQuantity; left > 0 {
+					want[l.ItemID] = left
+				}
+			}
+			if len(want) == 0 {
+				return fmt.Errorf("order %d is already fully refunded: %w", o.ID, ErrInvalidRefund)
+			}
+		}
+		for _, l := range lines { // in line order, not map order
+			qty, ok := want[l.ItemID]
+			if !ok {
+				continue
+			}
+			if left := l.Quantity - l.RefundedQuantity; qty <= 0 || qty > left {
+				return fmt.Errorf("item %d: refund %d with %d left: %w", l.ItemID, qty, left, ErrInvalidRefund)
+			}
+			share := func(total int64) int64 {
+				return lineShare(total, l.Quantity, l.RefundedQuantity+qty) - lineShare(total, l.Quantity, l.RefundedQuantity)
+			}
+			amount := l.UnitPrice*int64(qty) - share(l.Discount) + share(l.Tax)
+			rf.Items = append(rf.Items, RefundItem{ItemID: l.ItemID, Quantity: qty, Amount: amount})
+			rf.Amount += amount
+		}
+		for itemID := range want {
+			if _, ok := byItem[itemID]; !ok {
+				return fmt.Errorf("item %d is not in order %d: %w", itemID, o.ID, ErrInvalidRefund)
+			}
+		}
+		rf.Amount = min(rf.Amount, o.Amount-o.Refunded)
+		if !slices.ContainsFunc(lines, func(l OrderItem) bool { return l.Quantity-l.RefundedQuantity > want[l.ItemID] }) {
+			// the last units out give back the rest, fulfillment fee included
+			rf.Amount = o.Amount - o.Refunded
+		}
+
+		// 3) write the ledger entry and count it against the order
+		rf.Status = RefundPending
+		if o.PaymentStatus == PaymentNone || rf.Amount == 0 {
+			rf.Status = RefundSucceeded
+		}
+		rf.ID, err = db.insertID(ctx, tx, `
+            INSERT INTO refunds (order_id, amount, restock, reason, status, created_by, created_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			rf.OrderID, rf.Amount, rf.Restock, rf.Reason, rf.Status, rf.CreatedBy, rf.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		for _, it := range rf.Items {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO refund_items (refund_id, item_id, quantity, amount) VALUES (?, ?, ?, ?)",
+				rf.ID, it.ItemID, it.Quantity, it.Amount,
+			); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE order_items SET refunded_quantity = refunded_quantity + ? WHERE order_id = ? AND item_id = ?",
+				it.Quantity, o.ID, it.ItemID,
+			); err != nil {
+				return err
+			}
+		}
+		if o.PaymentStatus != PaymentNone {
+			refunded := o.Refunded + rf.Amount
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE orders SET refunded = ?, payment_status = ? WHERE id = ?",
+				refunded, refundedStatus(o.Amount, refunded), o.ID,
+			); err != nil {
+				return err
+			}
+		}
+		if rf.Status == RefundSucceeded && rf.Restock {
+			return restock(ctx, tx, rf.Items)
+		}
+		return nil
+	})
+	if err != nil {
+		return Refund{}, err
+	}
+	return rf, nil
+}
+
+// CompleteRefund marks a pending refund as paid out by the provider, and
+// puts its items back in stock if it restocks.
+func CompleteRefund(ctx context.Context, db *DB, refundID int64, gatewayRefundID string) (err error) {
+	ctx, end := db.startOp(ctx, "CompleteRefund")
+	defer end(&err)
+	return db.inTx(ctx, nil, func(tx *dbTx) error {
+		rf, err := claimPendingRefund(ctx, tx, refundID, RefundSucceeded)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE refunds SET gateway_refund_id = ? WHERE id = ?", gatewayRefundID, refundID,
+		); err != nil {
+			return err
+		}
+		if rf.Restock {
+			return restock(ctx, tx, rf.Items)
+		}
+		return nil
+	})
+}
+
+// FailRefund marks a pending refund as failed and gives its quantities and
+// amount back to the order, so they can be refunded again.
+func FailRefund(ctx context.Context, db *DB, refundID int64) (err error) {
+	ctx, end := db.startOp(ctx, "FailRefund")
+	defer end(&err)
+	return db.inTx(ctx, nil, func(tx *dbTx) error {
+		rf, err := claimPendingRefund(ctx, tx, refundID, RefundFailed)
+		if err != nil {
+			return err
+		}
+		for _, it := range rf.Items {
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE order_items SET refunded_quantity = refunded_quantity - ? WHERE order_id = ? AND item_id = ?",
+				it.Quantity, rf.OrderID, it.ItemID,
+			); err != nil {
+				return err
+			}
+		}
+		var o Order
+		if err := tx.QueryRowContext(ctx,
+			"SELECT amount, refunded FROM orders WHERE id = ?"+db.dialect.forUpdate, rf.OrderID,
+		).Scan(&o.Amount, &o.Refunded); err != nil {
+			return err
+		}
+		refunded := max(o.Refunded-rf.Amount, 0)
+		_, err = tx.ExecContext(ctx,
+			"UPDATE orders SET refunded = ?, payment_status = ? WHERE id = ?",
+			refunded, refundedStatus(o.Amount, refunded), rf.OrderID,
+		)
+		return err
+	})
+}
+
+// claimPendingRefund moves a pending refund to status and returns it with
+// its items. It fails with ErrConflict if the refund isn't pending.
+func claimPendingRefund(ctx context.Context, tx *dbTx, refundID int64, status string) (Refund, error) {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE refunds SET status = ? WHERE id = ? AND status = ?", status, refundID, RefundPending,
+	)
+	if err != nil {
+		return Refund{}, err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return Refund{}, fmt.Errorf("refund %d is not pending: %w", refundID, ErrConflict)
+	}
+	refunds, err := queryRefunds(ctx, tx, "r.id = ?", refundID)
+	if err != nil {
+		return Refund{}, err
+	}
+	if len(refunds) == 0 {
+		return Refund{}, fmt.Errorf("refund %d: %w", refundID, ErrNotFound)
+	}
+	return refunds[0], nil
+}
+
+// GetRefund returns one refund with its items.
+func GetRefund(ctx context.Context, db *DB, refundID int64) (_ Refund, err error) {
+	ctx, end := db.startOp(ctx, "GetRefund")
+	defer end(&err)
+	refunds, err := queryRefunds(ctx, db, "r.id = ?", refundID)
+	if err != nil {
+		return Refund{}, err
+	}
+	if len(refunds) == 0 {
+		return Refund{}, fmt.Errorf("refund %d: %w", refundID, ErrNotFound)
+	}
+	return refunds[0], nil
+}
+
+// restock puts refunded items back in stock.
+func restock(ctx context.Context, tx *dbTx, items []RefundItem) error {
+	for _, it := range items {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE items SET stock = stock + ? WHERE id = ?", it.Quantity, it.ItemID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRefunds returns an order's refund ledger, oldest first.
+func GetRefunds(ctx context.Context, db *DB, orderID int64) (_ []Refund, err error) {
+	ctx, end := db.startOp(ctx, "GetRefunds")
+	defer end(&err)
+	return queryRefunds(ctx, db, "r.order_id = ?", orderID)
+}
+
+// queryRefunds returns the refunds matching where, with their items.
+func queryRefunds(ctx context.Context, q querier, where string, arg any) ([]Refund, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT r.id, r.order_id, r.amount, r.restock, r.reason, r.status, r.gateway_refund_id,
+               r.created_by, r.created_at, o.payment_id, ri.item_id, ri.quantity, ri.amount
+        FROM refunds r
+        JOIN orders o ON o.id = r.order_id
+        LEFT JOIN refund_items ri ON ri.refund_id = r.id
+        WHERE `+where+`
+        ORDER BY r.id, ri.item_id`,
+		arg,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds := []Refund{}
+	for rows.Next() {
+		var (
+			rf        Refund
+			gatewayID sql.NullString
+			paymentID sql.NullString
+			itemID    sql.NullInt64
+			qty       sql.NullInt64
+			amount    sql.NullInt64
+		)
+		if err := rows.Scan(&rf.ID, &rf.OrderID, &rf.Amount, &rf.Restock, &rf.Reason, &rf.Status, &gatewayID,
+			&rf.CreatedBy, &rf.CreatedAt, &paymentID, &itemID, &qty, &amount); err != nil {
+			return nil, err
+		}
+		if n := len(refunds); n == 0 || refunds[n-1].ID != rf.ID {
+			rf.GatewayRefundID = gatewayID.String
+			rf.PaymentID = paymentID.String
+			rf.Items = []RefundItem{}
+			refunds = append(refunds, rf)
+		}
+		if itemID.Valid {
+			last := &refunds[len(refunds)-1]
+			last.Items = append(last.Items, RefundItem{ItemID: int(itemID.Int64), Quantity: int(qty.Int64), Amount: amount.Int64})
+		}
+	}
+	return refunds, rows.Err()
+}
@@ -0,0 +1,216 @@
+// internal/db/refunds_test.go
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"nexus.local/internal/payments"
+	"nexus.local/internal/promo"
+	"nexus.local/internal/tax"
+)
+
+// refundFixture places a captured order of 3 eggs at 4.00 and a mug at
+// 9.00, with 10% off everything and 8.25% tax on what is left:
+//
+//	eggs  1200 - 120 discount + 89 tax (29, 30, 30 per unit)
+//	mug    900 -  90 discount + 67 tax
+//	total 2046
+func refundFixture(t *testing.T) (d *DB, orderID int64, eggs, mug int) {
+	t.Helper()
+	d = openTestDB(t)
+	ctx := context.Background()
+	eggs = addTestItem(t, d, "eggs", 4, 10, 0)
+	mug = addTestItem(t, d, "mug", 9, 10, 0)
+	if _, err := PutTaxRate(ctx, d, tax.Rate{Category: tax.DefaultCategory, BasisPoints: 825, Rounding: tax.HalfUp}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddPromotion(ctx, d, promo.Promotion{Name: "10% off", Kind: promo.Percent, Value: 1000, Active: true}); err != nil {
+		t.Fatal(err)
+	}
+	order := NewOrder{UserID: "u1", Items: map[int]int{eggs: 3, mug: 1}}
+	q, err := QuoteOrder(ctx, d, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Total != 2046 {
+		t.Fatalf("quote %+v, want a total of 2046", q)
+	}
+	orderID, err = PlaceOrder(ctx, d, order, Payment{ID: "pay_1", Amount: q.Total, Currency: "usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPaymentStatus(ctx, d, orderID, PaymentAuthorized, PaymentCaptured); err != nil {
+		t.Fatal(err)
+	}
+	return d, orderID, eggs, mug
+}
+
+// refundedOf returns the order's payment status, amount refunded and
+// refunded quantities by item.
+func refundedOf(t *testing.T, d *DB, orderID int64) (string, int64, map[int]int) {
+	t.Helper()
+	o, lines, err := GetOrderByID(context.Background(), d, orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qty := make(map[int]int, len(lines))
+	for _, l := range lines {
+		qty[l.ItemID] = l.RefundedQuantity
+	}
+	return o.PaymentStatus, o.Refunded, qty
+}
+
+func TestBeginRefund(t *testing.T) {
+	d, orderID, eggs, mug := refundFixture(t)
+	ctx := context.Background()
+
+	// one egg: its price, less its third of the discount, plus its share of the tax
+	rf, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID, Items: map[int]int{eggs: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rf.Amount != 389 || rf.Status != RefundPending || len(rf.Items) != 1 || rf.Items[0].Amount != 389 {
+		t.Errorf("partial refund %+v, want 389 pending", rf)
+	}
+	if status, refunded, qty := refundedOf(t, d, orderID); status != PaymentPartiallyRefunded || refunded != 389 || qty[eggs] != 1 {
+		t.Errorf("after a partial refund: %s, %d refunded, %v", status, refunded, qty)
+	}
+
+	for name, items := range map[string]map[int]int{
+		"more than is left": {eggs: 3},
+		"none":              {eggs: 0},
+		"not in the order":  {eggs + mug: 1},
+	} {
+		if _, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID, Items: items}); !errors.Is(err, ErrInvalidRefund) {
+			t.Errorf("%s: %v, want ErrInvalidRefund", name, err)
+		}
+	}
+
+	// everything else, which takes what is left
+	rf, err = BeginRefund(ctx, d, RefundRequest{OrderID: orderID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	amounts := make(map[int]int64)
+	for _, it := range rf.Items {
+		amounts[it.ItemID] = it.Amount
+	}
+	if rf.Amount != 2046-389 || amounts[eggs] != 800-80+60 || amounts[mug] != 900-90+67 {
+		t.Errorf("full refund %+v, want %d", rf, 2046-389)
+	}
+	if status, refunded, qty := refundedOf(t, d, orderID); status != PaymentRefunded || refunded != 2046 || qty[eggs] != 3 || qty[mug] != 1 {
+		t.Errorf("after a full refund: %s, %d refunded, %v", status, refunded, qty)
+	}
+
+	// a fully refunded payment takes no more refunds
+	if _, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID}); !errors.Is(err, ErrConflict) {
+		t.Errorf("refund of a refunded order: %v, want ErrConflict", err)
+	}
+	if n := count(t, d, "refunds", "order_id = ?", orderID); n != 2 {
+		t.Errorf("%d refunds recorded, want 2", n)
+	}
+}
+
+// TestRefundClamped refunds an order mostly refunded already through the
+// provider: the refund is cut down to what is left of the amount.
+func TestRefundClamped(t *testing.T) {
+	d, orderID, eggs, _ := refundFixture(t)
+	ctx := context.Background()
+
+	ev := payments.Event{ID: "evt_1", Type: payments.EventRefunded, PaymentID: "pay_1", Amount: 2000}
+	payload, _ := json.Marshal(ev)
+	if _, _, err := ApplyPaymentEvent(ctx, d, ev, payload); err != nil {
+		t.Fatal(err)
+	}
+	rf, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID, Items: map[int]int{eggs: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rf.Amount != 46 {
+		t.Errorf("refund of %d, want the 46 left", rf.Amount)
+	}
+	if status, refunded, _ := refundedOf(t, d, orderID); status != PaymentRefunded || refunded != 2046 {
+		t.Errorf("after the refund: %s, %d refunded", status, refunded)
+	}
+}
+
+func TestRefundRestock(t *testing.T) {
+	d, orderID, eggs, mug := refundFixture(t)
+	ctx := context.Background()
+
+	kept, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID, Items: map[int]int{mug: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID, Items: map[int]int{eggs: 2}, Restock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a pending refund restocks nothing until the money is back
+	if got := stockOf(t, d, eggs); got != 7 {
+		t.Errorf("eggs %d while pending, want 7", got)
+	}
+	for _, rf := range []Refund{kept, back} {
+		if err := CompleteRefund(ctx, d, rf.ID, "re_1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := stockOf(t, d, eggs); got != 9 {
+		t.Errorf("eggs %d, want 9", got)
+	}
+	if got := stockOf(t, d, mug); got != 9 {
+		t.Errorf("mug %d, want 9 (not restocked)", got)
+	}
+	if err := CompleteRefund(ctx, d, back.ID, "re_2"); !errors.Is(err, ErrConflict) {
+		t.Errorf("completing twice: %v, want ErrConflict", err)
+	}
+	if got := stockOf(t, d, eggs); got != 9 {
+		t.Errorf("eggs %d after a second completion, want 9", got)
+	}
+
+	// an unpaid order's refund succeeds, and restocks, at once
+	orderID, err = PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{mug: 2}}, Payment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID, Restock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rf.Status != RefundSucceeded || stockOf(t, d, mug) != 9 {
+		t.Errorf("unpaid refund %s, mug %d; want succeeded, 9", rf.Status, stockOf(t, d, mug))
+	}
+}
+
+func TestFailRefund(t *testing.T) {
+	d, orderID, eggs, _ := refundFixture(t)
+	ctx := context.Background()
+
+	rf, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID, Items: map[int]int{eggs: 2}, Restock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FailRefund(ctx, d, rf.ID); err != nil {
+		t.Fatal(err)
+	}
+	if status, refunded, qty := refundedOf(t, d, orderID); status != PaymentCaptured || refunded != 0 || qty[eggs] != 0 {
+		t.Errorf("after a failed refund: %s, %d refunded, %v", status, refunded, qty)
+	}
+	if got := stockOf(t, d, eggs); got != 7 {
+		t.Errorf("eggs %d, want 7", got)
+	}
+	if rf, err := GetRefund(ctx, d, rf.ID); err != nil || rf.Status != RefundFailed {
+		t.Errorf("refund %s, %v; want failed", rf.Status, err)
+	}
+	if err := CompleteRefund(ctx, d, rf.ID, "re_1"); !errors.Is(err, ErrConflict) {
+		t.Errorf("completing a failed refund: %v, want ErrConflict", err)
+	}
+
+	// the units can be refunded again
+	if rf, err := BeginRefund(ctx, d, RefundRequest{OrderID: orderID, Items: map[int]int{eggs: 2}}); err != nil || rf.Amount != 800-80+59 {
+		t.Errorf("refund after a failure: %d, %v", rf.Amount, err)
+	}
+}
@@ -0,0 +1,325 @@
+// internal/db/suborders.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Sub-order statuses, in the order a sub-order moves through them. A
+// sub-order can be cancelled until it is ready.
+const (
+	SubOrderPending   = "pending"   // placed, not yet seen by the vendor
+	SubOrderAccepted  = "accepted"  // the vendor is preparing it
+	SubOrderReady     = "ready"     // packed, waiting for pickup or delivery
+	SubOrderFulfilled = "fulfilled" // handed over
+	SubOrderCancelled = "cancelled" // refund its lines with BeginRefund
+)
+
+// subOrderNext maps each status to the statuses it may move to.
+var subOrderNext = map[string][]string{
+	SubOrderPending:  {SubOrderAccepted, SubOrderCancelled},
+	SubOrderAccepted: {SubOrderReady, SubOrderCancelled},
+	SubOrderReady:    {SubOrderFulfilled},
+}
+
+// ValidSubOrderStatus reports whether status is one of the statuses above.
+func ValidSubOrderStatus(status string) bool {
+	switch status {
+	case SubOrderPending, SubOrderAccepted, SubOrderReady, SubOrderFulfilled, SubOrderCancelled:
+		return true
+	}
+	return false
+}
+
+// SubOrder is one vendor's part of an order: its lines and their totals.
+// VendorID 0 is the store's own items.
+type SubOrder struct {
+	ID        int64       `json:"id"`
+	OrderID   int64       `json:"order_id"`
+	VendorID  int64       `json:"vendor_id,omitempty"`
+	Vendor    string      `json:"vendor,omitempty"`
+	Status    string      `json:"status"`
+	Subtotal  int64       `json:"subtotal"`
+	Discount  int64       `json:"discount"`
+	Tax       int64       `json:"tax"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Lines     []OrderItem `json:"lines"`
+}
+
+// VendorOrder is a sub-order as its vendor sees it: with what it needs of
+// the order to fulfil it, and none of the other vendors' lines.
+type VendorOrder struct {
+	SubOrder
+	UserID            string    `json:"user_id"`
+	CreatedAt         time.Time `json:"created_at"`
+	PostalCode        string    `json:"postal_code,omitempty"`
+	SlotID            int64     `json:"slot_id,omitempty"`
+	FulfillmentMethod string    `json:"fulfillment_method,omitempty"`
+	DeliveryAddress   string    `json:"delivery_address,omitempty"`
+}
+
+// OrderStatus combines an order's sub-order statuses into one for the
+// customer: the least advanced of those not cancelled, or cancelled if
+// they all are.
+func OrderStatus(subs []SubOrder) string {
+	rank := []string{SubOrderPending, SubOrderAccepted, SubOrderReady, SubOrderFulfilled}
+	status := ""
+	for _, so := range subs {
+		i := slices.Index(rank, so.Status)
+		if i >= 0 && (status == "" || i < slices.Index(rank, status)) {
+			status = so.Status
+		}
+	}
+	if status == "" {
+		return SubOrderCancelled
+	}
+	return status
+}
+
+// splitOrder creates an order's sub-orders, one per vendor in q's lines.
+func splitOrder(ctx context.Context, db *DB, tx *dbTx, orderID int64, q Quote) error {
+	var vendors []int64
+	totals := make(map[int64]*SubOrder)
+	for _, l := range q.Lines {
+		so, ok := totals[l.VendorID]
+		if !ok {
+			so = &SubOrder{}
+			totals[l.VendorID] = so
+			vendors = append(vendors, l.VendorID)
+		}
+		so.Subtotal += l.UnitPrice * int64(l.Quantity)
+		so.Discount += l.Discount
+		so.Tax += l.Tax
+	}
+	slices.Sort(vendors)
+	now := time.Now().UTC()
+	for _, vendorID := range vendors {
+		so := totals[vendorID]
+		if _, err := db.insertID(ctx, tx, `
+            INSERT INTO sub_orders (order_id, vendor_id, status, subtotal, discount, tax, updated_at)
+            VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			orderID, nullInt64(vendorID), SubOrderPending, so.Subtotal, so.Discount, so.Tax, now,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const subOrderColumns = "so.id, so.order_id, so.vendor_id, v.name, so.status, so.subtotal, so.discount, so.tax, so.updated_at"
+
+func scanSubOrder(row interface{ Scan(...any) error }, so *SubOrder, extra ...any) error {
+	var (
+		vendorID sql.NullInt64
+		vendor   sql.NullString
+	)
+	dest := []any{&so.ID, &so.OrderID, &vendorID, &vendor, &so.Status, &so.Subtotal, &so.Discount, &so.Tax, &so.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	so.VendorID = vendorID.Int64
+	so.Vendor = vendor.String
+	so.Lines = []OrderItem{}
+	return err
+}
+
+// GetSubOrders returns an order's sub-orders, each with its lines.
+func GetSubOrders(ctx context.Context, db *DB, orderID int64) (_ []SubOrder, err error) {
+	ctx, end := db.startOp(ctx, "GetSubOrders")
+	defer end(&err)
+	rows, err := db.QueryContext(ctx, `
+        SELECT `+subOrderColumns+`
+        FROM sub_orders so
+        LEFT JOIN vendors v ON v.id = so.vendor_id
+        WHERE so.order_id = ?
+        ORDER BY so.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subs := []SubOrder{}
+	for rows.Next() {
+		var so SubOrder
+		if err := scanSubOrder(rows, &so); err != nil {
+			return nil, err
+		}
+		subs = append(subs, so)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	lines, err := orderLines(ctx, db, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if i := slices.IndexFunc(subs, func(so SubOrder) bool { return so.VendorID == l.VendorID }); i >= 0 {
+			subs[i].Lines = append(subs[i].Lines, l)
+		}
+	}
+	return subs, nil
+}
+
+// GetSubOrder fetches one sub-order, without its lines.
+func GetSubOrder(ctx context.Context, db *DB, subOrderID int64) (_ SubOrder, err error) {
+	ctx, end := db.startOp(ctx, "GetSubOrder")
+	defer end(&err)
+	var so SubOrder
+	err = scanSubOrder(db.QueryRowContext(ctx, `
+        SELECT `+subOrderColumns+`
+        FROM sub_orders so
+        LEFT JOIN vendors v ON v.id = so.vendor_id
+        WHERE so.id = ?`, subOrderID,
+	), &so)
+	if err == sql.ErrNoRows {
+		return SubOrder{}, fmt.Errorf("sub-order %d: %w", subOrderID, ErrNotFound)
+	}
+	return so, err
+}
+
+// GetVendorOrders returns vendorID's sub-orders, newest first, with only
+// that vendor's lines, optionally only those in status.
+func GetVendorOrders(ctx context.Context, db *DB, vendorID int64, status string) (_ []VendorOrder, err error) {
+	ctx, end := db.startOp(ctx, "GetVendorOrders")
+	defer end(&err)
+	query := `
+        SELECT ` + subOrderColumns + `,
+               o.user_id, o.created_at, o.postal_code, o.slot_id, o.fulfillment_method, o.delivery_address
+        FROM sub_orders so
+        JOIN orders o ON o.id = so.order_id
+        LEFT JOIN vendors v ON v.id = so.vendor_id
+        WHERE so.vendor_id = ?`
+	args := []any{vendorID}
+	if status != "" {
+		query += " AND so.status = ?"
+		args = append(args, status)
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY so.order_id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orders := []VendorOrder{}
+	byOrder := make(map[int64]int)
+	for rows.Next() {
+		var (
+			vo     VendorOrder
+			slotID sql.NullInt64
+		)
+		if err := scanSubOrder(rows, &vo.SubOrder, &vo.UserID, &vo.CreatedAt, &vo.PostalCode,
+			&slotID, &vo.FulfillmentMethod, &vo.DeliveryAddress); err != nil {
+			return nil, err
+		}
+		vo.SlotID = slotID.Int64
+		byOrder[vo.OrderID] = len(orders)
+		orders = append(orders, vo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	// the vendor's lines of those orders, in one query
+	query = `
+        SELECT oi.order_id, oi.item_id, oi.quantity, oi.unit_price, oi.refunded_quantity,
+               oi.tax_category, oi.tax_jurisdiction, oi.tax_rate, oi.tax, oi.discount
+        FROM order_items oi
+        JOIN sub_orders so ON so.order_id = oi.order_id AND so.vendor_id = oi.vendor_id
+        WHERE oi.vendor_id = ?`
+	args = []any{vendorID}
+	if status != "" {
+		query += " AND so.status = ?"
+		args = append(args, status)
+	}
+	rows, err = db.QueryContext(ctx, query+" ORDER BY oi.order_id, oi.item_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			li           = OrderItem{VendorID: vendorID}
+			jurisdiction sql.NullString
+		)
+		if err := rows.Scan(&li.OrderID, &li.ItemID, &li.Quantity, &li.UnitPrice, &li.RefundedQuantity,
+			&li.TaxCategory, &jurisdiction, &li.TaxRate, &li.Tax, &li.Discount); err != nil {
+			return nil, err
+		}
+		li.TaxJurisdiction = jurisdiction.String
+		if i, ok := byOrder[li.OrderID]; ok {
+			orders[i].Lines = append(orders[i].Lines, li)
+		}
+	}
+	return orders, rows.Err()
+}
+
+// SetSubOrderStatus moves a sub-order on to status. The UPDATE only
+// matches from a status that may move there, so of two concurrent changes
+// only one can win; a move the lifecycle doesn't allow is ErrConflict.
+func SetSubOrderStatus(ctx context.Context, db *DB, subOrderID int64, status string) (err error) {
+	ctx, end := db.startOp(ctx, "SetSubOrderStatus")
+	defer end(&err)
+	var from []string
+	for prev, next := range subOrderNext {
+		if slices.Contains(next, status) {
+			from = append(from, prev)
+		}
+	}
+	slices.Sort(from) // the same statement every time
+	if len(from) > 0 {
+		args := []any{status, time.Now().UTC(), subOrderID}
+		for _, prev := range from {
+			args = append(args, prev)
+		}
+		res, err := db.ExecContext(ctx,
+			"UPDATE sub_orders SET status = ?, updated_at = ? WHERE id = ? AND status IN ("+placeholders(len(from))+")",
+			args...,
+		)
+		if err != nil {
+			return err
+		}
+		if rows, _ := res.RowsAffected(); rows > 0 {
+			return nil
+		}
+	}
+	so, err := GetSubOrder(ctx, db, subOrderID)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("sub-order %d is %s, can't be %s: %w", subOrderID, so.Status, status, ErrConflict)
+}
+
+// UserVendor returns the vendor userID works for, or 0 for none. It fails
+// with ErrNotFound for a user who has never been stored.
+func UserVendor(ctx context.Context, db *DB, userID string) (_ int64, err error) {
+	ctx, end := db.startOp(ctx, "UserVendor")
+	defer end(&err)
+	var vendorID sql.NullInt64
+	err = db.QueryRowContext(ctx, "SELECT vendor_id FROM users WHERE id = ?", userID).Scan(&vendorID)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("user %s: %w", userID, ErrNotFound)
+	}
+	return vendorID.Int64, err
+}
+
+// SetUserVendor makes userID one of vendorID's staff, or nobody's with
+// vendorID 0. An unknown vendor is ErrConflict.
+func SetUserVendor(ctx context.Context, db *DB, userID string, vendorID int64) (err error) {
+	ctx, end := db.startOp(ctx, "SetUserVendor")
+	defer end(&err)
+	res, err := db.ExecContext(ctx, "UPDATE users SET vendor_id = ? WHERE id = ?", nullInt64(vendorID), userID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("user %s: %w", userID, ErrNotFound)
+	}
+	return nil
+}
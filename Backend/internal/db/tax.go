@@ -0,0 +1,323 @@
+// internal/db/tax.go
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"nexus.local/internal/tax"
+)
+
+// QuoteLine is one line of an order as it would be placed now.
+type QuoteLine struct {
+	ItemID          int    `json:"item_id"`
+	Quantity        int    `json:"quantity"`
+	UnitPrice       int64  `json:"unit_price"` // cents
+	VendorID        int64  `json:"vendor_id,omitempty"`
+	TaxCategory     string `json:"tax_category"`
+	TaxJurisdiction string `json:"tax_jurisdiction,omitempty"`
+	TaxRate         int64  `json:"tax_rate"` // basis points
+	Tax             int64  `json:"tax"`
+	Discount        int64  `json:"discount"` // this line's share of Promotions
+
+	taxed bool // a rate applied, even if for the empty jurisdiction
+}
+
+// jurisdiction is the line's tax_jurisdiction column: NULL if untaxed.
+func (l QuoteLine) jurisdiction() sql.NullString {
+	return sql.NullString{String: l.TaxJurisdiction, Valid: l.taxed}
+}
+
+// Quote is an order priced, discounted and taxed at today's prices,
+// promotions and rates. Tax is charged on what is left of each line after
+// its discount, rounded line by line by its rate's rounding rule; the
+// fulfillment fee is not taxed. Total is what the customer pays.
+type Quote struct {
+	PostalCode     string             `json:"postal_code,omitempty"`
+	Lines          []QuoteLine        `json:"lines"`
+	Promotions     []AppliedPromotion `json:"promotions"`
+	Fulfillment    *QuoteFulfillment  `json:"fulfillment,omitempty"`
+	Subtotal       int64              `json:"subtotal"`
+	Discount       int64              `json:"discount"`
+	Tax            int64              `json:"tax"`
+	FulfillmentFee int64              `json:"fulfillment_fee"`
+	Total          int64              `json:"total"`
+}
+
+// QuoteOrder prices and taxes an order without placing it, so the caller
+// knows how much to authorize. It fails with ErrNotFound for an unknown
+// item or slot, ErrPromotionUnavailable for a promo code that can't be
+// used and ErrSlotUnavailable for a slot that can't be booked.
+func QuoteOrder(ctx context.Context, db *DB, o NewOrder) (_ Quote, err error) {
+	ctx, end := db.startOp(ctx, "QuoteOrder")
+	defer end(&err)
+	return quoteOrder(ctx, db, o)
+}
+
+func quoteOrder(ctx context.Context, q querier, o NewOrder) (Quote, error) {
+	quote := Quote{PostalCode: tax.PostalCode(o.PostalCode), Lines: []QuoteLine{}, Promotions: []AppliedPromotion{}}
+	if len(o.Items) == 0 {
+		return quote, nil
+	}
+	ids := make([]int, 0, len(o.Items))
+	args := make([]any, 0, len(o.Items))
+	for id := range o.Items {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids) // lines, and so stock updates, in a fixed order
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	// 1) today's prices, vendors and categories
+	rows, err := q.QueryContext(ctx,
+		"SELECT id, price, vendor_id, tax_category FROM items WHERE id IN ("+placeholders(len(ids))+")",
+		args...,
+	)
+	if err != nil {
+		return Quote{}, err
+	}
+	defer rows.Close()
+	found := make(map[int]QuoteLine, len(ids))
+	for rows.Next() {
+		var (
+			l        QuoteLine
+			price    float64
+			vendorID sql.NullInt64
+		)
+		if err := rows.Scan(&l.ItemID, &price, &vendorID, &l.TaxCategory); err != nil {
+			return Quote{}, err
+		}
+		l.UnitPrice = int64(math.Round(price * 100))
+		l.VendorID = vendorID.Int64
+		found[l.ItemID] = l
+	}
+	if err := rows.Err(); err != nil {
+		return Quote{}, err
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		l, ok := found[id]
+		if !ok {
+			return Quote{}, fmt.Errorf("item %d: %w", id, ErrNotFound)
+		}
+		l.Quantity = o.Items[id]
+		quote.Lines = append(quote.Lines, l)
+		quote.Subtotal += l.UnitPrice * int64(l.Quantity)
+	}
+
+	// 2) take off promotions
+	if err := applyPromotions(ctx, q, o, &quote); err != nil {
+		return Quote{}, err
+	}
+
+	// 3) tax what is left of each line by the best matching rate
+	rates, err := taxRates(ctx, q)
+	if err != nil {
+		return Quote{}, err
+	}
+	for i := range quote.Lines {
+		l := &quote.Lines[i]
+		if rate, ok := tax.Match(rates, quote.PostalCode, l.VendorID, l.TaxCategory); ok {
+			l.taxed = true
+			l.TaxJurisdiction = rate.Jurisdiction
+			l.TaxRate = rate.BasisPoints
+			l.Tax = rate.Tax(l.UnitPrice*int64(l.Quantity) - l.Discount)
+		}
+		quote.Tax += l.Tax
+	}
+
+	// 4) the pickup or delivery slot and its fee
+	if err := quoteFulfillment(ctx, q, o, &quote); err != nil {
+		return Quote{}, err
+	}
+	quote.Total = quote.Subtotal - quote.Discount + quote.Tax + quote.FulfillmentFee
+	return quote, nil
+}
+
+// placeholders returns n comma‑separated "?"s for an IN list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// ListTaxRates returns every configured tax rate.
+func ListTaxRates(ctx context.Context, db *DB) (_ []tax.Rate, err error) {
+	ctx, end := db.startOp(ctx, "ListTaxRates")
+	defer end(&err)
+	return taxRates(ctx, db)
+}
+
+func taxRates(ctx context.Context, q querier) ([]tax.Rate, error) {
+	rows, err := q.QueryContext(ctx, `
+        SELECT id, jurisdiction, category, vendor_id, basis_points, rounding
+        FROM tax_rates
+        ORDER BY jurisdiction, category, vendor_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rates := []tax.Rate{}
+	for rows.Next() {
+		var r tax.Rate
+		if err := rows.Scan(&r.ID, &r.Jurisdiction, &r.Category, &r.VendorID, &r.BasisPoints, &r.Rounding); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// PutTaxRate sets the rate for r's jurisdiction, category and vendor,
+// replacing any rate already there, and returns it as stored. Orders
+// already placed keep the rate they were taxed at.
+func PutTaxRate(ctx context.Context, db *DB, r tax.Rate) (_ tax.Rate, err error) {
+	ctx, end := db.startOp(ctx, "PutTaxRate")
+	defer end(&err)
+	r.Jurisdiction = tax.PostalCode(r.Jurisdiction)
+	if r.Rounding == "" {
+		r.Rounding = tax.HalfUp
+	}
+	if _, err := db.ExecContext(ctx,
+		"INSERT INTO tax_rates (jurisdiction, category, vendor_id, basis_points, rounding) VALUES (?, ?, ?, ?, ?) "+
+			db.dialect.upsert("jurisdiction, category, vendor_id", []string{"basis_points", "rounding"}),
+		r.Jurisdiction, r.Category, r.VendorID, r.BasisPoints, r.Rounding,
+	); err != nil {
+		return tax.Rate{}, err
+	}
+	err = db.QueryRowContext(ctx,
+		"SELECT id FROM tax_rates WHERE jurisdiction = ? AND category = ? AND vendor_id = ?",
+		r.Jurisdiction, r.Category, r.VendorID,
+	).Scan(&r.ID)
+	return r, err
+}
+
+// DeleteTaxRate removes a tax rate.
+func DeleteTaxRate(ctx context.Context, db *DB, rateID int64) (err error) {
+	ctx, end := db.startOp(ctx, "DeleteTaxRate")
+	defer end(&err)
+	res, err := db.ExecContext(ctx, "DELETE FROM tax_rates WHERE id = ?", rateID)
+	if err != nil {
+		return err
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("tax rate %d: %w", rateID, ErrNotFound)
+	}
+	return nil
+}
+
+// TaxSummary is the tax on one vendor's sales of one category in one
+// jurisdiction at one rate, over a period. Amounts are in cents; refunded
+// quantities give their share of the tax back.
+type TaxSummary struct {
+	VendorID     int64  `json:"vendor_id"` // 0 for items without a vendor
+	Vendor       string `json:"vendor"`
+	Jurisdiction string `json:"jurisdiction"`
+	Category     string `json:"category"`
+	Rate         int64  `json:"rate"` // basis points
+	Orders       int    `json:"orders"`
+	Taxable      int64  `json:"taxable"`
+	Tax          int64  `json:"tax"`
+	RefundedTax  int64  `json:"refunded_tax"`
+	NetTax       int64  `json:"net_tax"`
+}
+
+// TaxReport sums the tax of the taxed lines of orders placed in
+// [from, to), per vendor, jurisdiction, category and rate, optionally for
+// one vendor only. Voided orders never took any money and are left out.
+func TaxReport(ctx context.Context, db *DB, from, to time.Time, vendorID int64) (_ []TaxSummary, err error) {
+	ctx, end := db.startOp(ctx, "TaxReport")
+	defer end(&err)
+	query := `
+        SELECT oi.order_id, oi.vendor_id, v.name, oi.tax_jurisdiction, oi.tax_category, oi.tax_rate,
+               oi.unit_price, oi.quantity, oi.refunded_quantity, oi.discount, oi.tax
+        FROM order_items oi
+        JOIN orders o ON o.id = oi.order_id
+        LEFT JOIN vendors v ON v.id = oi.vendor_id
+        WHERE o.created_at >= ? AND o.created_at < ?
+          AND o.payment_status <> ?
+          AND oi.tax_jurisdiction IS NOT NULL`
+	args := []any{from.UTC(), to.UTC(), PaymentVoided}
+	if vendorID != 0 {
+		query += " AND oi.vendor_id = ?"
+		args = append(args, vendorID)
+	}
+	rows, err := db.QueryContext(ctx, query+" ORDER BY oi.order_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type key struct {
+		vendorID     int64
+		jurisdiction string
+		category     string
+		rate         int64
+	}
+	byKey := make(map[key]*TaxSummary)
+	lastOrder := make(map[key]int64)
+	for rows.Next() {
+		var (
+			orderID, unitPrice, discount, lineTax int64
+			qty, refundedQty                      int
+			k                                     key
+			vID                                   sql.NullInt64
+			vendor                                sql.NullString
+		)
+		if err := rows.Scan(&orderID, &vID, &vendor, &k.jurisdiction, &k.category, &k.rate,
+			&unitPrice, &qty, &refundedQty, &discount, &lineTax); err != nil {
+			return nil, err
+		}
+		k.vendorID = vID.Int64
+		sum, ok := byKey[k]
+		if !ok {
+			sum = &TaxSummary{VendorID: k.vendorID, Vendor: vendor.String, Jurisdiction: k.jurisdiction, Category: k.category, Rate: k.rate}
+			byKey[k] = sum
+		}
+		if lastOrder[k] != orderID {
+			sum.Orders++
+			lastOrder[k] = orderID
+		}
+		sum.Taxable += unitPrice*int64(qty) - discount
+		sum.Tax += lineTax
+		sum.RefundedTax += lineShare(lineTax, qty, refundedQty)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report := make([]TaxSummary, 0, len(byKey))
+	for _, sum := range byKey {
+		sum.NetTax = sum.Tax - sum.RefundedTax
+		report = append(report, *sum)
+	}
+	slices.SortFunc(report, func(a, b TaxSummary) int {
+		switch {
+		case a.VendorID != b.VendorID:
+			return cmp.Compare(a.VendorID, b.VendorID)
+		case a.Jurisdiction != b.Jurisdiction:
+			return strings.Compare(a.Jurisdiction, b.Jurisdiction)
+		case a.Category != b.Category:
+			return strings.Compare(a.Category, b.Category)
+		}
+		return cmp.Compare(a.Rate, b.Rate)
+	})
+	return report, nil
+}
+
+// lineShare is the part of a line's total (its tax or discount) that
+// belongs to n of its qty units. Shares of 0..k and k..n units add up
+// exactly, so a line refunded in several goes gives back all of it and no
+// more.
+func lineShare(total int64, qty, n int) int64 {
+	if qty <= 0 {
+		return 0
+	}
+	return total * int64(n) / int64(qty)
+}
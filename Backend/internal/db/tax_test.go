@@ -0,0 +1,68 @@
+// internal/db/tax_test.go
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"nexus.local/internal/tax"
+)
+
+// TestTaxReportPeriods places an order on each side of a period boundary
+// and checks each falls in its own period, on a host whose local time zone
+// isn't UTC.
+func TestTaxReportPeriods(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+9", 9*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	d := openTestDB(t)
+	ctx := context.Background()
+	eggs := addTestItem(t, d, "eggs", 4, 10, 0)
+	if _, err := PutTaxRate(ctx, d, tax.Rate{Category: tax.DefaultCategory, BasisPoints: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	place := func(qty int) {
+		t.Helper()
+		if _, err := PlaceOrder(ctx, d, NewOrder{UserID: "u1", Items: map[int]int{eggs: qty}}, Payment{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the boundary is on a whole second, which every dialect stores exactly
+	place(1)
+	boundary := time.Now().UTC().Truncate(time.Second).Add(time.Second)
+	time.Sleep(time.Until(boundary))
+	place(2)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		orders   int
+		tax      int64
+	}{
+		{"before", boundary.Add(-time.Hour), boundary, 1, 40},
+		{"after", boundary, boundary.Add(time.Hour), 1, 80},
+		{"both", boundary.Add(-time.Hour), boundary.Add(time.Hour), 2, 120},
+		{"both, in local time", boundary.Add(-time.Hour).Local(), boundary.Add(time.Hour).Local(), 2, 120},
+		{"earlier", boundary.Add(-2 * time.Hour), boundary.Add(-time.Hour), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := TaxReport(ctx, d, tt.from, tt.to, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var orders int
+			var tax int64
+			for _, sum := range report {
+				orders += sum.Orders
+				tax += sum.Tax
+			}
+			if orders != tt.orders || tax != tt.tax {
+				t.Errorf("%d orders, %d tax; want %d, %d: %+v", orders, tax, tt.orders, tt.tax, report)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// internal/db/testdb_test.go
+package db
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The tests in this package run against SQLite by default, each in a
+// fresh database file. To run the very same tests on a server, set
+// TEST_DB_DRIVER to mysql or postgres together with TEST_DB_HOST,
+// TEST_DB_PORT, TEST_DB_USER, TEST_DB_PASS, TEST_DB_NAME and, for
+// Postgres, TEST_DB_SSLMODE (default disable). TEST_DB_NAME is emptied
+// before every test, so it must be a scratch database.
+
+// openTestDB connects to the test database, empties it and migrates it.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	opts := Options{Driver: os.Getenv("TEST_DB_DRIVER"), MaxOpenConns: 8}
+	switch opts.Driver {
+	case "", DriverSQLite:
+		opts.Driver = DriverSQLite
+		opts.Name = filepath.Join(t.TempDir(), "test.db")
+	default:
+		opts.Host = os.Getenv("TEST_DB_HOST")
+		opts.Port = os.Getenv("TEST_DB_PORT")
+		opts.User = os.Getenv("TEST_DB_USER")
+		opts.Pass = os.Getenv("TEST_DB_PASS")
+		opts.Name = os.Getenv("TEST_DB_NAME")
+		opts.SSLMode = cmp.Or(os.Getenv("TEST_DB_SSLMODE"), "disable")
+		if opts.Name == "" {
+			t.Fatalf("TEST_DB_DRIVER=%s needs TEST_DB_NAME, a scratch database", opts.Driver)
+		}
+	}
+
+	// Connect waits for the server until ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	d, err := Connect(ctx, opts)
+	if err != nil {
+		t.Fatalf("connect to %s: %v", opts.Driver, err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if opts.Driver != DriverSQLite {
+		resetSchema(ctx, t, d)
+	}
+	if err := Migrate(ctx, d); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return d
+}
+
+// resetSchema drops every table of a MySQL or Postgres test database.
+func resetSchema(ctx context.Context, t *testing.T, d *DB) {
+	t.Helper()
+	if d.dialect.name == DriverPostgres {
+		for _, stmt := range []string{"DROP SCHEMA public CASCADE", "CREATE SCHEMA public"} {
+			if _, err := d.ExecContext(ctx, stmt); err != nil {
+				t.Fatalf("reset schema: %v", err)
+			}
+		}
+		return
+	}
+
+	// MySQL: one connection, so the foreign-key switch applies to the drops
+	conn, err := d.Conn(ctx)
+	if err != nil {
+		t.Fatalf("reset schema: %v", err)
+	}
+	defer conn.Close()
+	rows, err := conn.QueryContext(ctx,
+		"SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()")
+	if err != nil {
+		t.Fatalf("reset schema: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("reset schema: %v", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	stmts := []string{"SET FOREIGN_KEY_CHECKS = 0"}
+	for _, name := range tables {
+		stmts = append(stmts, "DROP TABLE `"+name+"`")
+	}
+	stmts = append(stmts, "SET FOREIGN_KEY_CHECKS = 1")
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("reset schema: %v", err)
+		}
+	}
+}
+
+// count returns the number of rows of table matching where.
+func count(t *testing.T, d *DB, table, where string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := d.QueryRowContext(context.Background(),
+		"SELECT COUNT(*) FROM "+table+" WHERE "+where, args...,
+	).Scan(&n); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
+
+// addTestItem adds an item with stock and returns its ID.
+func addTestItem(t *testing.T, d *DB, name string, price float64, stock int, vendorID int64) int {
+	t.Helper()
+	id, err := AddItem(context.Background(), d, Item{Name: name, Price: price, Stock: stock, VendorID: vendorID})
+	if err != nil {
+		t.Fatalf("add item %s: %v", name, err)
+	}
+	return int(id)
+}
+
+// stockOf returns an item's stock.
+func stockOf(t *testing.T, d *DB, itemID int) int {
+	t.Helper()
+	it, err := GetItem(context.Background(), d, itemID)
+	if err != nil {
+		t.Fatalf("get item %d: %v", itemID, err)
+	}
+	return it.Stock
+}
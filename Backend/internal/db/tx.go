@@ -0,0 +1,86 @@
+// internal/db/tx.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"nexus.local/internal/logging"
+)
+
+// maxTxAttempts is how often inTx runs a transaction that keeps failing
+// with a retryable error.
+const maxTxAttempts = 3
+
+// MySQL error numbers that mean "roll the transaction back and run it
+// again": a deadlock victim, whose transaction the server has already
+// rolled back, or a lock wait timeout, after which only the statement is
+// rolled back (unless innodb_rollback_on_timeout is set) and runTx rolls
+// back the rest. InnoDB reports serialization conflicts as one of these.
+const (
+	errLockWaitTimeout = 1205 // ER_LOCK_WAIT_TIMEOUT
+	errLockDeadlock    = 1213 // ER_LOCK_DEADLOCK (SQLSTATE 40001)
+)
+
+// dbTx is a transaction that rebinds placeholders like DB does.
+type dbTx struct {
+	*sql.Tx
+	dialect *dialect
+}
+
+func (tx *dbTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.dialect.rebind(query), args...)
+}
+
+func (tx *dbTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.dialect.rebind(query), args...)
+}
+
+func (tx *dbTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.dialect.rebind(query), args...)
+}
+
+// inTx runs fn in a transaction and commits it. If the transaction fails
+// with a deadlock, serialization failure or, on MySQL, a lock wait
+// timeout (or, on SQLite, a busy database) it is rolled back and fn is
+// run again from scratch (up to maxTxAttempts times), so fn must not have
+// side effects outside tx.
+func (db *DB) inTx(ctx context.Context, opts *sql.TxOptions, fn func(*dbTx) error) error {
+	for attempt := 1; ; attempt++ {
+		err := db.runTx(ctx, opts, fn)
+		if err == nil || !db.dialect.retryable(err) || attempt == maxTxAttempts {
+			return err
+		}
+		delay := time.Duration(attempt)*20*time.Millisecond + rand.N(20*time.Millisecond)
+		logging.FromContext(ctx).Warn("retrying transaction",
+			slog.Int("attempt", attempt), slog.Duration("retry_in", delay), slog.Any("error", err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (db *DB) runTx(ctx context.Context, opts *sql.TxOptions, fn func(*dbTx) error) error {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := fn(&dbTx{Tx: tx, dialect: db.dialect}); err != nil {
+		rollback(ctx, tx)
+		return err
+	}
+	return tx.Commit()
+}
+
+// rollback aborts tx, logging (rather than hiding) a failed rollback.
+func rollback(ctx context.Context, tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logging.FromContext(ctx).Error("transaction rollback failed", slog.Any("error", err))
+	}
+}
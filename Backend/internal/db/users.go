@@ -0,0 +1,91 @@
+// internal/db/users.go
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// User is a row of the users table, filled from the caller's Microsoft
+// Graph profile. is_admin is only ever set by hand and isn't part of it.
+type User struct {
+	ID                string
+	DisplayName       string
+	GivenName         string
+	Surname           string
+	JobTitle          *string
+	Mail              *string
+	MobilePhone       *string
+	OfficeLocation    *string
+	PreferredLanguage *string
+	UserPrincipalName string
+	BusinessPhones    []string
+}
+
+// UpsertUser inserts u, or refreshes the profile columns of an existing
+// user with the same ID.
+func UpsertUser(ctx context.Context, db *DB, u User) (err error) {
+	ctx, end := db.startOp(ctx, "UpsertUser")
+	defer end(&err)
+	phones, err := json.Marshal(u.BusinessPhones)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+        INSERT INTO users (
+            id,
+            display_name,
+            given_name,
+            surname,
+            job_title,
+            mail,
+            mobile_phone,
+            office_location,
+            preferred_language,
+            user_principal_name,
+            business_phones
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `+db.dialect.upsert("id", []string{
+		"display_name",
+		"given_name",
+		"surname",
+		"job_title",
+		"mail",
+		"mobile_phone",
+		"office_location",
+		"preferred_language",
+		"user_principal_name",
+		"business_phones",
+	}),
+		u.ID,
+		u.DisplayName,
+		u.GivenName,
+		u.Surname,
+		u.JobTitle,
+		u.Mail,
+		u.MobilePhone,
+		u.OfficeLocation,
+		u.PreferredLanguage,
+		u.UserPrincipalName,
+		string(phones),
+	)
+	return err
+}
+
+// IsAdmin reports whether userID may use the admin endpoints. It fails
+// with ErrNotFound for a user who has never been stored.
+func IsAdmin(ctx context.Context, db *DB, userID string) (_ bool, err error) {
+	ctx, end := db.startOp(ctx, "IsAdmin")
+	defer end(&err)
+	var isAdmin bool
+	err = db.QueryRowContext(ctx,
+		"SELECT is_admin FROM users WHERE id = ?",
+		userID,
+	).Scan(&isAdmin)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("user %s: %w", userID, ErrNotFound)
+	}
+	return isAdmin, err
+}
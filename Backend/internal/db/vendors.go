@@ -0,0 +1,45 @@
+// internal/db/vendors.go
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Vendor is a grower or shop whose items are sold here.
+type Vendor struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AddVendor creates a vendor. A name already taken is ErrConflict.
+func AddVendor(ctx context.Context, db *DB, name string) (_ Vendor, err error) {
+	ctx, end := db.startOp(ctx, "AddVendor")
+	defer end(&err)
+	v := Vendor{Name: name, CreatedAt: time.Now().UTC()}
+	v.ID, err = db.insertID(ctx, db,
+		"INSERT INTO vendors (name, created_at) VALUES (?, ?)", v.Name, v.CreatedAt,
+	)
+	return v, err
+}
+
+// ListVendors returns every vendor by name.
+func ListVendors(ctx context.Context, db *DB) (_ []Vendor, err error) {
+	ctx, end := db.startOp(ctx, "ListVendors")
+	defer end(&err)
+	rows, err := db.QueryContext(ctx, "SELECT id, name, created_at FROM vendors ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	vendors := []Vendor{}
+	for rows.Next() {
+		var v Vendor
+		if err := rows.Scan(&v.ID, &v.Name, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		vendors = append(vendors, v)
+	}
+	return vendors, rows.Err()
+}
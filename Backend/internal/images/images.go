@@ -0,0 +1,132 @@
+// internal/images/images.go
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+// Variant is one generated size of an uploaded image.
+type Variant struct {
+	Name    string // also the blob file name, e.g. "thumb.jpg"
+	MaxSide int    // longest edge in pixels; smaller images aren't enlarged
+}
+
+// Variants are generated for every upload, smallest first.
+var Variants = []Variant{
+	{Name: "thumb", MaxSide: 200},
+	{Name: "medium", MaxSide: 600},
+	{Name: "full", MaxSide: 1600},
+}
+
+// maxPixels bounds the decoded size so a small, highly compressed file
+// can't make us allocate gigabytes (a "decompression bomb").
+const maxPixels = 24_000_000
+
+// Errors from Process. Both mean the client sent something we won't
+// accept, not that the server failed.
+var (
+	ErrUnsupported = errors.New("image must be a JPEG, PNG or WebP file")
+	ErrInvalid     = errors.New("image could not be decoded")
+)
+
+// allowed maps sniffed content types to the image package format names.
+var allowed = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// Processed is a validated upload, re‑encoded in every Variant.
+type Processed struct {
+	Ext         string            // ".jpg", or ".png" for images with transparency
+	ContentType string            // of every variant
+	Files       map[string][]byte // variant name → encoded bytes
+}
+
+// Process validates an uploaded image and renders its variants.
+//
+// The type is decided by sniffing the bytes, never by the file name, and
+// only JPEG, PNG and WebP are accepted. The image is fully decoded and
+// then re‑encoded from pixels, so nothing but pixels survives: EXIF (GPS
+// position, camera serials, …), ICC profiles, comments and anything
+// smuggled after the image data are dropped. EXIF orientation is applied
+// first so phone photos stay upright.
+func Process(r io.Reader) (*Processed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	format, ok := allowed[http.DetectContentType(data)]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	cfg, cfgFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfgFormat != format {
+		return nil, ErrInvalid
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is too large", ErrInvalid, cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	if format == "jpeg" {
+		src = orient(src, exifOrientation(data))
+	}
+
+	out := &Processed{Ext: ".jpg", ContentType: "image/jpeg", Files: make(map[string][]byte, len(Variants))}
+	opaque := isOpaque(src)
+	if !opaque {
+		out.Ext, out.ContentType = ".png", "image/png"
+	}
+	for _, v := range Variants {
+		img := fit(src, v.MaxSide)
+		var buf bytes.Buffer
+		if opaque {
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		} else {
+			err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.Files[v.Name] = buf.Bytes()
+	}
+	return out, nil
+}
+
+// fit scales img down so its longest side is at most maxSide.
+func fit(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+	if w >= h {
+		w, h = maxSide, max(1, h*maxSide/w)
+	} else {
+		w, h = max(1, w*maxSide/h), maxSide
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
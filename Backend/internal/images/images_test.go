@@ -0,0 +1,163 @@
+// internal/images/images_test.go
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// gpsMarker stands in for a GPS position in the EXIF fixture.
+const gpsMarker = "GPS 51.5007N 0.1246W"
+
+// halves returns a w×h image, red on the left half and blue on the right.
+func halves(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// jpegWithExif encodes img as a JPEG with an APP1 EXIF segment holding
+// orientation o and gpsMarker, right after the SOI marker.
+func jpegWithExif(t *testing.T, img image.Image, o uint16) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := jpeg.Encode(&enc, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+
+	// little‑endian TIFF: header, IFD0 with one Orientation entry, then
+	// the marker standing in for a GPS IFD
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3) // SHORT
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, o)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // value padding, no next IFD
+	tiff = append(tiff, gpsMarker...)
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(seg)+2))
+	app1 = append(app1, seg...)
+
+	b := enc.Bytes()
+	return append(append(append([]byte{}, b[:2]...), app1...), b[2:]...)
+}
+
+// pngSized returns a 1×1 PNG whose header claims to be w×h.
+func pngSized(t *testing.T, w, h uint32) []byte {
+	t.Helper()
+	var enc bytes.Buffer
+	if err := png.Encode(&enc, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	b := enc.Bytes()
+	// signature (8), IHDR length (4), "IHDR" (4), width, height, …, CRC
+	binary.BigEndian.PutUint32(b[16:], w)
+	binary.BigEndian.PutUint32(b[20:], h)
+	binary.BigEndian.PutUint32(b[29:], crc32.ChecksumIEEE(b[12:29]))
+	return b
+}
+
+func TestProcessRejects(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, halves(8, 8), nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+		msg  string // in the error, when set
+	}{
+		{"HTML named photo.jpg", []byte("<!DOCTYPE html><script>alert(1)</script>"), ErrUnsupported, ""},
+		{"PDF", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"), ErrUnsupported, ""},
+		{"GIF", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), ErrUnsupported, ""},
+		{"empty", nil, ErrUnsupported, ""},
+		{"truncated JPEG", jpg.Bytes()[:40], ErrInvalid, ""},
+		{"decompression bomb", pngSized(t, 50_000, 50_000), ErrInvalid, "too large"},
+		{"just over maxPixels", pngSized(t, 6001, 4000), ErrInvalid, "too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Process(bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.want) || !strings.Contains(fmt.Sprint(err), tt.msg) {
+				t.Errorf("err %v, want %v %s", err, tt.want, tt.msg)
+			}
+		})
+	}
+}
+
+// TestProcessOrientation checks a JPEG tagged "rotated 90° CCW" comes out
+// upright: the red left half of the stored pixels ends up on top.
+func TestProcessOrientation(t *testing.T) {
+	out, err := Process(bytes.NewReader(jpegWithExif(t, halves(80, 40), 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out.Files["full"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 80 {
+		t.Fatalf("size %dx%d, want 40x80", b.Dx(), b.Dy())
+	}
+	for _, p := range []struct {
+		y       int
+		wantRed bool
+	}{{10, true}, {70, false}} {
+		r, _, b, _ := img.At(20, p.y).RGBA()
+		if isRed := r > b; isRed != p.wantRed {
+			t.Errorf("pixel (20,%d) r=%d b=%d, want red %v", p.y, r>>8, b>>8, p.wantRed)
+		}
+	}
+}
+
+// TestProcessStripsMetadata checks no variant keeps the EXIF segment.
+func TestProcessStripsMetadata(t *testing.T) {
+	in := jpegWithExif(t, halves(800, 400), 1)
+	if !bytes.Contains(in, []byte(gpsMarker)) {
+		t.Fatal("fixture lacks the GPS marker")
+	}
+	out, err := Process(bytes.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.ContentType != "image/jpeg" || out.Ext != ".jpg" {
+		t.Errorf("got %s %s, want image/jpeg .jpg", out.ContentType, out.Ext)
+	}
+	for _, v := range Variants {
+		f := out.Files[v.Name]
+		if len(f) == 0 {
+			t.Fatalf("no %s variant", v.Name)
+		}
+		if bytes.Contains(f, []byte("Exif\x00\x00")) || strings.Contains(string(f), gpsMarker) {
+			t.Errorf("%s still carries the EXIF segment", v.Name)
+		}
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := min(800, v.MaxSide); cfg.Width != want {
+			t.Errorf("%s is %d wide, want %d", v.Name, cfg.Width, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// internal/logging/logging.go
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// ctxKey is the type we use for context keys in this package
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	annotationsKey
+)
+
+// New builds a logger writing to w in the given format ("text" or "json").
+func New(w io.Writer, format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+}
+
+// ParseLevel turns "debug", "info", "warn" or "error" into a slog.Level.
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
+// WithLogger returns a copy of ctx carrying l.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the logger stored in ctx, or slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// annotations collects attributes discovered while handling a request
+// (e.g. the user ID once auth has run) for the request's access log line.
+type annotations struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// WithAnnotations returns a copy of ctx that Annotate can add to.
+func WithAnnotations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, annotationsKey, &annotations{})
+}
+
+// Annotate attaches attrs to the current request's access log entry. It
+// is a no‑op outside a request started with WithAnnotations.
+func Annotate(ctx context.Context, attrs ...slog.Attr) {
+	if a, ok := ctx.Value(annotationsKey).(*annotations); ok {
+		a.mu.Lock()
+		a.attrs = append(a.attrs, attrs...)
+		a.mu.Unlock()
+	}
+}
+
+// Annotations returns the attributes added with Annotate so far.
+func Annotations(ctx context.Context) []slog.Attr {
+	a, ok := ctx.Value(annotationsKey).(*annotations)
+	if !ok {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]slog.Attr(nil), a.attrs...)
+}
@@ -0,0 +1,91 @@
+// internal/metrics/metrics.go
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every Nexus Local metric. We use our own registry rather
+// than the global default so only what we register here is exposed.
+var Registry = prometheus.NewRegistry()
+
+// HTTP metrics
+var (
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "nexus",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+// Business metrics
+var (
+	OrdersPlaced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "nexus",
+		Name:      "orders_placed_total",
+		Help:      "Orders successfully placed.",
+	})
+	OrderValue = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "nexus",
+		Name:      "order_value_total",
+		Help:      "Summed value of placed orders, in store currency.",
+	})
+	StockOuts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "nexus",
+		Name:      "stockouts_total",
+		Help:      "Order attempts refused because an item was out of stock.",
+	})
+	HoldsExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "nexus",
+		Name:      "stock_holds_expired_total",
+		Help:      "Stock holds released by the reaper after they expired.",
+	})
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nexus",
+		Name:      "logins_total",
+		Help:      "OAuth sign-in callbacks by result (success or failure).",
+	}, []string{"result"})
+	Payments = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nexus",
+		Name:      "payment_operations_total",
+		Help:      "Payment gateway calls by operation (authorize, capture, void, refund) and result (success, declined or error).",
+	}, []string{"operation", "result"})
+	PaymentEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "nexus",
+		Name:      "payment_events_total",
+		Help:      "Verified payment webhook events by type and result (applied, ignored, unknown_payment or duplicate).",
+	}, []string{"type", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPDuration,
+		OrdersPlaced,
+		OrderValue,
+		StockOuts,
+		HoldsExpired,
+		Logins,
+		Payments,
+		PaymentEvents,
+	)
+}
+
+// RegisterDB exports sql.DBStats (open, in‑use and idle connections, wait
+// counts, …) for the pool db under the given database name.
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
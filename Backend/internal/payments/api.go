@@ -0,0 +1,126 @@
+// internal/payments/api.go
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// The provider HTTP API spoken by the HTTP gateway and served by Mock:
+//
+//	POST /v1/authorizations           AuthorizeRequest → 201 Authorization
+//	POST /v1/payments/{id}/capture    {"amount": n}    → 204
+//	POST /v1/payments/{id}/void                        → 204
+//	POST /v1/refunds                  RefundRequest    → 201 Refund
+//
+// Requests carry "Authorization: Bearer <api key>". Errors are
+// {"error": {"code": ..., "message": ...}}, with one code per sentinel
+// error so the client can hand back the same errors Mock returns.
+
+// Wire error codes.
+const (
+	codeDeclined     = "card_declined"
+	codeNotFound     = "not_found"
+	codeInvalid      = "invalid_request"
+	codeUnavailable  = "unavailable"
+	codeUnauthorized = "unauthorized"
+)
+
+type captureBody struct {
+	Amount int64 `json:"amount"`
+}
+
+type apiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newAPIMux serves the provider API on top of g.
+func newAPIMux(g Gateway) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/authorizations", func(w http.ResponseWriter, r *http.Request) {
+		var req AuthorizeRequest
+		if !decodeAPI(w, r, &req) {
+			return
+		}
+		a, err := g.Authorize(r.Context(), req)
+		respondAPI(w, http.StatusCreated, a, err)
+	})
+	mux.HandleFunc("POST /v1/payments/{id}/capture", func(w http.ResponseWriter, r *http.Request) {
+		var body captureBody
+		if !decodeAPI(w, r, &body) {
+			return
+		}
+		err := g.Capture(r.Context(), r.PathValue("id"), body.Amount)
+		respondAPI(w, http.StatusNoContent, nil, err)
+	})
+	mux.HandleFunc("POST /v1/payments/{id}/void", func(w http.ResponseWriter, r *http.Request) {
+		err := g.Void(r.Context(), r.PathValue("id"))
+		respondAPI(w, http.StatusNoContent, nil, err)
+	})
+	mux.HandleFunc("POST /v1/refunds", func(w http.ResponseWriter, r *http.Request) {
+		var req RefundRequest
+		if !decodeAPI(w, r, &req) {
+			return
+		}
+		ref, err := g.Refund(r.Context(), req)
+		respondAPI(w, http.StatusCreated, ref, err)
+	})
+	return mux
+}
+
+func decodeAPI(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(dst); err != nil {
+		writeAPIError(w, http.StatusBadRequest, codeInvalid, "malformed JSON body")
+		return false
+	}
+	return true
+}
+
+func respondAPI(w http.ResponseWriter, status int, v any, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDeclined):
+			writeAPIError(w, http.StatusPaymentRequired, codeDeclined, err.Error())
+		case errors.Is(err, ErrNotFound):
+			writeAPIError(w, http.StatusNotFound, codeNotFound, err.Error())
+		case errors.Is(err, ErrInvalidRequest):
+			writeAPIError(w, http.StatusBadRequest, codeInvalid, err.Error())
+		default:
+			writeAPIError(w, http.StatusServiceUnavailable, codeUnavailable, err.Error())
+		}
+		return
+	}
+	if v == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, msg string) {
+	var e apiError
+	e.Error.Code = code
+	e.Error.Message = msg
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// errorFor maps a wire error code back to its sentinel error.
+func errorFor(code string) error {
+	switch code {
+	case codeDeclined:
+		return ErrDeclined
+	case codeNotFound:
+		return ErrNotFound
+	case codeInvalid:
+		return ErrInvalidRequest
+	}
+	return ErrUnavailable
+}
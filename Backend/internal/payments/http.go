@@ -0,0 +1,104 @@
+// internal/payments/http.go
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"nexus.local/internal/tracing"
+)
+
+// HTTP is a Gateway that calls a provider over the HTTP API in api.go,
+// e.g. a Mock running as cmd/mockpay.
+type HTTP struct {
+	BaseURL       string // e.g. http://localhost:8090
+	APIKey        string
+	WebhookSecret []byte
+
+	// Timeout bounds each call; default 10s. A call that times out has an
+	// unknown outcome and fails with ErrUnavailable.
+	Timeout time.Duration
+
+	// Client defaults to tracing.HTTPClient.
+	Client *http.Client
+}
+
+func (h *HTTP) Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error) {
+	var a Authorization
+	if err := h.call(ctx, "/v1/authorizations", req, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (h *HTTP) Capture(ctx context.Context, paymentID string, amount int64) error {
+	return h.call(ctx, "/v1/payments/"+url.PathEscape(paymentID)+"/capture", captureBody{Amount: amount}, nil)
+}
+
+func (h *HTTP) Void(ctx context.Context, paymentID string) error {
+	return h.call(ctx, "/v1/payments/"+url.PathEscape(paymentID)+"/void", struct{}{}, nil)
+}
+
+func (h *HTTP) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	var r Refund
+	if err := h.call(ctx, "/v1/refunds", req, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (h *HTTP) VerifyWebhook(payload []byte, header http.Header) (*Event, error) {
+	return verifySignature(h.WebhookSecret, payload, header.Get(SignatureHeader), time.Now())
+}
+
+// call POSTs body as JSON to path and decodes a success response into out.
+func (h *HTTP) call(ctx context.Context, path string, body, out any) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(h.BaseURL, "/")+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.APIKey)
+	}
+	client := h.Client
+	if client == nil {
+		client = tracing.HTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e apiError
+		json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&e)
+		return fmt.Errorf("%w: %s %s: %s", errorFor(e.Error.Code), path, resp.Status, e.Error.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: decoding %s response: %v", ErrUnavailable, path, err)
+	}
+	return nil
+}
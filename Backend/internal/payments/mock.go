@@ -0,0 +1,201 @@
+// internal/payments/mock.go
+package payments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Payment sources with a fixed outcome at the mock gateway. Any other
+// source, including none, is approved.
+const (
+	MockDecline     = "tok_decline"     // Authorize fails with ErrDeclined
+	MockUnavailable = "tok_unavailable" // Authorize fails with ErrUnavailable
+)
+
+// Mock is a deterministic, in‑memory Gateway for development and tests:
+// outcomes depend only on the request (see MockDecline), and IDs are
+// derived from the request's Reference, so the same calls always produce
+// the same payments. It also serves the HTTP API the HTTP gateway speaks,
+// so it can run on its own as a stand‑in provider (see cmd/mockpay).
+type Mock struct {
+	// APIKey, if set, is required as a bearer token by the HTTP API.
+	APIKey string
+
+	// WebhookSecret signs and verifies webhook deliveries.
+	WebhookSecret []byte
+
+	// WebhookURL, if set, receives a signed event for every capture, void
+	// and refund, as a real provider would send.
+	WebhookURL string
+
+	mu       sync.Mutex
+	payments map[string]*mockPayment
+	refunds  map[string]*Refund // by payment ID + reference
+	mux      *http.ServeMux
+}
+
+type mockPayment struct {
+	Authorization
+	state    string // authorized, captured or voided
+	captured int64
+	refunded int64
+	events   int
+}
+
+// NewMock returns an empty mock gateway.
+func NewMock(webhookSecret string) *Mock {
+	m := &Mock{
+		WebhookSecret: []byte(webhookSecret),
+		payments:      make(map[string]*mockPayment),
+		refunds:       make(map[string]*Refund),
+	}
+	m.mux = newAPIMux(m)
+	return m
+}
+
+// mockID derives a stable ID from parts.
+func mockID(prefix string, parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return prefix + hex.EncodeToString(h.Sum(nil))[:24]
+}
+
+func (m *Mock) Authorize(_ context.Context, req AuthorizeRequest) (*Authorization, error) {
+	switch {
+	case req.Amount <= 0:
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidRequest)
+	case req.Currency == "" || req.Reference == "":
+		return nil, fmt.Errorf("%w: currency and reference are required", ErrInvalidRequest)
+	case req.Source == MockDecline:
+		return nil, ErrDeclined
+	case req.Source == MockUnavailable:
+		return nil, ErrUnavailable
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := mockID("pay_", req.Reference)
+	if p, ok := m.payments[id]; ok {
+		a := p.Authorization
+		return &a, nil
+	}
+	p := &mockPayment{
+		Authorization: Authorization{ID: id, Amount: req.Amount, Currency: req.Currency},
+		state:         "authorized",
+	}
+	m.payments[id] = p
+	a := p.Authorization
+	return &a, nil
+}
+
+func (m *Mock) Capture(_ context.Context, paymentID string, amount int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.payments[paymentID]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrNotFound, paymentID)
+	case p.state == "captured" && p.captured == amount:
+		return nil // a retry of the capture that succeeded
+	case p.state != "authorized":
+		return fmt.Errorf("%w: payment is %s", ErrInvalidRequest, p.state)
+	case amount <= 0 || amount > p.Amount:
+		return fmt.Errorf("%w: capture %d of %d authorized", ErrInvalidRequest, amount, p.Amount)
+	}
+	p.state = "captured"
+	p.captured = amount
+	m.emit(p, EventCaptured, amount)
+	return nil
+}
+
+func (m *Mock) Void(_ context.Context, paymentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.payments[paymentID]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrNotFound, paymentID)
+	case p.state == "voided":
+		return nil
+	case p.state != "authorized":
+		return fmt.Errorf("%w: payment is %s", ErrInvalidRequest, p.state)
+	}
+	p.state = "voided"
+	m.emit(p, EventVoided, 0)
+	return nil
+}
+
+func (m *Mock) Refund(_ context.Context, req RefundRequest) (*Refund, error) {
+	if req.Reference == "" {
+		return nil, fmt.Errorf("%w: reference is required", ErrInvalidRequest)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := req.PaymentID + "\x00" + req.Reference
+	if r, ok := m.refunds[key]; ok {
+		out := *r
+		return &out, nil
+	}
+	p, ok := m.payments[req.PaymentID]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, req.PaymentID)
+	case p.state != "captured":
+		return nil, fmt.Errorf("%w: payment is %s", ErrInvalidRequest, p.state)
+	case req.Amount <= 0 || p.refunded+req.Amount > p.captured:
+		return nil, fmt.Errorf("%w: refund %d with %d of %d left", ErrInvalidRequest,
+			req.Amount, p.captured-p.refunded, p.captured)
+	}
+	p.refunded += req.Amount
+	r := &Refund{ID: mockID("re_", req.PaymentID, req.Reference), Amount: req.Amount}
+	m.refunds[key] = r
+	m.emit(p, EventRefunded, p.refunded)
+	out := *r
+	return &out, nil
+}
+
+// emit delivers an event about p to WebhookURL in the background. Event
+// IDs are derived from the payment and its event count, so they are as
+// deterministic as the payments. Must be called with m.mu held.
+func (m *Mock) emit(p *mockPayment, typ string, amount int64) {
+	if m.WebhookURL == "" {
+		return
+	}
+	p.events++
+	ev := Event{
+		ID:        mockID("evt_", p.ID, strconv.Itoa(p.events)),
+		Type:      typ,
+		PaymentID: p.ID,
+		Amount:    amount,
+		Created:   time.Now().UTC(),
+	}
+	go func() {
+		if err := SendWebhook(context.Background(), http.DefaultClient, m.WebhookURL, m.WebhookSecret, ev); err != nil {
+			slog.Warn("mock webhook delivery failed", slog.String("event_id", ev.ID), slog.Any("error", err))
+		}
+	}()
+}
+
+func (m *Mock) VerifyWebhook(payload []byte, header http.Header) (*Event, error) {
+	return verifySignature(m.WebhookSecret, payload, header.Get(SignatureHeader), time.Now())
+}
+
+// ServeHTTP serves the provider API; see api.go.
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.APIKey != "" && r.Header.Get("Authorization") != "Bearer "+m.APIKey {
+		writeAPIError(w, http.StatusUnauthorized, codeUnauthorized, "missing or wrong API key")
+		return
+	}
+	m.mux.ServeHTTP(w, r)
+}
@@ -0,0 +1,224 @@
+// internal/payments/payments.go
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by a Gateway. Callers should test for them with
+// errors.Is, since they are usually wrapped with the provider's message.
+var (
+	// ErrDeclined means the payment method was refused; retrying the same
+	// request won't help.
+	ErrDeclined = errors.New("payment declined")
+
+	// ErrNotFound means the provider has no such payment.
+	ErrNotFound = errors.New("payment not found")
+
+	// ErrInvalidRequest means the provider rejected the request itself,
+	// e.g. capturing more than was authorized or refunding a voided payment.
+	ErrInvalidRequest = errors.New("invalid payment request")
+
+	// ErrUnavailable means the provider couldn't be reached or failed; the
+	// outcome of the request is unknown.
+	ErrUnavailable = errors.New("payment provider unavailable")
+
+	// ErrInvalidSignature means a webhook wasn't signed with our secret,
+	// or its timestamp is outside the tolerance.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// Gateway is a payment provider. Orders reserve money with Authorize when
+// they are placed, Capture takes it when the order is fulfilled, Void
+// releases an authorization that won't be captured and Refund returns
+// captured money. The provider reports changes it makes on its own through
+// signed webhooks, checked with VerifyWebhook.
+//
+// Amounts are in the currency's minor unit (cents), never floats.
+type Gateway interface {
+	// Authorize reserves req.Amount on the customer's payment method.
+	// Repeating a request with the same Reference returns the original
+	// authorization instead of making a second one.
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error)
+
+	// Capture takes amount (at most what was authorized) of an
+	// authorization.
+	Capture(ctx context.Context, paymentID string, amount int64) error
+
+	// Void releases an authorization that hasn't been captured.
+	Void(ctx context.Context, paymentID string) error
+
+	// Refund returns up to the captured amount of a payment to the
+	// customer. Repeating a request with the same Reference returns the
+	// original refund.
+	Refund(ctx context.Context, req RefundRequest) (*Refund, error)
+
+	// VerifyWebhook checks the signature of a webhook delivery and decodes
+	// its event.
+	VerifyWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// AuthorizeRequest asks for an authorization.
+type AuthorizeRequest struct {
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Source    string `json:"source"`    // tokenised payment method from the client
+	Reference string `json:"reference"` // our unique ID for the attempt
+}
+
+// Authorization is an amount reserved on a payment method.
+type Authorization struct {
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// RefundRequest asks for (part of) a captured payment back.
+type RefundRequest struct {
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Reference string `json:"reference"`
+}
+
+// Refund is money returned to the customer.
+type Refund struct {
+	ID     string `json:"id"`
+	Amount int64  `json:"amount"`
+}
+
+// Webhook event types.
+const (
+	EventAuthorized = "payment.authorized"
+	EventCaptured   = "payment.captured"
+	EventVoided     = "payment.voided"
+	EventRefunded   = "payment.refunded"
+	EventFailed     = "payment.failed"
+)
+
+// Event is a change to a payment reported by the provider.
+type Event struct {
+	ID        string `json:"id"` // unique per event; deliveries may repeat
+	Type      string `json:"type"`
+	PaymentID string `json:"payment_id"`
+
+	// Amount is the amount captured for payment.captured and the payment's
+	// refunded total so far (not just this refund) for payment.refunded,
+	// so applying events out of order still ends in the right state.
+	Amount  int64     `json:"amount"`
+	Created time.Time `json:"created"`
+}
+
+// Cents converts an amount in major units to minor units, rounding half
+// away from zero.
+func Cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// SignatureHeader carries a webhook's signature, in the form
+// "t=<unix seconds>,v1=<hex HMAC‑SHA256 of "<t>.<body>">".
+const SignatureHeader = "Payment-Signature"
+
+// WebhookTolerance is how far a webhook's timestamp may be from our clock.
+// It bounds how long a captured delivery can be replayed.
+const WebhookTolerance = 5 * time.Minute
+
+// Sign returns the SignatureHeader value for payload sent at t.
+func Sign(secret []byte, t time.Time, payload []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(signature(secret, ts, payload))
+}
+
+func signature(secret []byte, ts string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// verifySignature checks header against payload at time now, and decodes
+// the event. Several v1 entries are allowed, so a secret can be rotated
+// while old deliveries are still in flight. Without a secret every
+// delivery is rejected: anyone can sign with an empty key.
+func verifySignature(secret []byte, payload []byte, header string, now time.Time) (*Event, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%w: no webhook secret configured", ErrInvalidSignature)
+	}
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return nil, fmt.Errorf("%w: malformed %s header", ErrInvalidSignature, SignatureHeader)
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > WebhookTolerance || d < -WebhookTolerance {
+		return nil, fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+	want := signature(secret, ts, payload)
+	ok := false
+	for _, sig := range sigs {
+		ok = ok || hmac.Equal(sig, want)
+	}
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+	var ev Event
+	if err := json.Unmarshal(payload, &ev); err != nil || ev.ID == "" || ev.Type == "" {
+		return nil, fmt.Errorf("%w: malformed event", ErrInvalidRequest)
+	}
+	return &ev, nil
+}
+
+// SendWebhook delivers ev to url signed with secret, the way a provider
+// does. It is used by the mock gateway and to replay stored events.
+func SendWebhook(ctx context.Context, client *http.Client, url string, secret []byte, ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return SendPayload(ctx, client, url, secret, payload)
+}
+
+// SendPayload delivers an already encoded event, freshly signed.
+func SendPayload(ctx context.Context, client *http.Client, url string, secret []byte, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(secret, time.Now(), payload))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// internal/payments/payments_test.go
+package payments
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("whsec_new")
+	old := []byte("whsec_old")
+	now := time.Unix(1_800_000_000, 0)
+	payload := []byte(`{"id":"evt_1","type":"payment.captured","payment_id":"pay_1","amount":500}`)
+
+	// v1 signs payload at t with secret, for building headers by hand
+	v1 := func(secret []byte, t time.Time) string {
+		return "v1=" + hex.EncodeToString(signature(secret, strconv.FormatInt(t.Unix(), 10), payload))
+	}
+	ts := func(t time.Time) string { return "t=" + strconv.FormatInt(t.Unix(), 10) }
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		payload []byte
+		header  string
+		want    error
+	}{
+		{"valid", secret, payload, Sign(secret, now, payload), nil},
+		{"spaces around entries", secret, payload, ts(now) + ", " + v1(secret, now), nil},
+		{"at the edge of the tolerance", secret, payload, Sign(secret, now.Add(-WebhookTolerance), payload), nil},
+		{"rotated: old and new signature", secret, payload, ts(now) + "," + v1(old, now) + "," + v1(secret, now), nil},
+		{"rotated: the old secret still verifies", old, payload, ts(now) + "," + v1(old, now) + "," + v1(secret, now), nil},
+		{"rotated: neither matches", secret, payload, ts(now) + "," + v1(old, now) + "," + v1([]byte("other"), now), ErrInvalidSignature},
+		{"bad MAC", secret, payload, ts(now) + ",v1=" + hex.EncodeToString(make([]byte, 32)), ErrInvalidSignature},
+		{"signed with another secret", secret, payload, Sign(old, now, payload), ErrInvalidSignature},
+		{"body changed", secret, []byte(`{"id":"evt_1","type":"payment.captured","payment_id":"pay_1","amount":50000}`), Sign(secret, now, payload), ErrInvalidSignature},
+		{"timestamp changed", secret, payload, ts(now.Add(time.Second)) + "," + v1(secret, now), ErrInvalidSignature},
+		{"stale", secret, payload, Sign(secret, now.Add(-WebhookTolerance-time.Second), payload), ErrInvalidSignature},
+		{"from the future", secret, payload, Sign(secret, now.Add(WebhookTolerance+time.Second), payload), ErrInvalidSignature},
+		{"no timestamp", secret, payload, v1(secret, now), ErrInvalidSignature},
+		{"no signature", secret, payload, ts(now), ErrInvalidSignature},
+		{"not hex", secret, payload, ts(now) + ",v1=zz", ErrInvalidSignature},
+		{"empty header", secret, payload, "", ErrInvalidSignature},
+		{"empty secret", nil, payload, Sign(nil, now, payload), ErrInvalidSignature},
+		{"not an event", secret, []byte(`{"hello":1}`), Sign(secret, now, []byte(`{"hello":1}`)), ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := verifySignature(tt.secret, tt.payload, tt.header, now)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) || ev != nil {
+					t.Errorf("got %+v, %v; want %v", ev, err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.ID != "evt_1" || ev.Type != EventCaptured || ev.PaymentID != "pay_1" || ev.Amount != 500 {
+				t.Errorf("event %+v", ev)
+			}
+		})
+	}
+}
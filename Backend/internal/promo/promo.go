@@ -0,0 +1,139 @@
+// internal/promo/promo.go
+package promo
+
+import (
+	"strings"
+	"time"
+)
+
+// Kind is how a promotion discounts the lines it applies to.
+type Kind string
+
+const (
+	Percent  Kind = "percent"     // Value basis points off (1000 is 10%)
+	Fixed    Kind = "fixed"       // Value cents off, spread over the lines
+	BuyXGetY Kind = "buy_x_get_y" // every Buy+Get units of a line, Get are free
+)
+
+// Valid reports whether k is one of the kinds above.
+func (k Kind) Valid() bool {
+	switch k {
+	case Percent, Fixed, BuyXGetY:
+		return true
+	}
+	return false
+}
+
+// Promotion is a discount, either applied automatically to every order it
+// fits or, with a Code, only to orders that quote it.
+type Promotion struct {
+	ID   int64  `json:"id"`
+	Code string `json:"code,omitempty"` // empty for an automatic promotion
+	Name string `json:"name"`
+	Kind Kind   `json:"kind"`
+
+	Value       int64 `json:"value,omitempty"` // see Kind
+	BuyQuantity int   `json:"buy_quantity,omitempty"`
+	GetQuantity int   `json:"get_quantity,omitempty"`
+
+	// Conditions. A zero value means no condition; with both VendorID and
+	// ItemID, a line must match both.
+	MinOrder       int64      `json:"min_order,omitempty"` // subtotal in cents
+	VendorID       int64      `json:"vendor_id,omitempty"`
+	ItemID         int        `json:"item_id,omitempty"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	MaxUses        int        `json:"max_uses,omitempty"`
+	MaxUsesPerUser int        `json:"max_uses_per_user,omitempty"`
+
+	Uses      int       `json:"uses"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NormalizeCode makes codes case‑insensitive: "summer10 " is "SUMMER10".
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Live reports whether p is active and inside its validity window at now.
+func (p Promotion) Live(now time.Time) bool {
+	switch {
+	case !p.Active:
+		return false
+	case p.StartsAt != nil && now.Before(*p.StartsAt):
+		return false
+	case p.EndsAt != nil && !now.Before(*p.EndsAt):
+		return false
+	}
+	return true
+}
+
+// Line is an order line as promotions see it. Discount is what earlier
+// promotions already took off; a line is never discounted below zero.
+type Line struct {
+	ItemID    int
+	VendorID  int64
+	Quantity  int
+	UnitPrice int64
+	Discount  int64
+}
+
+func (l Line) left() int64 { return l.UnitPrice*int64(l.Quantity) - l.Discount }
+
+// Applies reports whether p covers line l.
+func (p Promotion) Applies(l Line) bool {
+	return (p.ItemID == 0 || p.ItemID == l.ItemID) && (p.VendorID == 0 || p.VendorID == l.VendorID)
+}
+
+// Apply takes p off the lines it covers, adding to each line's Discount,
+// and returns the total taken off. Conditions other than the lines' scope
+// (MinOrder, the window, usage caps) are the caller's to check.
+func (p Promotion) Apply(lines []Line) int64 {
+	var total int64
+	take := func(l *Line, off int64) {
+		off = min(off, l.left())
+		if off > 0 {
+			l.Discount += off
+			total += off
+		}
+	}
+	switch p.Kind {
+	case Percent:
+		for i := range lines {
+			if p.Applies(lines[i]) {
+				take(&lines[i], lines[i].left()*p.Value/10000)
+			}
+		}
+	case BuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return 0
+		}
+		for i := range lines {
+			if p.Applies(lines[i]) {
+				free := lines[i].Quantity / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+				take(&lines[i], int64(free)*lines[i].UnitPrice)
+			}
+		}
+	case Fixed:
+		// spread Value over the covered lines by what is left of them, the
+		// last line taking the remainder so the parts add up
+		var base int64
+		var covered []int
+		for i := range lines {
+			if p.Applies(lines[i]) && lines[i].left() > 0 {
+				base += lines[i].left()
+				covered = append(covered, i)
+			}
+		}
+		off := min(p.Value, base)
+		for n, i := range covered {
+			part := off * lines[i].left() / base
+			if n == len(covered)-1 {
+				part = off - total
+			}
+			take(&lines[i], part)
+		}
+	}
+	return total
+}
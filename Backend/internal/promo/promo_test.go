@@ -0,0 +1,107 @@
+// internal/promo/promo_test.go
+package promo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	// 5 eggs from vendor 1 and a mug from vendor 2: 2000 + 900
+	order := func() []Line {
+		return []Line{
+			{ItemID: 1, VendorID: 1, Quantity: 5, UnitPrice: 400},
+			{ItemID: 2, VendorID: 2, Quantity: 1, UnitPrice: 900},
+		}
+	}
+	tests := []struct {
+		name  string
+		p     Promotion
+		lines []Line        // order() if nil
+		want  map[int]int64 // discount by item, if changed
+	}{
+		{"percent", Promotion{Kind: Percent, Value: 1000}, nil, map[int]int64{1: 200, 2: 90}},
+		{"percent of one vendor", Promotion{Kind: Percent, Value: 1000, VendorID: 2}, nil, map[int]int64{2: 90}},
+		{"percent of one item", Promotion{Kind: Percent, Value: 2500, ItemID: 1}, nil, map[int]int64{1: 500}},
+		{"item and vendor must both match", Promotion{Kind: Percent, Value: 1000, ItemID: 1, VendorID: 2}, nil, map[int]int64{}},
+		{"percent rounds down", Promotion{Kind: Percent, Value: 333}, nil, map[int]int64{1: 66, 2: 29}},
+		{"percent of what is left", Promotion{Kind: Percent, Value: 1000},
+			[]Line{{ItemID: 1, Quantity: 5, UnitPrice: 400, Discount: 1500}}, map[int]int64{1: 1500 + 50}},
+		{"fixed, spread by line", Promotion{Kind: Fixed, Value: 1000}, nil, map[int]int64{1: 689, 2: 311}},
+		{"fixed, capped at the lines", Promotion{Kind: Fixed, Value: 5000}, nil, map[int]int64{1: 2000, 2: 900}},
+		{"fixed on one item", Promotion{Kind: Fixed, Value: 500, ItemID: 2}, nil, map[int]int64{2: 500}},
+		{"fixed skips paid-off lines", Promotion{Kind: Fixed, Value: 300},
+			[]Line{{ItemID: 1, Quantity: 1, UnitPrice: 400, Discount: 400}, {ItemID: 2, Quantity: 1, UnitPrice: 900}},
+			map[int]int64{1: 400, 2: 300}},
+		{"buy 2 get 1", Promotion{Kind: BuyXGetY, BuyQuantity: 2, GetQuantity: 1}, nil, map[int]int64{1: 400}},
+		{"buy 1 get 1", Promotion{Kind: BuyXGetY, BuyQuantity: 1, GetQuantity: 1}, nil, map[int]int64{1: 800}},
+		{"buy 2 get 1, never below zero", Promotion{Kind: BuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			[]Line{{ItemID: 1, Quantity: 3, UnitPrice: 400, Discount: 1000}}, map[int]int64{1: 1200}},
+		{"buy 0", Promotion{Kind: BuyXGetY, GetQuantity: 1}, nil, map[int]int64{}},
+		{"unknown kind", Promotion{Kind: "bogus", Value: 1000}, nil, map[int]int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := tt.lines
+			if lines == nil {
+				lines = order()
+			}
+			before := make(map[int]int64, len(lines))
+			for _, l := range lines {
+				before[l.ItemID] = l.Discount
+			}
+			total := tt.p.Apply(lines)
+
+			var want int64
+			for _, l := range lines {
+				d, ok := tt.want[l.ItemID]
+				if !ok {
+					d = before[l.ItemID]
+				}
+				if l.Discount != d {
+					t.Errorf("item %d discount %d, want %d", l.ItemID, l.Discount, d)
+				}
+				want += d - before[l.ItemID]
+			}
+			if total != want {
+				t.Errorf("took off %d, want %d", total, want)
+			}
+		})
+	}
+}
+
+func TestLive(t *testing.T) {
+	start := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	window := Promotion{Active: true, StartsAt: &start, EndsAt: &end}
+	tests := []struct {
+		name string
+		p    Promotion
+		now  time.Time
+		want bool
+	}{
+		{"no window", Promotion{Active: true}, start, true},
+		{"inactive", Promotion{}, start, false},
+		{"before the start", window, start.Add(-time.Second), false},
+		{"at the start", window, start, true},
+		{"inside", window, start.AddDate(0, 0, 10), true},
+		{"at the end", window, end, false},
+		{"after the end", window, end.Add(time.Hour), false},
+		{"open-ended", Promotion{Active: true, StartsAt: &start}, end.AddDate(1, 0, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.Live(tt.now); got != tt.want {
+				t.Errorf("Live(%s) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	for in, want := range map[string]string{"summer10 ": "SUMMER10", " Summer10": "SUMMER10", "": ""} {
+		if got := NormalizeCode(in); got != want {
+			t.Errorf("NormalizeCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
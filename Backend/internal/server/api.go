@@ -0,0 +1,616 @@
+// internal/server/api.go
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"nexus.local/internal/buildinfo"
+	"nexus.local/internal/db"
+	"nexus.local/internal/payments"
+	"nexus.local/internal/promo"
+	"nexus.local/internal/tax"
+)
+
+// access says who may call an endpoint.
+type access int
+
+const (
+	public     access = iota // anyone
+	signedIn                 // valid id_token cookie, checked by the handler
+	adminOnly                // wrapped in AuthMiddleware
+	graphToken               // access_token cookie, forwarded to MS Graph
+)
+
+// param documents a query parameter.
+type param struct {
+	Name        string
+	Description string
+	Type        string // "integer" or "string"
+	Required    bool
+}
+
+// oneOf lets an endpoint document several possible response shapes.
+type oneOf []any
+
+// endpoint is one method + path of the HTTP API. routes() mounts every
+// endpoint and openapi.go documents the very same list, so what we serve
+// and what we publish can't drift apart.
+type endpoint struct {
+	Method  string
+	Path    string
+	Summary string
+	Access  access
+	Query   []param
+
+	// Unversioned endpoints stay at the root instead of under apiPrefix;
+	// used for the browser sign‑in flow, whose URLs are registered with
+	// Azure AD.
+	Unversioned bool
+
+	Body  any      // JSON request body (a zero value), or nil
+	Form  any      // multipart form request (a zero value), or nil
+	Files []string // file parts of Form
+
+	Status int // success status
+	Result any // success body (a zero value, or oneOf), nil for none
+
+	Handler http.HandlerFunc
+}
+
+// endpoints lists the public API.
+func (s *Server) endpoints() []endpoint {
+	orderID := param{Name: "order_id", Description: "order to act on", Type: "integer"}
+	return []endpoint{
+		// OAuth endpoints
+		{
+			Method:      http.MethodGet,
+			Path:        "/login",
+			Summary:     "Redirect to Microsoft sign-in",
+			Unversioned: true,
+			Status:      http.StatusFound,
+			Handler:     s.AuthApp.Login,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/redirect",
+			Summary:     "OAuth callback; sets the auth cookies and redirects to the frontend",
+			Query:       []param{{Name: "code", Description: "authorization code", Type: "string", Required: true}},
+			Unversioned: true,
+			Status:      http.StatusFound,
+			Handler:     s.AuthApp.OAuthCallback,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/logout",
+			Summary: "Clear the auth cookies",
+			Status:  http.StatusNoContent,
+			Handler: s.logoutHandler,
+		},
+
+		// CRUD endpoints
+		{
+			Method:  http.MethodGet,
+			Path:    "/items",
+			Summary: "List all items",
+			Status:  http.StatusOK,
+			Result:  []db.Item{},
+			Handler: s.getItemsHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/items/add",
+			Summary: "Add an item, optionally with a JPEG, PNG or WebP image (resized to thumb, medium and full variants)",
+			Access:  adminOnly,
+			Form:    addItemReq{},
+			Files:   []string{"image"},
+			Status:  http.StatusCreated,
+			Result:  itemCreated{},
+			Handler: s.addItemHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/items/update",
+			Summary: "Set an item's stock and return all items",
+			Access:  adminOnly,
+			Body:    stockUpdateReq{},
+			Status:  http.StatusOK,
+			Result:  []db.Item{},
+			Handler: s.updateStockHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/items/images",
+			Summary: "Add an image to an item's gallery; an item's first image becomes its primary one",
+			Access:  adminOnly,
+			Form:    addImageReq{},
+			Files:   []string{"image"},
+			Status:  http.StatusCreated,
+			Result:  db.ItemImage{},
+			Handler: s.addItemImageHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/items/images/reorder",
+			Summary: "Set the display order of an item's gallery and optionally its primary image",
+			Access:  adminOnly,
+			Body:    reorderImagesReq{},
+			Status:  http.StatusOK,
+			Result:  []db.ItemImage{},
+			Handler: s.reorderItemImagesHandler,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/items/images",
+			Summary: "Remove an image from an item's gallery",
+			Access:  adminOnly,
+			Query: []param{
+				{Name: "item_id", Description: "item the image belongs to", Type: "integer", Required: true},
+				{Name: "image_id", Description: "image to remove", Type: "integer", Required: true},
+			},
+			Status:  http.StatusNoContent,
+			Handler: s.deleteItemImageHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/items/tax",
+			Summary: "Set an item's vendor and tax category",
+			Access:  adminOnly,
+			Body:    itemTaxReq{},
+			Status:  http.StatusOK,
+			Result:  db.Item{},
+			Handler: s.setItemTaxHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/vendors",
+			Summary: "List vendors",
+			Access:  public,
+			Status:  http.StatusOK,
+			Result:  []db.Vendor{},
+			Handler: s.getVendorsHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/vendors",
+			Summary: "Add a vendor",
+			Access:  adminOnly,
+			Body:    addVendorReq{},
+			Status:  http.StatusCreated,
+			Result:  db.Vendor{},
+			Handler: s.addVendorHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/vendors/staff",
+			Summary: "Make a signed-in user one of a vendor's staff, or nobody's with vendor_id 0",
+			Access:  adminOnly,
+			Body:    vendorStaffReq{},
+			Status:  http.StatusNoContent,
+			Handler: s.setVendorStaffHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/cart",
+			Summary: "Show the caller's cart: their own when signed in, else the one named by the cart_token cookie",
+			Status:  http.StatusOK,
+			Result:  cartView{},
+			Handler: s.getCartHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/cart/items",
+			Summary: "Add a quantity of an item to the cart, creating an anonymous cart if needed",
+			Body:    cartLineReq{},
+			Status:  http.StatusOK,
+			Result:  cartView{},
+			Handler: s.addCartItemHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/cart/items/update",
+			Summary: "Set the quantity of an item in the cart",
+			Body:    cartLineReq{},
+			Status:  http.StatusOK,
+			Result:  cartView{},
+			Handler: s.updateCartItemHandler,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/cart/items",
+			Summary: "Remove an item from the cart",
+			Query:   []param{{Name: "item_id", Description: "item to remove", Type: "integer", Required: true}},
+			Status:  http.StatusOK,
+			Result:  cartView{},
+			Handler: s.removeCartItemHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/cart/checkout",
+			Summary: "Pay for everything in the caller's cart, place it as an order and empty the cart",
+			Access:  signedIn,
+			Body:    checkoutReq{},
+			Status:  http.StatusCreated,
+			Result:  orderCreated{},
+			Handler: s.checkoutHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/cart/hold",
+			Summary: "Hold the stock of everything in the caller's cart for a while, so checkout can't run out of it; posting again renews the hold. Anonymous carts hold up to 10 of each item and renew twice",
+			Status:  http.StatusOK,
+			Result:  []db.Hold{},
+			Handler: s.holdCartHandler,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/cart/hold",
+			Summary: "Release the stock the caller's cart holds",
+			Status:  http.StatusNoContent,
+			Handler: s.releaseCartHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/orders",
+			Summary: "List the caller's orders, or fetch one with order_id",
+			Access:  signedIn,
+			Query:   []param{orderID},
+			Status:  http.StatusOK,
+			Result:  oneOf{[]db.Order{}, orderDetail{}},
+			Handler: s.getOrdersHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/orders",
+			Summary: "Authorize the payment and place an order; stock is only committed once the payment is authorized",
+			Access:  signedIn,
+			Body:    orderReq{},
+			Status:  http.StatusCreated,
+			Result:  orderCreated{},
+			Handler: s.placeOrderHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/orders/hold",
+			Summary: "Hold stock of items for the caller's next order for a while, replacing what they held before",
+			Access:  signedIn,
+			Body:    holdReq{},
+			Status:  http.StatusOK,
+			Result:  []db.Hold{},
+			Handler: s.holdOrderHandler,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/orders/hold",
+			Summary: "Release the stock the caller holds for their next order",
+			Access:  signedIn,
+			Status:  http.StatusNoContent,
+			Handler: s.releaseOrderHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/orders/quote",
+			Summary: "Price, discount and tax an order, with its pickup or delivery fee, without placing it",
+			Access:  public,
+			Body:    quoteReq{},
+			Status:  http.StatusOK,
+			Result:  db.Quote{},
+			Handler: s.quoteOrderHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/orders/capture",
+			Summary: "Capture an order's authorized payment",
+			Access:  adminOnly,
+			Body:    captureReq{},
+			Status:  http.StatusOK,
+			Result:  db.Order{},
+			Handler: s.captureOrderHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/orders/refund",
+			Summary: "Refund a whole order, or quantities of some of its lines, optionally restocking them",
+			Access:  adminOnly,
+			Body:    refundReq{},
+			Status:  http.StatusCreated,
+			Result:  refundResult{},
+			Handler: s.refundOrderHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/orders/refund/retry",
+			Summary: "Send a refund left pending by a payment provider outage again",
+			Access:  adminOnly,
+			Body:    retryRefundReq{},
+			Status:  http.StatusOK,
+			Result:  refundResult{},
+			Handler: s.retryRefundHandler,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/orders",
+			Summary: "Delete one of the caller's orders, voiding its payment; paid orders can't be deleted, only refunded",
+			Access:  signedIn,
+			Query:   []param{{Name: "order_id", Description: "order to delete", Type: "integer", Required: true}},
+			Status:  http.StatusNoContent,
+			Handler: s.deleteOrderHandler,
+		},
+
+		// Tax configuration and reporting
+		{
+			Method:  http.MethodGet,
+			Path:    "/tax/rates",
+			Summary: "List tax rates",
+			Access:  adminOnly,
+			Status:  http.StatusOK,
+			Result:  []tax.Rate{},
+			Handler: s.getTaxRatesHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/tax/rates",
+			Summary: "Set the tax rate for a category in a jurisdiction (postal-code prefix), optionally for one vendor",
+			Access:  adminOnly,
+			Body:    taxRateReq{},
+			Status:  http.StatusOK,
+			Result:  tax.Rate{},
+			Handler: s.putTaxRateHandler,
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/tax/rates",
+			Summary: "Remove a tax rate",
+			Access:  adminOnly,
+			Query:   []param{{Name: "id", Description: "rate to remove", Type: "integer", Required: true}},
+			Status:  http.StatusNoContent,
+			Handler: s.deleteTaxRateHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/reports/tax",
+			Summary: "Tax collected per vendor, jurisdiction and category over a period, net of refunds",
+			Access:  adminOnly,
+			Query: []param{
+				{Name: "from", Description: "first day (YYYY-MM-DD); default the start of this month", Type: "string"},
+				{Name: "to", Description: "day after the last (YYYY-MM-DD); default a month after from", Type: "string"},
+				{Name: "vendor_id", Description: "only this vendor's sales", Type: "integer"},
+			},
+			Status:  http.StatusOK,
+			Result:  taxReport{},
+			Handler: s.taxReportHandler,
+		},
+
+		// Promotions: promo codes and automatic discounts
+		{
+			Method:  http.MethodGet,
+			Path:    "/promotions",
+			Summary: "List promotions with their usage",
+			Access:  adminOnly,
+			Status:  http.StatusOK,
+			Result:  []promo.Promotion{},
+			Handler: s.getPromotionsHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/promotions",
+			Summary: "Create a promotion; without a code it applies automatically to every order it fits",
+			Access:  adminOnly,
+			Body:    addPromotionReq{},
+			Status:  http.StatusCreated,
+			Result:  promo.Promotion{},
+			Handler: s.addPromotionHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/promotions/active",
+			Summary: "Switch a promotion on or off",
+			Access:  adminOnly,
+			Body:    promotionActiveReq{},
+			Status:  http.StatusNoContent,
+			Handler: s.setPromotionActiveHandler,
+		},
+
+		// Vendor staff: each vendor's part of the orders it sells into
+		{
+			Method:  http.MethodGet,
+			Path:    "/vendor/orders",
+			Summary: "List the caller's vendor's sub-orders with only its own lines",
+			Access:  signedIn,
+			Query: []param{
+				{Name: "status", Description: "only sub-orders in this status", Type: "string"},
+				{Name: "vendor_id", Description: "admins only: the vendor to list", Type: "integer"},
+			},
+			Status:  http.StatusOK,
+			Result:  []db.VendorOrder{},
+			Handler: s.getVendorOrdersHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/vendor/orders/status",
+			Summary: "Move a sub-order on: pending, accepted, ready, fulfilled, or cancelled before it is ready",
+			Access:  signedIn,
+			Body:    subOrderStatusReq{},
+			Status:  http.StatusOK,
+			Result:  db.SubOrder{},
+			Handler: s.setSubOrderStatusHandler,
+		},
+
+		// Fulfillment: pickup locations, delivery zones and their time slots
+		{
+			Method:  http.MethodGet,
+			Path:    "/fulfillment/options",
+			Summary: "List active pickup locations and delivery zones with their fees",
+			Access:  public,
+			Query:   []param{{Name: "vendor_id", Description: "only this vendor's options", Type: "integer"}},
+			Status:  http.StatusOK,
+			Result:  []db.FulfillmentOption{},
+			Handler: s.getFulfillmentOptionsHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/fulfillment/options",
+			Summary: "Create a pickup location or delivery zone: vendor staff for their vendor, admins for any or the store",
+			Access:  signedIn,
+			Body:    fulfillmentOptionReq{},
+			Status:  http.StatusCreated,
+			Result:  db.FulfillmentOption{},
+			Handler: s.addFulfillmentOptionHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/fulfillment/options/active",
+			Summary: "Switch a pickup location or delivery zone on or off: vendor staff their vendor's, admins any",
+			Access:  signedIn,
+			Body:    fulfillmentActiveReq{},
+			Status:  http.StatusNoContent,
+			Handler: s.setFulfillmentOptionActiveHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/fulfillment/slots",
+			Summary: "List an option's upcoming time slots and the room left in each",
+			Access:  public,
+			Query: []param{
+				{Name: "option_id", Description: "pickup location or delivery zone", Type: "integer", Required: true},
+				{Name: "days", Description: "how far ahead to look, 1 to 90; default 14", Type: "integer"},
+			},
+			Status:  http.StatusOK,
+			Result:  []db.Slot{},
+			Handler: s.getSlotsHandler,
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/fulfillment/slots",
+			Summary: "Create a time slot taking up to capacity orders: vendor staff for their vendor's options, admins any",
+			Access:  signedIn,
+			Body:    slotReq{},
+			Status:  http.StatusCreated,
+			Result:  db.Slot{},
+			Handler: s.addSlotHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/reports/picklist",
+			Summary: "A day's pick list: per time slot, the items to pick and the orders to pack; vendor staff get their vendor's",
+			Access:  signedIn,
+			Query: []param{
+				{Name: "date", Description: "the day (YYYY-MM-DD, UTC); default today", Type: "string"},
+				{Name: "vendor_id", Description: "admins only: only this vendor's slots", Type: "integer"},
+			},
+			Status:  http.StatusOK,
+			Result:  []db.PickSlot{},
+			Handler: s.pickListHandler,
+		},
+
+		// Payment provider callbacks; the URL is registered with the provider
+		{
+			Method:      http.MethodPost,
+			Path:        "/webhooks/payments",
+			Summary:     "Receive a signed payment event (Payment-Signature header) and apply it to its order once",
+			Unversioned: true,
+			Body:        payments.Event{},
+			Status:      http.StatusOK,
+			Result:      webhookAck{},
+			Handler:     s.paymentWebhookHandler,
+		},
+
+		// Health and build info, for orchestrators and uptime checks
+		{
+			Method:      http.MethodGet,
+			Path:        "/healthz",
+			Summary:     "Liveness probe",
+			Unversioned: true,
+			Status:      http.StatusOK,
+			Result:      healthStatus{},
+			Handler:     s.healthzHandler,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/readyz",
+			Summary:     "Readiness probe: database, migrations and OIDC signing keys (503 if any check fails)",
+			Unversioned: true,
+			Status:      http.StatusOK,
+			Result:      readiness{},
+			Handler:     s.readyzHandler,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/version",
+			Summary:     "Build version, commit and Go version",
+			Unversioned: true,
+			Status:      http.StatusOK,
+			Result:      buildinfo.Info{},
+			Handler:     s.versionHandler,
+		},
+
+		// Graph profile + DB upsert
+		{
+			Method:  http.MethodGet,
+			Path:    "/me",
+			Summary: "Fetch the caller's Microsoft profile and store it",
+			Access:  graphToken,
+			Status:  http.StatusOK,
+			Result:  GraphUser{},
+			Handler: s.profileHandler,
+		},
+	}
+}
+
+// handleMux is what mount registers handlers on: an *http.ServeMux, or
+// in tests a recorder of what would be served.
+type handleMux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// mount registers eps on mux under apiPrefix, one handler per path that
+// dispatches on the method and answers anything else with a JSON 405.
+// Each path is also kept at its old root location as a deprecated alias.
+func (s *Server) mount(mux handleMux, eps []endpoint) {
+	byPath := make(map[string][]endpoint)
+	var paths []string
+	for _, ep := range eps {
+		if _, ok := byPath[ep.Path]; !ok {
+			paths = append(paths, ep.Path)
+		}
+		byPath[ep.Path] = append(byPath[ep.Path], ep)
+	}
+	for _, path := range paths {
+		h := s.dispatch(byPath[path])
+		if byPath[path][0].Unversioned {
+			mux.Handle(path, h)
+			continue
+		}
+		h = withAPIVersion(1, h)
+		mux.Handle(apiPrefix+path, h)
+		mux.Handle(path, deprecated(apiPrefix+path, h))
+	}
+}
+
+func (s *Server) dispatch(eps []endpoint) http.Handler {
+	handlers := make(map[string]http.Handler, len(eps))
+	var allow []string
+	for _, ep := range eps {
+		var h http.Handler = ep.Handler
+		if ep.Access == adminOnly {
+			h = s.AuthApp.AuthMiddleware(h)
+		}
+		if _, dup := handlers[ep.Method]; dup {
+			panic("server: duplicate endpoint " + ep.Method + " " + ep.Path)
+		}
+		handlers[ep.Method] = h
+		allow = append(allow, ep.Method)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := handlers[r.Method]
+		if !ok && r.Method == http.MethodHead {
+			h, ok = handlers[http.MethodGet]
+		}
+		if !ok {
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+// internal/server/api_test.go
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"nexus.local/internal/auth"
+)
+
+// routeRecorder keeps what mount registers, by pattern.
+type routeRecorder map[string]http.Handler
+
+func (rr routeRecorder) Handle(pattern string, h http.Handler) { rr[pattern] = h }
+
+// TestOpenAPIMatchesRoutes checks the published spec against what is
+// actually served: every mounted path is in the spec with the same
+// methods and vice versa, and admin‑only operations are exactly the ones
+// wrapped in the auth middleware.
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	s := &Server{AuthApp: &auth.App{}}
+	spec := openAPI(s.endpoints())
+
+	// serve stand‑ins, so probing a route reaches no database
+	eps := s.endpoints()
+	var called bool
+	for i := range eps {
+		eps[i].Handler = func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusTeapot)
+		}
+	}
+	served := routeRecorder{}
+	s.mount(served, eps)
+
+	// what the spec says is served: each path under apiPrefix plus its
+	// deprecated root alias, or just the root for unversioned paths
+	type specOp struct {
+		admin, secured bool
+	}
+	want := map[string]map[string]specOp{}
+	for path, v := range spec["paths"].(map[string]any) {
+		item := v.(map[string]any)
+		ops := map[string]specOp{}
+		for method, op := range item {
+			if method == "servers" {
+				continue
+			}
+			op := op.(map[string]any)
+			_, secured := op["security"]
+			ops[strings.ToUpper(method)] = specOp{
+				admin:   op["description"] == "Requires an admin account.",
+				secured: secured,
+			}
+		}
+		if _, unversioned := item["servers"]; unversioned {
+			want[path] = ops
+			continue
+		}
+		want[apiPrefix+path] = ops
+		want[path] = ops
+	}
+
+	for pattern, h := range served {
+		ops, ok := want[pattern]
+		if !ok {
+			t.Errorf("%s is served but not in the spec", pattern)
+			continue
+		}
+
+		// methods: an unknown one gets a 405 listing the served ones
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("PROPFIND", pattern, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("PROPFIND %s: status %d, want 405", pattern, rec.Code)
+		}
+		got := strings.Split(rec.Header().Get("Allow"), ", ")
+		var specMethods []string
+		for m := range ops {
+			specMethods = append(specMethods, m)
+		}
+		slices.Sort(got)
+		slices.Sort(specMethods)
+		if !slices.Equal(got, specMethods) {
+			t.Errorf("%s serves %v, spec has %v", pattern, got, specMethods)
+		}
+
+		// auth: without a cookie, admin‑only operations stop at the
+		// middleware and everything else reaches its handler
+		for method, op := range ops {
+			called = false
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(method, pattern, nil))
+			switch {
+			case op.admin && (called || rec.Code != http.StatusUnauthorized):
+				t.Errorf("%s %s is admin-only in the spec but isn't behind the auth middleware (status %d)", method, pattern, rec.Code)
+			case !op.admin && !called:
+				t.Errorf("%s %s isn't admin-only in the spec but didn't reach its handler (status %d)", method, pattern, rec.Code)
+			case op.admin && !op.secured:
+				t.Errorf("%s %s is admin-only but has no security requirement in the spec", method, pattern)
+			}
+		}
+	}
+	for pattern := range want {
+		if _, ok := served[pattern]; !ok {
+			t.Errorf("%s is in the spec but not served", pattern)
+		}
+	}
+
+	// the spec's security requirements follow each endpoint's access
+	for _, ep := range s.endpoints() {
+		op := spec["paths"].(map[string]any)[ep.Path].(map[string]any)[strings.ToLower(ep.Method)].(map[string]any)
+		if _, secured := op["security"]; secured != (ep.Access != public) {
+			t.Errorf("%s %s: access %d, spec security %v", ep.Method, ep.Path, ep.Access, op["security"])
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// internal/server/apiversion.go
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// apiPrefix is where the current API version is mounted.
+const apiPrefix = "/api/v1"
+
+// The old root paths (/items, /orders, …) remain as aliases of /api/v1
+// until legacySunset; responses on them carry Deprecation and Sunset headers.
+var (
+	legacyDeprecated = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+	legacySunset     = time.Date(2027, time.May, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// apiVersionKey is the context key for the API version a request used.
+type apiVersionKey struct{}
+
+// versioned is implemented by response types whose JSON shape differs
+// between API versions. jsonResponse calls forVersion with the version of
+// the incoming request and encodes whatever it returns, so a v2 can reshape
+// a payload while v1 clients keep getting the old one.
+type versioned interface {
+	forVersion(v int) any
+}
+
+// withAPIVersion records the API version v for every request to next.
+func withAPIVersion(v int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), apiVersionKey{}, v)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// apiVersionFrom returns the API version stored in ctx, defaulting to 1.
+func apiVersionFrom(ctx context.Context) int {
+	if v, ok := ctx.Value(apiVersionKey{}).(int); ok {
+		return v
+	}
+	return 1
+}
+
+// deprecated marks responses from a legacy alias, pointing clients at
+// successor (RFC 9745 Deprecation, RFC 8594 Sunset).
+func deprecated(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", legacyDeprecated.Unix()))
+		w.Header().Set("Sunset", legacySunset.Format(http.TimeFormat))
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forVersion converts data (or each element of a slice of it) into the
+// shape for API version v.
+func forVersion(data any, v int) any {
+	if vd, ok := data.(versioned); ok {
+		return vd.forVersion(v)
+	}
+	rv := reflect.ValueOf(data)
+	if rv.Kind() != reflect.Slice || !rv.Type().Elem().Implements(reflect.TypeOf((*versioned)(nil)).Elem()) {
+		return data
+	}
+	out := make([]any, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface().(versioned).forVersion(v)
+	}
+	return out
+}
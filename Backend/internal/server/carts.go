@@ -0,0 +1,249 @@
+// internal/server/carts.go
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+)
+
+// cartCookie holds the token of an anonymous visitor's cart.
+const cartCookie = "cart_token"
+
+// cartLineReq adds to or sets the quantity of one item in the cart.
+type cartLineReq struct {
+	ItemID   int `json:"item_id" validate:"min=1"`
+	Quantity int `json:"quantity" validate:"min=1,max=1000"`
+}
+
+// checkoutReq pays for the cart; see orderReq.
+type checkoutReq struct {
+	PaymentToken string `json:"payment_token,omitempty" validate:"max=255"`
+	PostalCode   string `json:"postal_code,omitempty" validate:"max=16"`
+	PromoCode    string `json:"promo_code,omitempty" validate:"max=64"`
+
+	SlotID          int64  `json:"slot_id,omitempty" validate:"min=0"`
+	DeliveryAddress string `json:"delivery_address,omitempty" validate:"max=255"`
+}
+
+// cartView is the cart as the client sees it.
+type cartView struct {
+	Items []db.CartLine `json:"items"`
+	Total float64       `json:"total"`
+}
+
+// cartFor finds the caller's cart. Signed‑in users get their own cart;
+// anyone else gets the anonymous cart named by the cart_token cookie,
+// which is created (and the cookie set) when create is true. A caller who
+// is signed in but still has an anonymous cart gets it merged into theirs.
+// With create false and no cart, the ID is 0.
+func (s *Server) cartFor(w http.ResponseWriter, r *http.Request, create bool) (int64, error) {
+	ctx := r.Context()
+	token := ""
+	if ck, err := r.Cookie(cartCookie); err == nil {
+		token = ck.Value
+	}
+
+	userID, err := s.extractUserID(r)
+	if err != nil {
+		// anonymous
+		if token != "" {
+			id, err := db.TokenCart(ctx, s.DB, token, create)
+			if !errors.Is(err, db.ErrNotFound) {
+				return id, err
+			}
+		}
+		if !create {
+			return 0, nil
+		}
+		token = newCartToken()
+		setCartCookie(w, token, 0)
+		return db.TokenCart(ctx, s.DB, token, true)
+	}
+
+	cartID, err := db.UserCart(ctx, s.DB, userID)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		s.mergeCart(ctx, w, token, cartID)
+	}
+	return cartID, nil
+}
+
+// mergeCart moves the anonymous cart named by token into the user's cart
+// and drops the cookie. A failure is logged but doesn't fail the request:
+// the cookie stays, so the next request tries again.
+func (s *Server) mergeCart(ctx context.Context, w http.ResponseWriter, token string, intoID int64) {
+	anonID, err := db.TokenCart(ctx, s.DB, token, false)
+	if err == nil {
+		err = db.MergeCarts(ctx, s.DB, anonID, intoID)
+	}
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		logging.FromContext(ctx).Warn("could not merge anonymous cart", slog.Any("error", err))
+		return
+	}
+	setCartCookie(w, "", -1)
+}
+
+// onLogin merges the anonymous cart, if any, into the user's cart as
+// soon as they sign in. It is installed as auth.App.OnLogin.
+func (s *Server) onLogin(w http.ResponseWriter, r *http.Request, userID string) {
+	ck, err := r.Cookie(cartCookie)
+	if err != nil {
+		return
+	}
+	cartID, err := db.UserCart(r.Context(), s.DB, userID)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("could not load cart at sign-in", slog.Any("error", err))
+		return
+	}
+	s.mergeCart(r.Context(), w, ck.Value, cartID)
+}
+
+func newCartToken() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// setCartCookie sets (or with maxAge < 0, clears) the cart cookie, with
+// the same attributes as the auth cookies.
+func setCartCookie(w http.ResponseWriter, token string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cartCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+		MaxAge:   maxAge,
+	})
+}
+
+// writeCart responds with the current contents of cartID.
+func (s *Server) writeCart(w http.ResponseWriter, r *http.Request, cartID int64) {
+	view := cartView{Items: []db.CartLine{}}
+	if cartID != 0 {
+		lines, err := db.GetCart(r.Context(), s.DB, cartID)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		view.Items = lines
+	}
+	for _, l := range view.Items {
+		view.Total += l.Price * float64(l.Quantity)
+	}
+	jsonResponse(w, r, view, http.StatusOK)
+}
+
+// GET /cart
+func (s *Server) getCartHandler(w http.ResponseWriter, r *http.Request) {
+	cartID, err := s.cartFor(w, r, false)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.writeCart(w, r, cartID)
+}
+
+// POST /cart/items — add quantity of an item
+func (s *Server) addCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	s.setCartItem(w, r, true)
+}
+
+// POST /cart/items/update — set an item's quantity
+func (s *Server) updateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	s.setCartItem(w, r, false)
+}
+
+func (s *Server) setCartItem(w http.ResponseWriter, r *http.Request, add bool) {
+	var req cartLineReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	cartID, err := s.cartFor(w, r, true)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := db.SetCartItem(r.Context(), s.DB, cartID, req.ItemID, req.Quantity, add); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.writeCart(w, r, cartID)
+}
+
+// DELETE /cart/items?item_id=123
+func (s *Server) removeCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.Atoi(r.URL.Query().Get("item_id"))
+	if err != nil {
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid item_id"))
+		return
+	}
+	cartID, err := s.cartFor(w, r, false)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if cartID != 0 {
+		if err := db.RemoveCartItem(r.Context(), s.DB, cartID, itemID); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	s.writeCart(w, r, cartID)
+}
+
+// POST /cart/checkout — pay for the signed‑in user's cart and turn it
+// into an order
+func (s *Server) checkoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req checkoutReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	userID, err := s.extractUserID(r)
+	if err != nil {
+		writeError(w, r, errNotAuthenticated)
+		return
+	}
+	cartID, err := s.cartFor(w, r, true)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	lines, err := db.GetCart(r.Context(), s.DB, cartID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(lines) == 0 {
+		writeError(w, r, db.ErrEmptyCart)
+		return
+	}
+	order := db.NewOrder{
+		UserID:          userID,
+		Items:           make(map[int]int, len(lines)),
+		PostalCode:      req.PostalCode,
+		PromoCode:       req.PromoCode,
+		SlotID:          req.SlotID,
+		DeliveryAddress: req.DeliveryAddress,
+		Holder:          db.CartHolder(cartID),
+	}
+	for _, l := range lines {
+		order.Items[l.ItemID] = l.Quantity
+	}
+	s.submitOrder(w, r, order, req.PaymentToken, placeNew(r, func(pay db.Payment) (int64, error) {
+		return db.CheckoutCart(r.Context(), s.DB, cartID, order, pay)
+	}))
+}
@@ -0,0 +1,240 @@
+// internal/server/carts_test.go
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/payments"
+)
+
+// cartQuantities returns the cart in rec's body as quantities by item ID.
+func cartQuantities(t *testing.T, rec *httptest.ResponseRecorder) map[int]int {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cart: status %d: %s", rec.Code, rec.Body)
+	}
+	var view cartView
+	decodeBody(t, rec, &view)
+	q := make(map[int]int, len(view.Items))
+	for _, l := range view.Items {
+		q[l.ItemID] = l.Quantity
+	}
+	return q
+}
+
+func TestAnonymousCart(t *testing.T) {
+	s := newTestServer(t)
+	eggs := addItem(t, s, "eggs", 4, 10)
+
+	// reading no cart creates none
+	rec := call(t, s, http.MethodGet, "/api/v1/cart", nil)
+	if q := cartQuantities(t, rec); len(q) != 0 {
+		t.Errorf("new visitor's cart %v", q)
+	}
+	if ck := responseCookie(rec, cartCookie); ck != nil {
+		t.Errorf("GET /cart set %s", ck)
+	}
+
+	// the first add creates it and names it in the cookie
+	rec = call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: 2})
+	ck := responseCookie(rec, cartCookie)
+	if ck == nil || ck.Value == "" || !ck.HttpOnly {
+		t.Fatalf("cart cookie %v", ck)
+	}
+	if q := cartQuantities(t, rec); q[eggs] != 2 {
+		t.Errorf("cart %v, want 2 eggs", q)
+	}
+	rec = call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: 1}, ck)
+	if q := cartQuantities(t, rec); q[eggs] != 3 {
+		t.Errorf("cart %v, want 3 eggs", q)
+	}
+	if q := cartQuantities(t, call(t, s, http.MethodGet, "/api/v1/cart", nil, ck)); q[eggs] != 3 {
+		t.Errorf("cart read back as %v", q)
+	}
+
+	// an unknown token is a new, empty cart
+	stale := &http.Cookie{Name: cartCookie, Value: "0123456789abcdef"}
+	if q := cartQuantities(t, call(t, s, http.MethodGet, "/api/v1/cart", nil, stale)); len(q) != 0 {
+		t.Errorf("unknown token's cart %v", q)
+	}
+
+	// paying needs an account
+	rec = call(t, s, http.MethodPost, "/api/v1/cart/checkout", checkoutReq{}, ck)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous checkout: status %d, want 401", rec.Code)
+	}
+}
+
+func TestCartMergedAtLogin(t *testing.T) {
+	s := newTestServer(t)
+	eggs := addItem(t, s, "eggs", 4, 5)
+	mug := addItem(t, s, "mug", 9, 5)
+	user := userCookie("u1")
+
+	if rec := call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: 3}, user); rec.Code != http.StatusOK {
+		t.Fatalf("add to user cart: %d %s", rec.Code, rec.Body)
+	}
+	rec := call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: 4})
+	anon := responseCookie(rec, cartCookie)
+	call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: mug, Quantity: 1}, anon)
+
+	// what auth.App.OAuthCallback does after a successful sign-in
+	r := httptest.NewRequest(http.MethodGet, "/redirect", nil)
+	r.AddCookie(anon)
+	rec = httptest.NewRecorder()
+	s.onLogin(rec, r, "u1")
+	if ck := responseCookie(rec, cartCookie); ck == nil || ck.MaxAge >= 0 {
+		t.Errorf("cart cookie not cleared at sign-in: %v", ck)
+	}
+
+	// quantities add up, capped at the stock
+	if q := cartQuantities(t, call(t, s, http.MethodGet, "/api/v1/cart", nil, user)); q[eggs] != 5 || q[mug] != 1 {
+		t.Errorf("merged cart %v, want 5 eggs and 1 mug", q)
+	}
+	if q := cartQuantities(t, call(t, s, http.MethodGet, "/api/v1/cart", nil, anon)); len(q) != 0 {
+		t.Errorf("anonymous cart still there: %v", q)
+	}
+}
+
+// TestCartMergedOnNextRequest covers a sign-in whose merge didn't happen:
+// the cookie is still there, and the next signed-in request merges it.
+func TestCartMergedOnNextRequest(t *testing.T) {
+	s := newTestServer(t)
+	eggs := addItem(t, s, "eggs", 4, 10)
+
+	rec := call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: 2})
+	anon := responseCookie(rec, cartCookie)
+	rec = call(t, s, http.MethodGet, "/api/v1/cart", nil, userCookie("u1"), anon)
+	if q := cartQuantities(t, rec); q[eggs] != 2 {
+		t.Errorf("cart %v, want 2 eggs", q)
+	}
+	if ck := responseCookie(rec, cartCookie); ck == nil || ck.MaxAge >= 0 {
+		t.Errorf("cart cookie not cleared: %v", ck)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	eggs := addItem(t, s, "eggs", 4, 10)
+	user := userCookie("u1")
+
+	call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: 3}, user)
+
+	// a declined payment leaves the cart and the stock alone
+	rec := call(t, s, http.MethodPost, "/api/v1/cart/checkout", checkoutReq{PaymentToken: payments.MockDecline}, user)
+	if rec.Code != http.StatusPaymentRequired {
+		t.Fatalf("declined checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	if q := cartQuantities(t, call(t, s, http.MethodGet, "/api/v1/cart", nil, user)); q[eggs] != 3 {
+		t.Errorf("cart after a declined payment %v", q)
+	}
+
+	rec = call(t, s, http.MethodPost, "/api/v1/cart/checkout", checkoutReq{}, user)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	var created orderCreated
+	decodeBody(t, rec, &created)
+	order, lines, err := db.GetOrderByID(ctx, s.DB, created.OrderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.UserID != "u1" || order.PaymentStatus != db.PaymentAuthorized || len(lines) != 1 || lines[0].Quantity != 3 {
+		t.Errorf("order %+v, lines %+v", order, lines)
+	}
+	if it, _ := db.GetItem(ctx, s.DB, eggs); it.Stock != 7 {
+		t.Errorf("stock %d, want 7", it.Stock)
+	}
+	if q := cartQuantities(t, call(t, s, http.MethodGet, "/api/v1/cart", nil, user)); len(q) != 0 {
+		t.Errorf("cart not emptied: %v", q)
+	}
+
+	rec = call(t, s, http.MethodPost, "/api/v1/cart/checkout", checkoutReq{}, user)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty cart checkout: status %d, want 400", rec.Code)
+	}
+}
+
+// TestHoldSignInCheckout holds an anonymous cart, signs in and checks out:
+// the stock stays held for the customer the whole way.
+func TestHoldSignInCheckout(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	eggs := addItem(t, s, "eggs", 4, 5)
+
+	rec := call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: 4})
+	anon := responseCookie(rec, cartCookie)
+	if rec := call(t, s, http.MethodPost, "/api/v1/cart/hold", nil, anon); rec.Code != http.StatusOK {
+		t.Fatalf("hold: status %d: %s", rec.Code, rec.Body)
+	}
+	buyEggs := orderReq{Items: []orderLine{{ItemID: eggs, Quantity: 2}}}
+	if rec := call(t, s, http.MethodPost, "/api/v1/orders", buyEggs, userCookie("u2")); rec.Code != http.StatusConflict {
+		t.Errorf("someone else's order of held stock: status %d, want 409", rec.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/redirect", nil)
+	r.AddCookie(anon)
+	s.onLogin(httptest.NewRecorder(), r, "u1")
+	user := userCookie("u1")
+
+	// the hold came along with the cart
+	if rec := call(t, s, http.MethodPost, "/api/v1/orders", buyEggs, userCookie("u2")); rec.Code != http.StatusConflict {
+		t.Errorf("order of held stock after sign-in: status %d, want 409", rec.Code)
+	}
+	if it, _ := db.GetItem(ctx, s.DB, eggs); it.Available != 1 {
+		t.Errorf("available %d after sign-in, want 1", it.Available)
+	}
+
+	rec = call(t, s, http.MethodPost, "/api/v1/cart/checkout", checkoutReq{}, user)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("checkout: status %d: %s", rec.Code, rec.Body)
+	}
+	if it, _ := db.GetItem(ctx, s.DB, eggs); it.Stock != 1 || it.Available != 1 {
+		t.Errorf("stock %d available %d, want 1 and 1", it.Stock, it.Available)
+	}
+}
+
+func TestAnonymousHoldLimits(t *testing.T) {
+	s := newTestServer(t)
+	eggs := addItem(t, s, "eggs", 4, 50)
+
+	hold := func(ck *http.Cookie) ([]db.Hold, *httptest.ResponseRecorder) {
+		t.Helper()
+		rec := call(t, s, http.MethodPost, "/api/v1/cart/hold", nil, ck)
+		var holds []db.Hold
+		if rec.Code == http.StatusOK {
+			decodeBody(t, rec, &holds)
+		}
+		return holds, rec
+	}
+
+	rec := call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: anonymousHoldMax + 5})
+	anon := responseCookie(rec, cartCookie)
+	for i := range anonymousHoldRenewals + 1 {
+		holds, rec := hold(anon)
+		if rec.Code != http.StatusOK || len(holds) != 1 || holds[0].Quantity != anonymousHoldMax {
+			t.Fatalf("hold %d: %d %s, want %d eggs held", i+1, rec.Code, rec.Body, anonymousHoldMax)
+		}
+	}
+	_, rec = hold(anon)
+	var body errorResponse
+	decodeBody(t, rec, &body)
+	if rec.Code != http.StatusConflict || body.Error.Code != CodeHoldLimit {
+		t.Errorf("one renewal too many: %d %s, want 409 %s", rec.Code, rec.Body, CodeHoldLimit)
+	}
+
+	// a signed-in cart holds everything, as often as it likes
+	user := userCookie("u1")
+	call(t, s, http.MethodPost, "/api/v1/cart/items", cartLineReq{ItemID: eggs, Quantity: anonymousHoldMax + 5}, user)
+	for i := range anonymousHoldRenewals + 2 {
+		holds, rec := hold(user)
+		if rec.Code != http.StatusOK || len(holds) != 1 || holds[0].Quantity != anonymousHoldMax+5 {
+			t.Fatalf("signed-in hold %d: %d %s", i+1, rec.Code, rec.Body)
+		}
+	}
+}
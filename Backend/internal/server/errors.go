@@ -0,0 +1,152 @@
+// internal/server/errors.go
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"nexus.local/internal/auth"
+	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+	"nexus.local/internal/payments"
+)
+
+// Stable, machine‑readable error codes. The frontend switches on these,
+// so never rename one once it has shipped.
+const (
+	CodeBadRequest        = "bad_request"
+	CodeInvalidJSON       = "invalid_json"
+	CodeValidation        = "validation_failed"
+	CodePayloadTooLarge   = "payload_too_large"
+	CodeUnsupportedMedia  = "unsupported_media_type"
+	CodeInvalidImage      = "invalid_image"
+	CodeUnauthenticated   = "unauthenticated"
+	CodeForbidden         = "forbidden"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeInsufficientStock = "insufficient_stock"
+	CodeConflict          = "conflict"
+	CodeIdempotencyReused = "idempotency_key_reused"
+	CodePaymentDeclined   = "payment_declined"
+	CodeInvalidRefund     = "invalid_refund"
+	CodePromoUnavailable  = "promotion_unavailable"
+	CodeSlotUnavailable   = "slot_unavailable"
+	CodeHoldLimit         = "hold_limit_reached"
+	CodeInvalidSignature  = "invalid_signature"
+	CodeUpstream          = "upstream_error"
+	CodeInternal          = "internal_error"
+)
+
+// FieldError describes a problem with a single input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is the error type every handler reports through writeError.
+// Only Code, Message, Details and RequestID are ever shown to clients;
+// the wrapped cause stays in the server log.
+type APIError struct {
+	Status    int          `json:"-"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+
+	cause error
+}
+
+// errorResponse is the body of every error response.
+type errorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+// newError builds an APIError with a user‑facing message.
+func newError(status int, code, msg string) *APIError {
+	return &APIError{Status: status, Code: code, Message: msg}
+}
+
+// wrapError builds an APIError that keeps err as its (private) cause.
+func wrapError(status int, code, msg string, err error) *APIError {
+	return &APIError{Status: status, Code: code, Message: msg, cause: err}
+}
+
+func (e *APIError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.cause)
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *APIError) Unwrap() error { return e.cause }
+
+// Common errors shared by several handlers.
+var (
+	errMethodNotAllowed = newError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed")
+	errNotAuthenticated = newError(http.StatusUnauthorized, CodeUnauthenticated, "not authenticated")
+	errForbidden        = newError(http.StatusForbidden, CodeForbidden, "forbidden")
+)
+
+// toAPIError maps any error onto an APIError. Errors from internal/db and
+// internal/auth get their proper status; anything unknown becomes a 500
+// with a generic message so driver errors never reach the client.
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return wrapError(http.StatusNotFound, CodeNotFound, "resource not found", err)
+	case errors.Is(err, db.ErrInsufficientStock):
+		return wrapError(http.StatusConflict, CodeInsufficientStock, "not enough stock to fulfil the order", err)
+	case errors.Is(err, db.ErrConflict):
+		return wrapError(http.StatusConflict, CodeConflict, "conflicts with existing data", err)
+	case errors.Is(err, db.ErrEmptyCart):
+		return wrapError(http.StatusBadRequest, CodeBadRequest, "the cart is empty", err)
+	case errors.Is(err, db.ErrIdempotencyMismatch):
+		return wrapError(http.StatusUnprocessableEntity, CodeIdempotencyReused, "Idempotency-Key was already used with a different request", err)
+	case errors.Is(err, db.ErrInvalidRefund):
+		return wrapError(http.StatusUnprocessableEntity, CodeInvalidRefund, "nothing left to refund for those items", err)
+	case errors.Is(err, db.ErrPromotionUnavailable):
+		return wrapError(http.StatusUnprocessableEntity, CodePromoUnavailable, "the promo code can't be used for this order", err)
+	case errors.Is(err, db.ErrSlotUnavailable):
+		return wrapError(http.StatusConflict, CodeSlotUnavailable, "the pickup or delivery slot can't be booked for this order", err)
+	case errors.Is(err, db.ErrHoldLimit):
+		return wrapError(http.StatusConflict, CodeHoldLimit, "the hold can't be renewed again; sign in to keep holding the stock", err)
+	case errors.Is(err, payments.ErrDeclined):
+		return wrapError(http.StatusPaymentRequired, CodePaymentDeclined, "the payment was declined", err)
+	case errors.Is(err, payments.ErrInvalidSignature):
+		return wrapError(http.StatusBadRequest, CodeInvalidSignature, "invalid webhook signature", err)
+	case errors.Is(err, payments.ErrNotFound),
+		errors.Is(err, payments.ErrInvalidRequest),
+		errors.Is(err, payments.ErrUnavailable):
+		return wrapError(http.StatusBadGateway, CodeUpstream, "the payment provider failed", err)
+	case errors.Is(err, auth.ErrNoAuthHeader),
+		errors.Is(err, auth.ErrInvalidToken),
+		errors.Is(err, auth.ErrUnknownUser):
+		return wrapError(http.StatusUnauthorized, CodeUnauthenticated, "not authenticated", err)
+	case errors.Is(err, auth.ErrForbidden):
+		return wrapError(http.StatusForbidden, CodeForbidden, "forbidden", err)
+	case errors.Is(err, auth.ErrMissingCode):
+		return wrapError(http.StatusBadRequest, CodeBadRequest, "missing authorization code", err)
+	case errors.Is(err, auth.ErrTokenExchange):
+		return wrapError(http.StatusBadGateway, CodeUpstream, "sign-in with Microsoft failed", err)
+	}
+	return wrapError(http.StatusInternalServerError, CodeInternal, "internal server error", err)
+}
+
+// writeError sends err to the client as {"error": {...}} JSON.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := *toAPIError(err)
+	apiErr.RequestID = requestIDFrom(r.Context())
+	logger := logging.FromContext(r.Context())
+	if apiErr.Status >= http.StatusInternalServerError {
+		logger.Error("request failed", slog.String("code", apiErr.Code), slog.Any("error", err))
+	} else {
+		logger.Debug("request rejected", slog.String("code", apiErr.Code), slog.Any("error", err))
+	}
+	jsonResponse(w, r, errorResponse{Error: &apiErr}, apiErr.Status)
+}
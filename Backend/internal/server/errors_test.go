@@ -0,0 +1,85 @@
+// internal/server/errors_test.go
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexus.local/internal/auth"
+	"nexus.local/internal/db"
+	"nexus.local/internal/payments"
+)
+
+func TestToAPIError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("item 3: %w", db.ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{db.ErrInsufficientStock, http.StatusConflict, CodeInsufficientStock},
+		{db.ErrConflict, http.StatusConflict, CodeConflict},
+		{db.ErrEmptyCart, http.StatusBadRequest, CodeBadRequest},
+		{db.ErrIdempotencyMismatch, http.StatusUnprocessableEntity, CodeIdempotencyReused},
+		{db.ErrInvalidRefund, http.StatusUnprocessableEntity, CodeInvalidRefund},
+		{db.ErrPromotionUnavailable, http.StatusUnprocessableEntity, CodePromoUnavailable},
+		{db.ErrSlotUnavailable, http.StatusConflict, CodeSlotUnavailable},
+		{db.ErrHoldLimit, http.StatusConflict, CodeHoldLimit},
+		{payments.ErrDeclined, http.StatusPaymentRequired, CodePaymentDeclined},
+		{payments.ErrInvalidSignature, http.StatusBadRequest, CodeInvalidSignature},
+		{payments.ErrUnavailable, http.StatusBadGateway, CodeUpstream},
+		{auth.ErrInvalidToken, http.StatusUnauthorized, CodeUnauthenticated},
+		{auth.ErrForbidden, http.StatusForbidden, CodeForbidden},
+		{auth.ErrMissingCode, http.StatusBadRequest, CodeBadRequest},
+		{auth.ErrTokenExchange, http.StatusBadGateway, CodeUpstream},
+		{errMethodNotAllowed, http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{fmt.Errorf("handler: %w", errForbidden), http.StatusForbidden, CodeForbidden},
+		{errors.New("dial tcp 10.0.0.5:3306: connection refused"), http.StatusInternalServerError, CodeInternal},
+	}
+	for _, tt := range tests {
+		got := toAPIError(tt.err)
+		if got.Status != tt.status || got.Code != tt.code {
+			t.Errorf("toAPIError(%v) = %d %s, want %d %s", tt.err, got.Status, got.Code, tt.status, tt.code)
+		}
+	}
+}
+
+// TestWriteError checks the envelope, and that a cause never reaches the
+// client.
+func TestWriteError(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, "abc123"))
+	rec := httptest.NewRecorder()
+	writeError(rec, r, errors.New("dial tcp 10.0.0.5:3306: connection refused"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if strings.Contains(rec.Body.String(), "10.0.0.5") {
+		t.Errorf("cause leaked: %s", rec.Body)
+	}
+	var body struct {
+		Error map[string]any `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"code": CodeInternal, "message": "internal server error", "request_id": "abc123"}
+	if len(body.Error) != len(want) {
+		t.Errorf("error %v, want %v", body.Error, want)
+	}
+	for k, v := range want {
+		if body.Error[k] != v {
+			t.Errorf("error.%s = %v, want %v", k, body.Error[k], v)
+		}
+	}
+}
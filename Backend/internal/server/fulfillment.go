@@ -0,0 +1,228 @@
+// internal/server/fulfillment.go
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"nexus.local/internal/db"
+)
+
+// fulfillmentOptionReq creates a pickup location or a delivery zone.
+type fulfillmentOptionReq struct {
+	VendorID     int64  `json:"vendor_id,omitempty" validate:"min=0"` // 0 for the store's own
+	Method       string `json:"method" validate:"required,max=16"`    // pickup or delivery
+	Name         string `json:"name" validate:"required,max=255"`
+	Address      string `json:"address,omitempty" validate:"max=255"`      // where to pick up
+	PostalPrefix string `json:"postal_prefix,omitempty" validate:"max=16"` // where to deliver; "" is everywhere
+	Fee          int64  `json:"fee" validate:"min=0"`                      // cents
+}
+
+// check validates what the struct tags can't.
+func (req fulfillmentOptionReq) check() []FieldError {
+	switch req.Method {
+	case db.FulfillmentPickup:
+		if req.Address == "" {
+			return []FieldError{{"address", "is required for pickup"}}
+		}
+	case db.FulfillmentDelivery:
+	default:
+		return []FieldError{{"method", "must be pickup or delivery"}}
+	}
+	return nil
+}
+
+// fulfillmentActiveReq switches a fulfillment option on or off.
+type fulfillmentActiveReq struct {
+	ID     int64 `json:"id" validate:"min=1"`
+	Active bool  `json:"active"`
+}
+
+// slotReq creates a time slot for a fulfillment option.
+type slotReq struct {
+	OptionID int64      `json:"option_id" validate:"min=1"`
+	StartsAt *time.Time `json:"starts_at" validate:"required"`
+	EndsAt   *time.Time `json:"ends_at" validate:"required"`
+	Capacity int        `json:"capacity" validate:"min=1,max=10000"` // orders
+}
+
+// GET /fulfillment/options?vendor_id=3 — the active ones
+func (s *Server) getFulfillmentOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	var vendorID int64
+	if v := r.URL.Query().Get("vendor_id"); v != "" {
+		var err error
+		if vendorID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid vendor_id"))
+			return
+		}
+	}
+	options, err := db.ListFulfillmentOptions(r.Context(), s.DB, vendorID, true)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, options, http.StatusOK)
+}
+
+// staffOption fetches fulfillment option optionID for the caller to
+// change: vendor staff may only change their own vendor's options, admins
+// any, including the store's own.
+func (s *Server) staffOption(r *http.Request, optionID int64) (db.FulfillmentOption, error) {
+	vendorID, admin, err := s.staffVendor(r)
+	if err != nil {
+		return db.FulfillmentOption{}, err
+	}
+	fo, err := db.GetFulfillmentOption(r.Context(), s.DB, optionID)
+	if err != nil {
+		return db.FulfillmentOption{}, err
+	}
+	if !admin && (vendorID == 0 || fo.VendorID != vendorID) {
+		return db.FulfillmentOption{}, errForbidden
+	}
+	return fo, nil
+}
+
+// POST /fulfillment/options — new options start active; vendor staff add
+// their own vendor's, admins any
+func (s *Server) addFulfillmentOptionHandler(w http.ResponseWriter, r *http.Request) {
+	var req fulfillmentOptionReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if errs := req.check(); len(errs) > 0 {
+		writeError(w, r, validationError(errs))
+		return
+	}
+	vendorID, admin, err := s.staffVendor(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !admin && (vendorID == 0 || req.VendorID != vendorID) {
+		writeError(w, r, errForbidden)
+		return
+	}
+	option, err := db.AddFulfillmentOption(r.Context(), s.DB, db.FulfillmentOption{
+		VendorID:     req.VendorID,
+		Method:       req.Method,
+		Name:         req.Name,
+		Address:      req.Address,
+		PostalPrefix: req.PostalPrefix,
+		Fee:          req.Fee,
+		Active:       true,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, option, http.StatusCreated)
+}
+
+// POST /fulfillment/options/active
+func (s *Server) setFulfillmentOptionActiveHandler(w http.ResponseWriter, r *http.Request) {
+	var req fulfillmentActiveReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if _, err := s.staffOption(r, req.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := db.SetFulfillmentOptionActive(r.Context(), s.DB, req.ID, req.Active); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /fulfillment/slots?option_id=3&days=7 — from now on, full or not
+func (s *Server) getSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	optionID, err := strconv.ParseInt(q.Get("option_id"), 10, 64)
+	if err != nil {
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid option_id"))
+		return
+	}
+	days := 14
+	if v := q.Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil || days < 1 || days > 90 {
+			writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "days must be between 1 and 90"))
+			return
+		}
+	}
+	now := time.Now()
+	slots, err := db.ListSlots(r.Context(), s.DB, optionID, now, now.AddDate(0, 0, days))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, slots, http.StatusOK)
+}
+
+// POST /fulfillment/slots
+func (s *Server) addSlotHandler(w http.ResponseWriter, r *http.Request) {
+	var req slotReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !req.EndsAt.After(*req.StartsAt) {
+		writeError(w, r, validationError([]FieldError{{"ends_at", "must be after starts_at"}}))
+		return
+	}
+	if _, err := s.staffOption(r, req.OptionID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	slot, err := db.AddSlot(r.Context(), s.DB, db.Slot{
+		OptionID: req.OptionID,
+		StartsAt: *req.StartsAt,
+		EndsAt:   *req.EndsAt,
+		Capacity: req.Capacity,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, slot, http.StatusCreated)
+}
+
+// GET /reports/picklist?date=2025-06-14&vendor_id=3 — the date defaults to
+// today (UTC); vendor staff get their own vendor's, admins any vendor's or,
+// without vendor_id, everyone's
+func (s *Server) pickListHandler(w http.ResponseWriter, r *http.Request) {
+	vendorID, admin, err := s.staffVendor(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	q := r.URL.Query()
+	if admin {
+		vendorID = 0
+		if v := q.Get("vendor_id"); v != "" {
+			if vendorID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid vendor_id"))
+				return
+			}
+		}
+	} else if vendorID == 0 {
+		writeError(w, r, errForbidden)
+		return
+	}
+	day := time.Now().UTC()
+	if v := q.Get("date"); v != "" {
+		if day, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "date must be a date (YYYY-MM-DD)"))
+			return
+		}
+	}
+	list, err := db.PickList(r.Context(), s.DB, day, vendorID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, list, http.StatusOK)
+}
@@ -0,0 +1,224 @@
+// internal/server/fulfillment_test.go
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"nexus.local/internal/db"
+)
+
+// addUser stores user id, as staff of vendorID if it isn't 0, and as an
+// admin if admin.
+func addUser(t *testing.T, s *Server, id string, vendorID int64, admin bool) *http.Cookie {
+	t.Helper()
+	ctx := context.Background()
+	if err := db.UpsertUser(ctx, s.DB, db.User{ID: id, DisplayName: id}); err != nil {
+		t.Fatal(err)
+	}
+	if vendorID != 0 {
+		if err := db.SetUserVendor(ctx, s.DB, id, vendorID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if admin {
+		if _, err := s.DB.ExecContext(ctx, "UPDATE users SET is_admin = ? WHERE id = ?", true, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return userCookie(id)
+}
+
+func TestFulfillmentStaffAccess(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	farm, err := db.AddVendor(ctx, s.DB, "Farm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bakery, err := db.AddVendor(ctx, s.DB, "Bakery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	farmer := addUser(t, s, "farmer", farm.ID, false)
+	baker := addUser(t, s, "baker", bakery.ID, false)
+	admin := addUser(t, s, "admin", 0, true)
+	shopper := addUser(t, s, "shopper", 0, false)
+
+	addOption := func(vendorID int64, ck *http.Cookie) (db.FulfillmentOption, int) {
+		t.Helper()
+		rec := call(t, s, http.MethodPost, "/api/v1/fulfillment/options", fulfillmentOptionReq{
+			VendorID: vendorID, Method: db.FulfillmentPickup, Name: "pickup", Address: "1 Lane",
+		}, ck)
+		var fo db.FulfillmentOption
+		if rec.Code == http.StatusCreated {
+			decodeBody(t, rec, &fo)
+		}
+		return fo, rec.Code
+	}
+	farmOption, code := addOption(farm.ID, farmer)
+	if code != http.StatusCreated {
+		t.Fatalf("farmer adds a farm option: status %d", code)
+	}
+	storeOption, code := addOption(0, admin)
+	if code != http.StatusCreated {
+		t.Fatalf("admin adds a store option: status %d", code)
+	}
+	for _, tt := range []struct {
+		name     string
+		vendorID int64
+		ck       *http.Cookie
+		want     int
+	}{
+		{"farmer, for the bakery", bakery.ID, farmer, http.StatusForbidden},
+		{"farmer, for the store", 0, farmer, http.StatusForbidden},
+		{"shopper, for the farm", farm.ID, shopper, http.StatusForbidden},
+		{"signed out", farm.ID, nil, http.StatusUnauthorized},
+		{"admin, for the bakery", bakery.ID, admin, http.StatusCreated},
+	} {
+		ck := []*http.Cookie{}
+		if tt.ck != nil {
+			ck = append(ck, tt.ck)
+		}
+		rec := call(t, s, http.MethodPost, "/api/v1/fulfillment/options", fulfillmentOptionReq{
+			VendorID: tt.vendorID, Method: db.FulfillmentPickup, Name: "pickup", Address: "1 Lane",
+		}, ck...)
+		if rec.Code != tt.want {
+			t.Errorf("add option, %s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		optionID int64
+		ck       *http.Cookie
+		want     int
+	}{
+		{"baker, the farm's", farmOption.ID, baker, http.StatusForbidden},
+		{"farmer, the store's", storeOption.ID, farmer, http.StatusForbidden},
+		{"farmer, unknown", farmOption.ID + 100, farmer, http.StatusNotFound},
+		{"farmer, the farm's", farmOption.ID, farmer, http.StatusNoContent},
+		{"admin, the farm's", farmOption.ID, admin, http.StatusNoContent},
+	} {
+		rec := call(t, s, http.MethodPost, "/api/v1/fulfillment/options/active", fulfillmentActiveReq{ID: tt.optionID, Active: true}, tt.ck)
+		if rec.Code != tt.want {
+			t.Errorf("switch option, %s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	start := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Hour)
+	end := start.Add(time.Hour)
+	addSlot := func(optionID int64, ck *http.Cookie) (db.Slot, int) {
+		t.Helper()
+		rec := call(t, s, http.MethodPost, "/api/v1/fulfillment/slots",
+			slotReq{OptionID: optionID, StartsAt: &start, EndsAt: &end, Capacity: 5}, ck)
+		var slot db.Slot
+		if rec.Code == http.StatusCreated {
+			decodeBody(t, rec, &slot)
+		}
+		return slot, rec.Code
+	}
+	if _, code := addSlot(farmOption.ID, baker); code != http.StatusForbidden {
+		t.Errorf("baker adds a farm slot: status %d, want 403", code)
+	}
+	if _, code := addSlot(storeOption.ID, farmer); code != http.StatusForbidden {
+		t.Errorf("farmer adds a store slot: status %d, want 403", code)
+	}
+	farmSlot, code := addSlot(farmOption.ID, farmer)
+	if code != http.StatusCreated {
+		t.Fatalf("farmer adds a farm slot: status %d", code)
+	}
+	storeSlot, code := addSlot(storeOption.ID, admin)
+	if code != http.StatusCreated {
+		t.Fatalf("admin adds a store slot: status %d", code)
+	}
+
+	// an order in each slot, and the pick lists that see them
+	eggs, err := db.AddItem(ctx, s.DB, db.Item{Name: "eggs", Price: 4, Stock: 10, VendorID: farm.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mug := addItem(t, s, "mug", 9, 10)
+	for _, o := range []db.NewOrder{
+		{UserID: "shopper", Items: map[int]int{int(eggs): 2}, SlotID: farmSlot.ID},
+		{UserID: "shopper", Items: map[int]int{mug: 1}, SlotID: storeSlot.ID},
+	} {
+		if _, err := db.PlaceOrder(ctx, s.DB, o, db.Payment{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	date := start.Format(time.DateOnly)
+	for _, tt := range []struct {
+		name  string
+		query string
+		ck    *http.Cookie
+		want  []int64 // slot IDs
+	}{
+		{"farmer", "", farmer, []int64{farmSlot.ID}},
+		{"farmer asking for the store's", "&vendor_id=0", farmer, []int64{farmSlot.ID}},
+		{"farmer asking for the bakery's", "&vendor_id=" + strconv.FormatInt(bakery.ID, 10), farmer, []int64{farmSlot.ID}},
+		{"baker", "", baker, nil},
+		{"admin", "", admin, []int64{farmSlot.ID, storeSlot.ID}},
+		{"admin, the farm's", "&vendor_id=" + strconv.FormatInt(farm.ID, 10), admin, []int64{farmSlot.ID}},
+	} {
+		rec := call(t, s, http.MethodGet, "/api/v1/reports/picklist?date="+date+tt.query, nil, tt.ck)
+		if rec.Code != http.StatusOK {
+			t.Errorf("pick list, %s: status %d: %s", tt.name, rec.Code, rec.Body)
+			continue
+		}
+		var list []db.PickSlot
+		decodeBody(t, rec, &list)
+		var got []int64
+		for _, ps := range list {
+			got = append(got, ps.Slot.ID)
+		}
+		if len(got) != len(tt.want) || len(got) > 0 && (got[0] != tt.want[0] || got[len(got)-1] != tt.want[len(tt.want)-1]) {
+			t.Errorf("pick list, %s: slots %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if rec := call(t, s, http.MethodGet, "/api/v1/reports/picklist?date="+date, nil, shopper); rec.Code != http.StatusForbidden {
+		t.Errorf("shopper's pick list: status %d, want 403", rec.Code)
+	}
+}
+
+// TestSlotCapacity books a slot over HTTP until it is full.
+func TestSlotCapacity(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	mug := addItem(t, s, "mug", 9, 10)
+	fo, err := db.AddFulfillmentOption(ctx, s.DB, db.FulfillmentOption{Method: db.FulfillmentPickup, Name: "Shop", Address: "1 Lane", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().UTC().Add(24 * time.Hour).Truncate(time.Hour)
+	slot, err := db.AddSlot(ctx, s.DB, db.Slot{OptionID: fo.ID, StartsAt: start, EndsAt: start.Add(time.Hour), Capacity: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := orderReq{Items: []orderLine{{ItemID: mug, Quantity: 1}}, SlotID: slot.ID}
+
+	for i := range 2 {
+		if rec := call(t, s, http.MethodPost, "/api/v1/orders", order, userCookie("u1")); rec.Code != http.StatusCreated {
+			t.Fatalf("order %d: status %d: %s", i+1, rec.Code, rec.Body)
+		}
+	}
+	rec := call(t, s, http.MethodPost, "/api/v1/orders", order, userCookie("u2"))
+	var body errorResponse
+	decodeBody(t, rec, &body)
+	if rec.Code != http.StatusConflict || body.Error.Code != CodeSlotUnavailable {
+		t.Errorf("order into a full slot: %d %s, want 409 %s", rec.Code, rec.Body, CodeSlotUnavailable)
+	}
+
+	rec = call(t, s, http.MethodGet, "/api/v1/fulfillment/slots?option_id="+strconv.FormatInt(fo.ID, 10), nil)
+	var slots []db.Slot
+	decodeBody(t, rec, &slots)
+	if len(slots) != 1 || slots[0].Booked != 2 || slots[0].Available != 0 {
+		t.Errorf("slots %+v, want one with 2 booked and none left", slots)
+	}
+	if it, _ := db.GetItem(ctx, s.DB, mug); it.Stock != 8 {
+		t.Errorf("stock %d, want 8", it.Stock)
+	}
+}
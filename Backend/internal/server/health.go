@@ -0,0 +1,105 @@
+// internal/server/health.go
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"nexus.local/internal/buildinfo"
+	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+)
+
+// readyCheckTimeout bounds each individual readiness check.
+const readyCheckTimeout = 2 * time.Second
+
+// healthStatus is the body of /healthz.
+type healthStatus struct {
+	Status string `json:"status"`
+}
+
+// checkResult is the outcome of one readiness check. Why a check failed
+// is logged, not returned: /readyz is public, and errors from the
+// database or the key fetch name internal hosts.
+type checkResult struct {
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// readiness is the body of /readyz.
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// GET /healthz — the process is up and serving requests
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, r, healthStatus{Status: "ok"}, http.StatusOK)
+}
+
+// GET /readyz — dependencies are usable; 503 with details if not
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]func(context.Context) error{
+		"database": func(ctx context.Context) error {
+			return s.DB.PingContext(ctx)
+		},
+		"migrations": func(ctx context.Context) error {
+			pending, err := db.PendingMigrations(ctx, s.DB)
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("pending: %s", strings.Join(pending, ", "))
+			}
+			return nil
+		},
+		"oidc_keys": s.AuthApp.CheckKeys,
+	}
+
+	res := readiness{Status: "ok", Checks: make(map[string]checkResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := check(ctx)
+			cr := checkResult{Status: "ok", DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				cr.Status = "fail"
+				if errors.Is(err, context.DeadlineExceeded) {
+					cr.Status = "timeout"
+				}
+				logging.FromContext(r.Context()).Warn("readiness check failed",
+					slog.String("check", name), slog.Any("error", err))
+			}
+			mu.Lock()
+			res.Checks[name] = cr
+			if err != nil {
+				res.Status = "fail"
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if res.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	jsonResponse(w, r, res, status)
+}
+
+// GET /version — build version, commit and Go version
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, r, buildinfo.Get(), http.StatusOK)
+}
@@ -0,0 +1,162 @@
+// internal/server/holds.go
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+	"nexus.local/internal/metrics"
+)
+
+// defaultHoldTTL is used when Server.HoldTTL is unset.
+const defaultHoldTTL = 10 * time.Minute
+
+// An anonymous cart holds at most anonymousHoldMax of each item and may
+// renew its hold anonymousHoldRenewals times, so a visitor can't keep
+// stock off the shelf indefinitely; signing in lifts both limits.
+const (
+	anonymousHoldMax      = 10
+	anonymousHoldRenewals = 2
+)
+
+// holdReq holds stock for a checkout of POST /orders; see orderReq.
+type holdReq struct {
+	Items []orderLine `json:"items" validate:"required,max=100"`
+}
+
+// holdTTL is how long a hold made now lasts.
+func (s *Server) holdTTL() time.Duration {
+	if s.HoldTTL <= 0 {
+		return defaultHoldTTL
+	}
+	return s.HoldTTL
+}
+
+// POST /cart/hold — hold everything in the caller's cart until checkout,
+// or renew the hold; anonymous carts within the limits above
+func (s *Server) holdCartHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := s.extractUserID(r)
+	anonymous := err != nil
+	cartID, err := s.cartFor(w, r, false)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if cartID == 0 {
+		writeError(w, r, db.ErrEmptyCart)
+		return
+	}
+	lines, err := db.GetCart(r.Context(), s.DB, cartID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if len(lines) == 0 {
+		writeError(w, r, db.ErrEmptyCart)
+		return
+	}
+	items := make(map[int]int, len(lines))
+	for _, l := range lines {
+		items[l.ItemID] = l.Quantity
+	}
+	if !anonymous {
+		s.holdStock(w, r, db.CartHolder(cartID), items, 0)
+		return
+	}
+	for id, qty := range items {
+		items[id] = min(qty, anonymousHoldMax)
+	}
+	s.holdStock(w, r, db.CartHolder(cartID), items, anonymousHoldRenewals)
+}
+
+// DELETE /cart/hold — give back what the caller's cart holds
+func (s *Server) releaseCartHandler(w http.ResponseWriter, r *http.Request) {
+	cartID, err := s.cartFor(w, r, false)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if cartID != 0 {
+		if err := db.ReleaseHolds(r.Context(), s.DB, db.CartHolder(cartID)); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /orders/hold — hold items for the caller's next POST /orders,
+// replacing what they held before
+func (s *Server) holdOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var req holdReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	userID, err := s.extractUserID(r)
+	if err != nil {
+		writeError(w, r, errNotAuthenticated)
+		return
+	}
+	items := make(map[int]int, len(req.Items))
+	for _, line := range req.Items {
+		items[line.ItemID] += line.Quantity
+	}
+	s.holdStock(w, r, db.UserHolder(userID), items, 0)
+}
+
+// DELETE /orders/hold — give back what the caller holds for POST /orders
+func (s *Server) releaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := s.extractUserID(r)
+	if err != nil {
+		writeError(w, r, errNotAuthenticated)
+		return
+	}
+	if err := db.ReleaseHolds(r.Context(), s.DB, db.UserHolder(userID)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) holdStock(w http.ResponseWriter, r *http.Request, holder string, items map[int]int, maxRenewals int) {
+	holds, err := db.HoldStock(r.Context(), s.DB, holder, items, s.holdTTL(), maxRenewals)
+	if err != nil {
+		if errors.Is(err, db.ErrInsufficientStock) {
+			metrics.StockOuts.Inc()
+		}
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, holds, http.StatusOK)
+}
+
+// ReapHolds deletes expired stock holds every interval until ctx is done.
+// Expired holds stop counting against stock the moment they expire; the
+// reaper only clears them out.
+func (s *Server) ReapHolds(ctx context.Context, every time.Duration) {
+	log := logging.FromContext(ctx)
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		n, err := db.ReleaseExpiredHolds(ctx, s.DB)
+		if err != nil {
+			log.Warn("could not release expired stock holds", slog.Any("error", err))
+			continue
+		}
+		if n > 0 {
+			metrics.HoldsExpired.Add(float64(n))
+			log.Debug("released expired stock holds", slog.Int64("holds", n))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// internal/server/idempotency.go
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"nexus.local/internal/db"
+)
+
+const (
+	// idempotencyHeader lets a client retry POST /orders safely: every
+	// attempt with the same key gets the first attempt's response.
+	idempotencyHeader = "Idempotency-Key"
+
+	// replayedHeader marks a response that was replayed from a stored key.
+	replayedHeader = "Idempotent-Replayed"
+
+	// defaultIdempotencyTTL is used when Server.IdempotencyTTL is unset.
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// validIdempotencyKey accepts up to 255 printable ASCII characters, which
+// covers UUIDs and anything else a client is likely to send.
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > 255 {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash fingerprints a decoded request. Hashing the re‑encoded
+// struct rather than the raw body means whitespace or key order in the
+// client's JSON doesn't count as a different request.
+func requestHash(method, path string, req any) (string, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replayOrder answers a plain retry of POST /orders from the response
+// stored under its Idempotency-Key, and reports whether it has written a
+// response (the replay, or an error) so the handler is done. It runs
+// before any stock, promotion or slot check, since the first attempt may
+// have used up what the retry would be checked against.
+func (s *Server) replayOrder(w http.ResponseWriter, r *http.Request, key, userID string, req orderReq) (db.IdempotencyKey, bool) {
+	hash, err := requestHash(r.Method, "/orders", req)
+	if err != nil {
+		writeError(w, r, err)
+		return db.IdempotencyKey{}, true
+	}
+	ttl := s.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	idem := db.IdempotencyKey{UserID: userID, Key: key, RequestHash: hash, TTL: ttl}
+	resp, found, err := db.LookupIdempotencyKey(r.Context(), s.DB, idem)
+	if err != nil {
+		writeError(w, r, err)
+		return idem, true
+	}
+	if found {
+		writeStoredResponse(w, resp, true)
+	}
+	return idem, found
+}
+
+// placeOrderOnce is submitOrder's place step for a request that carries
+// an Idempotency-Key: the order and its response are stored under idem
+// together. A plain retry has already been answered by replayOrder; one
+// that races the first attempt is only recognised here, after its payment
+// is authorized, and gets the first attempt's response replayed.
+func (s *Server) placeOrderOnce(r *http.Request, idem db.IdempotencyKey, order db.NewOrder) placeFunc {
+	return func(pay db.Payment) (db.StoredResponse, bool, error) {
+		return db.PlaceOrderIdempotent(r.Context(), s.DB, idem, order, pay,
+			func(orderID int64) (db.StoredResponse, error) { return createdResponse(r, orderID) },
+		)
+	}
+}
+
+// writeStoredResponse sends a response kept under an idempotency key.
+func writeStoredResponse(w http.ResponseWriter, resp db.StoredResponse, replayed bool) {
+	if replayed {
+		w.Header().Set(replayedHeader, "true")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
@@ -0,0 +1,65 @@
+// internal/server/idempotency_test.go
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexus.local/internal/db"
+)
+
+// postOrder sends POST /api/v1/orders for user u1 with Idempotency-Key key.
+func postOrder(t *testing.T, s *Server, key string, req orderReq) *httptest.ResponseRecorder {
+	t.Helper()
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/orders", bytes.NewReader(b))
+	r.Header.Set(idempotencyHeader, key)
+	r.AddCookie(userCookie("u1"))
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, r)
+	return rec
+}
+
+func TestOrderIdempotencyKey(t *testing.T) {
+	s := newTestServer(t)
+	eggs := addItem(t, s, "eggs", 4, 3)
+	req := orderReq{Items: []orderLine{{ItemID: eggs, Quantity: 2}}}
+
+	first := postOrder(t, s, "k1", req)
+	if first.Code != http.StatusCreated || first.Header().Get(replayedHeader) != "" {
+		t.Fatalf("first attempt: %d %v: %s", first.Code, first.Header(), first.Body)
+	}
+
+	// not enough stock left for a second order, so only a replay succeeds
+	again := postOrder(t, s, "k1", req)
+	if again.Code != http.StatusCreated || again.Header().Get(replayedHeader) != "true" || again.Body.String() != first.Body.String() {
+		t.Errorf("retry: %d replayed %q %s, want 201 replayed %s",
+			again.Code, again.Header().Get(replayedHeader), again.Body, first.Body)
+	}
+
+	req.Items[0].Quantity = 1
+	rec := postOrder(t, s, "k1", req)
+	var body errorResponse
+	decodeBody(t, rec, &body)
+	if rec.Code != http.StatusUnprocessableEntity || body.Error.Code != CodeIdempotencyReused {
+		t.Errorf("changed request: %d %s, want 422 %s", rec.Code, rec.Body, CodeIdempotencyReused)
+	}
+
+	if rec := postOrder(t, s, "k\x01", req); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid key: status %d, want 400", rec.Code)
+	}
+	orders, err := db.GetOrdersByUser(context.Background(), s.DB, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 {
+		t.Errorf("%d orders, want 1", len(orders))
+	}
+}
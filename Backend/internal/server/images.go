@@ -0,0 +1,210 @@
+// internal/server/images.go
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/images"
+	"nexus.local/internal/logging"
+)
+
+// storeImage runs an upload through the image pipeline and stores every
+// variant under a fresh directory, items/<random>/<variant><ext>. It
+// returns the key of the full‑size variant, which is what the database
+// keeps. A file that isn't an acceptable image is a 415 or 400.
+func (s *Server) storeImage(ctx context.Context, file io.Reader) (string, error) {
+	img, err := images.Process(file)
+	switch {
+	case errors.Is(err, images.ErrUnsupported):
+		return "", wrapError(http.StatusUnsupportedMediaType, CodeUnsupportedMedia, err.Error(), err)
+	case errors.Is(err, images.ErrInvalid):
+		return "", wrapError(http.StatusBadRequest, CodeInvalidImage, err.Error(), err)
+	case err != nil:
+		return "", err
+	}
+
+	var b [8]byte
+	rand.Read(b[:])
+	dir := fmt.Sprintf("items/%x/", b)
+	for _, v := range images.Variants {
+		data := img.Files[v.Name]
+		key := dir + v.Name + img.Ext
+		if err := s.Blobs.Put(ctx, key, bytes.NewReader(data), int64(len(data)), img.ContentType); err != nil {
+			s.deleteImage(ctx, dir+"full"+img.Ext)
+			return "", fmt.Errorf("store image: %w", err)
+		}
+	}
+	return dir + "full" + img.Ext, nil
+}
+
+// deleteImage removes every variant of the image whose full‑size key is
+// fullKey. Failures are only logged: a stray blob costs a little storage,
+// not correctness.
+func (s *Server) deleteImage(ctx context.Context, fullKey string) {
+	if fullKey == "" {
+		return
+	}
+	for _, v := range images.Variants {
+		if err := s.Blobs.Delete(ctx, variantKey(fullKey, v.Name)); err != nil {
+			logging.FromContext(ctx).Warn("could not delete image blob",
+				slog.String("key", variantKey(fullKey, v.Name)), slog.Any("error", err))
+		}
+	}
+}
+
+// variantKey turns the key of a full‑size image into the key of another
+// variant. Images stored before the pipeline existed are a single file,
+// which then stands in for every size.
+func variantKey(fullKey, variant string) string {
+	dir, file := path.Split(fullKey)
+	ext := path.Ext(file)
+	if strings.TrimSuffix(file, ext) != "full" {
+		return fullKey
+	}
+	return dir + variant + ext
+}
+
+// imageURLs asks the blob store for the URL of every variant of the image
+// whose full‑size key is fullKey.
+func (s *Server) imageURLs(ctx context.Context, fullKey string) (db.ImageVariants, error) {
+	urls := make(map[string]string, len(images.Variants))
+	for _, v := range images.Variants {
+		u, err := s.Blobs.URL(ctx, variantKey(fullKey, v.Name))
+		if err != nil {
+			return db.ImageVariants{}, fmt.Errorf("image url for %s: %w", fullKey, err)
+		}
+		urls[v.Name] = u
+	}
+	return db.ImageVariants{Thumb: urls["thumb"], Medium: urls["medium"], Full: urls["full"]}, nil
+}
+
+// fillGalleryURLs sets URLs on every image in gallery.
+func (s *Server) fillGalleryURLs(ctx context.Context, gallery []db.ItemImage) error {
+	for i := range gallery {
+		urls, err := s.imageURLs(ctx, gallery[i].Key)
+		if err != nil {
+			return err
+		}
+		gallery[i].URLs = urls
+	}
+	return nil
+}
+
+// fillImageURLs sets the gallery URLs of every item, plus Images and
+// ImageURL from its primary image, asking the blob store for (possibly
+// signed, short‑lived) URLs.
+func (s *Server) fillImageURLs(ctx context.Context, items []db.Item) error {
+	for i := range items {
+		it := &items[i]
+		if err := s.fillGalleryURLs(ctx, it.Gallery); err != nil {
+			return err
+		}
+		for _, img := range it.Gallery {
+			if img.Primary {
+				it.Images = &img.URLs
+				it.ImageURL = img.URLs.Full
+			}
+		}
+	}
+	return nil
+}
+
+// addImageReq is the multipart form posted to /items/images (minus the
+// image itself).
+type addImageReq struct {
+	ItemID  int    `form:"item_id" validate:"required,min=1"`
+	AltText string `form:"alt_text" validate:"max=255"`
+}
+
+// reorderImagesReq sets the display order of an item's gallery.
+type reorderImagesReq struct {
+	ItemID    int     `json:"item_id" validate:"min=1"`
+	ImageIDs  []int64 `json:"image_ids" validate:"required,max=100"` // every image, in the new order
+	PrimaryID int64   `json:"primary_id,omitempty"`                  // new primary image, if it changes
+}
+
+// POST /items/images — add one image to an item's gallery
+func (s *Server) addItemImageHandler(w http.ResponseWriter, r *http.Request) {
+	var req addImageReq
+	if err := parseUpload(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		writeError(w, r, validationError([]FieldError{{"image", "is required"}}))
+		return
+	}
+	defer file.Close()
+
+	key, err := s.storeImage(r.Context(), file)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	img, err := db.AddItemImage(r.Context(), s.DB, req.ItemID, key, req.AltText)
+	if err == nil {
+		img.URLs, err = s.imageURLs(r.Context(), key)
+	}
+	if err != nil {
+		s.deleteImage(r.Context(), key)
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, img, http.StatusCreated)
+}
+
+// POST /items/images/reorder — reorder a gallery and/or change its primary
+func (s *Server) reorderItemImagesHandler(w http.ResponseWriter, r *http.Request) {
+	var req reorderImagesReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err := db.ReorderItemImages(r.Context(), s.DB, req.ItemID, req.ImageIDs, req.PrimaryID)
+	if errors.Is(err, db.ErrNotFound) {
+		err = wrapError(http.StatusBadRequest, CodeValidation,
+			"image_ids must list every image of the item exactly once", err)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	gallery, err := db.GetItemImages(r.Context(), s.DB, req.ItemID)
+	if err == nil {
+		err = s.fillGalleryURLs(r.Context(), gallery)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, gallery, http.StatusOK)
+}
+
+// DELETE /items/images?item_id=1&image_id=2
+func (s *Server) deleteItemImageHandler(w http.ResponseWriter, r *http.Request) {
+	itemID, err1 := strconv.Atoi(r.URL.Query().Get("item_id"))
+	imageID, err2 := strconv.ParseInt(r.URL.Query().Get("image_id"), 10, 64)
+	if err1 != nil || err2 != nil {
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "item_id and image_id must be numbers"))
+		return
+	}
+	key, err := db.DeleteItemImage(r.Context(), s.DB, itemID, imageID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	s.deleteImage(r.Context(), key)
+	w.WriteHeader(http.StatusNoContent)
+}
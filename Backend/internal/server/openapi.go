@@ -0,0 +1,282 @@
+// internal/server/openapi.go
+package server
+
+import (
+	"embed"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed docs/index.html
+var docsFS embed.FS
+
+// openAPI builds an OpenAPI 3.1 document describing eps.
+func openAPI(eps []endpoint) map[string]any {
+	g := &schemaGen{components: map[string]any{}}
+	errResp := map[string]any{
+		"description": "error",
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(errorResponse{}))},
+		},
+	}
+
+	paths := map[string]any{}
+	for _, ep := range eps {
+		op := map[string]any{
+			"summary":     ep.Summary,
+			"operationId": operationID(ep),
+		}
+
+		var params []any
+		for _, p := range ep.Query {
+			params = append(params, map[string]any{
+				"name":        p.Name,
+				"in":          "query",
+				"description": p.Description,
+				"required":    p.Required,
+				"schema":      map[string]any{"type": p.Type},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		switch {
+		case ep.Body != nil:
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(ep.Body))},
+				},
+			}
+		case ep.Form != nil:
+			form := g.object(reflect.TypeOf(ep.Form), "form")
+			props := form["properties"].(map[string]any)
+			for _, f := range ep.Files {
+				props[f] = map[string]any{"type": "string", "contentMediaType": "application/octet-stream"}
+			}
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"multipart/form-data": map[string]any{"schema": form}},
+			}
+		}
+
+		ok := map[string]any{"description": http.StatusText(ep.Status)}
+		if ep.Result != nil {
+			ok["content"] = map[string]any{
+				"application/json": map[string]any{"schema": g.result(ep.Result)},
+			}
+		}
+		op["responses"] = map[string]any{
+			strconv.Itoa(ep.Status): ok,
+			"default":               errResp,
+		}
+
+		switch ep.Access {
+		case signedIn:
+			op["security"] = []any{map[string]any{"idToken": []string{}}}
+		case adminOnly:
+			op["security"] = []any{map[string]any{"idToken": []string{}}}
+			op["description"] = "Requires an admin account."
+		case graphToken:
+			op["security"] = []any{map[string]any{"accessToken": []string{}}}
+		}
+
+		item, _ := paths[ep.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			if ep.Unversioned {
+				item["servers"] = []any{map[string]any{"url": "/"}}
+			}
+			paths[ep.Path] = item
+		}
+		item[strings.ToLower(ep.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Nexus Local API",
+			"version": "1.0.0",
+			"description": fmt.Sprintf("Every API path is also served at the root without %s; "+
+				"those aliases are deprecated and will be removed on %s.",
+				apiPrefix, legacySunset.Format(time.DateOnly)),
+		},
+		"servers": []any{map[string]any{"url": apiPrefix}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.components,
+			"securitySchemes": map[string]any{
+				"idToken":     map[string]any{"type": "apiKey", "in": "cookie", "name": "id_token"},
+				"accessToken": map[string]any{"type": "apiKey", "in": "cookie", "name": "access_token"},
+			},
+		},
+	}
+}
+
+// operationID derives a stable id such as "getOrders" or "postItemsAdd".
+func operationID(ep endpoint) string {
+	id := strings.ToLower(ep.Method)
+	for _, part := range strings.FieldsFunc(ep.Path, func(r rune) bool {
+		return r == '/' || r == '_' || r == '-' || r == '{' || r == '}'
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// openAPIHandler serves the spec built once at startup.
+func openAPIHandler(spec map[string]any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, r, spec, http.StatusOK)
+	}
+}
+
+// docsHandler serves the bundled, offline API browser.
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	http.ServeFileFS(w, r, docsFS, "docs/index.html")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaGen turns Go types into JSON Schema, collecting named structs
+// under components/schemas.
+type schemaGen struct {
+	components map[string]any
+}
+
+func (g *schemaGen) result(v any) map[string]any {
+	if alts, ok := v.(oneOf); ok {
+		var list []any
+		for _, alt := range alts {
+			list = append(list, g.schema(reflect.TypeOf(alt)))
+		}
+		return map[string]any{"oneOf": list}
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		inner := g.schema(t.Elem())
+		if typ, ok := inner["type"].(string); ok {
+			inner["type"] = []string{typ, "null"}
+			return inner
+		}
+		return map[string]any{"oneOf": []any{inner, map[string]any{"type": "null"}}}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, seen := g.components[name]; !seen {
+			g.components[name] = nil // guards against recursive types
+			g.components[name] = g.object(t, "json")
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	panic(fmt.Sprintf("openapi: cannot describe %s", t))
+}
+
+// object describes struct t using the given tag ("json" or "form") for
+// property names. A property is required when it has a `validate:"required"`
+// rule, or—for output types, which carry no validate tags—whenever it is
+// not omitempty.
+func (g *schemaGen) object(t reflect.Type, tag string) map[string]any {
+	props := map[string]any{}
+	var required []string
+	output := !hasValidateTags(t)
+	g.fields(t, tag, output, props, &required)
+	obj := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+func (g *schemaGen) fields(t reflect.Type, tag string, output bool, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, tag, output, props, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get(tag), ",")
+		if name == "-" || (name == "" && tag == "form") {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := g.schema(f.Type)
+		applyRules(s, f)
+		props[name] = s
+		if hasRule(f, "required") || (output && !strings.Contains(opts, "omitempty")) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// applyRules mirrors a field's min/max validate rules into its schema.
+func applyRules(s map[string]any, f reflect.StructField) {
+	for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+		key, arg, _ := strings.Cut(rule, "=")
+		if key != "min" && key != "max" {
+			continue
+		}
+		n, _ := strconv.ParseFloat(arg, 64)
+		var kw string
+		switch typ, _ := s["type"].(string); typ {
+		case "string":
+			kw = map[string]string{"min": "minLength", "max": "maxLength"}[key]
+		case "array":
+			kw = map[string]string{"min": "minItems", "max": "maxItems"}[key]
+		default:
+			kw = map[string]string{"min": "minimum", "max": "maximum"}[key]
+		}
+		s[kw] = n
+	}
+}
+
+func hasValidateTags(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("validate") != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaName exports unexported Go type names, e.g. orderReq → OrderReq.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		panic(fmt.Sprintf("openapi: anonymous struct %s needs a named type", t))
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
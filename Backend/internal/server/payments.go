@@ -0,0 +1,152 @@
+// internal/server/payments.go
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+	"nexus.local/internal/metrics"
+	"nexus.local/internal/payments"
+)
+
+// captureReq names the order whose payment to capture.
+type captureReq struct {
+	OrderID int64 `json:"order_id" validate:"min=1"`
+}
+
+// authorizePayment reserves amount (in cents) on the customer's payment
+// method. Orders that come to nothing need no payment.
+func (s *Server) authorizePayment(ctx context.Context, amount int64, source string) (db.Payment, error) {
+	if amount <= 0 {
+		return db.Payment{}, nil
+	}
+	var ref [12]byte
+	rand.Read(ref[:])
+	auth, err := s.Payments.Authorize(ctx, payments.AuthorizeRequest{
+		Amount:    amount,
+		Currency:  s.Currency,
+		Source:    source,
+		Reference: "ord_" + hex.EncodeToString(ref[:]),
+	})
+	countPayment("authorize", err)
+	if err != nil {
+		return db.Payment{}, err
+	}
+	return db.Payment{ID: auth.ID, Amount: auth.Amount, Currency: auth.Currency}, nil
+}
+
+// voidPayment releases the authorization of an order that wasn't placed.
+// It is best effort: a failure is logged, and an authorization left
+// behind expires at the provider on its own.
+func (s *Server) voidPayment(ctx context.Context, pay db.Payment) {
+	if pay.ID == "" {
+		return
+	}
+	err := s.Payments.Void(ctx, pay.ID)
+	countPayment("void", err)
+	if err != nil {
+		logging.FromContext(ctx).Warn("could not void payment",
+			slog.String("payment_id", pay.ID), slog.Any("error", err))
+	}
+}
+
+// countPayment records the outcome of a gateway call.
+func countPayment(op string, err error) {
+	result := "success"
+	switch {
+	case errors.Is(err, payments.ErrDeclined):
+		result = "declined"
+	case err != nil:
+		result = "error"
+	}
+	metrics.Payments.WithLabelValues(op, result).Inc()
+}
+
+// POST /orders/capture — take the authorized payment of an order, e.g.
+// when it is handed over
+func (s *Server) captureOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var req captureReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	order, _, err := db.GetOrderByID(r.Context(), s.DB, req.OrderID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if order.PaymentStatus != db.PaymentAuthorized {
+		writeError(w, r, newError(http.StatusConflict, CodeConflict, "order payment is "+order.PaymentStatus+", not authorized"))
+		return
+	}
+	err = s.Payments.Capture(r.Context(), order.PaymentID, order.Amount)
+	countPayment("capture", err)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err = db.SetPaymentStatus(r.Context(), s.DB, order.ID, db.PaymentAuthorized, db.PaymentCaptured)
+	if err == nil {
+		order.PaymentStatus = db.PaymentCaptured
+	} else if errors.Is(err, db.ErrConflict) {
+		// the provider's capture webhook got here first
+		order, _, err = db.GetOrderByID(r.Context(), s.DB, req.OrderID)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, order, http.StatusOK)
+}
+
+// webhookAck answers a webhook delivery.
+type webhookAck struct {
+	Received  bool   `json:"received"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Outcome   string `json:"outcome,omitempty"`
+}
+
+// maxWebhookBody caps a webhook delivery.
+const maxWebhookBody = 64 << 10
+
+// POST /webhooks/payments — events from the payment provider. The
+// signature is checked against the raw body, so it is read in full before
+// anything is decoded. Any 2xx tells the provider to stop redelivering.
+func (s *Server) paymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		writeError(w, r, newError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "webhook body too large"))
+		return
+	}
+	ev, err := s.Payments.VerifyWebhook(payload, r.Header)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	logging.Annotate(r.Context(), slog.String("event_id", ev.ID), slog.String("event_type", ev.Type))
+	rec, duplicate, err := db.ApplyPaymentEvent(r.Context(), s.DB, *ev, payload)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	metrics.PaymentEvents.WithLabelValues(ev.Type, eventResult(rec.Outcome, duplicate)).Inc()
+	if rec.Outcome == db.EventUnknownPayment {
+		logging.FromContext(r.Context()).Warn("payment event for unknown payment",
+			slog.String("event_id", ev.ID), slog.String("payment_id", ev.PaymentID))
+	}
+	jsonResponse(w, r, webhookAck{Received: true, Duplicate: duplicate, Outcome: rec.Outcome}, http.StatusOK)
+}
+
+func eventResult(outcome string, duplicate bool) string {
+	if duplicate {
+		return "duplicate"
+	}
+	return outcome
+}
@@ -0,0 +1,122 @@
+// internal/server/promotions.go
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/promo"
+)
+
+// addPromotionReq creates a promotion; without a code it applies to every
+// order it fits.
+type addPromotionReq struct {
+	Code        string `json:"code,omitempty" validate:"max=64"`
+	Name        string `json:"name" validate:"required,max=255"`
+	Kind        string `json:"kind" validate:"required,max=16"` // percent, fixed or buy_x_get_y
+	Value       int64  `json:"value,omitempty" validate:"min=0"`
+	BuyQuantity int    `json:"buy_quantity,omitempty" validate:"min=0"`
+	GetQuantity int    `json:"get_quantity,omitempty" validate:"min=0"`
+
+	MinOrder       int64      `json:"min_order,omitempty" validate:"min=0"`
+	VendorID       int64      `json:"vendor_id,omitempty" validate:"min=0"`
+	ItemID         int        `json:"item_id,omitempty" validate:"min=0"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	MaxUses        int        `json:"max_uses,omitempty" validate:"min=0"`
+	MaxUsesPerUser int        `json:"max_uses_per_user,omitempty" validate:"min=0"`
+}
+
+// check validates what the struct tags can't.
+func (req addPromotionReq) check() []FieldError {
+	var errs []FieldError
+	switch promo.Kind(req.Kind) {
+	case promo.Percent:
+		if req.Value < 1 || req.Value > 10000 {
+			errs = append(errs, FieldError{"value", "must be between 1 and 10000 basis points"})
+		}
+	case promo.Fixed:
+		if req.Value < 1 {
+			errs = append(errs, FieldError{"value", "must be at least 1 cent"})
+		}
+	case promo.BuyXGetY:
+		if req.BuyQuantity < 1 {
+			errs = append(errs, FieldError{"buy_quantity", "must be at least 1"})
+		}
+		if req.GetQuantity < 1 {
+			errs = append(errs, FieldError{"get_quantity", "must be at least 1"})
+		}
+	default:
+		errs = append(errs, FieldError{"kind", "must be percent, fixed or buy_x_get_y"})
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		errs = append(errs, FieldError{"ends_at", "must be after starts_at"})
+	}
+	return errs
+}
+
+// promotionActiveReq switches a promotion on or off.
+type promotionActiveReq struct {
+	ID     int64 `json:"id" validate:"min=1"`
+	Active bool  `json:"active"`
+}
+
+// GET /promotions
+func (s *Server) getPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	promos, err := db.ListPromotions(r.Context(), s.DB)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, promos, http.StatusOK)
+}
+
+// POST /promotions — new promotions start active
+func (s *Server) addPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	var req addPromotionReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if errs := req.check(); len(errs) > 0 {
+		writeError(w, r, validationError(errs))
+		return
+	}
+	p, err := db.AddPromotion(r.Context(), s.DB, promo.Promotion{
+		Code:           req.Code,
+		Name:           req.Name,
+		Kind:           promo.Kind(req.Kind),
+		Value:          req.Value,
+		BuyQuantity:    req.BuyQuantity,
+		GetQuantity:    req.GetQuantity,
+		MinOrder:       req.MinOrder,
+		VendorID:       req.VendorID,
+		ItemID:         req.ItemID,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		Active:         true,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, p, http.StatusCreated)
+}
+
+// POST /promotions/active — promotions are switched off rather than
+// deleted, since orders refer to them
+func (s *Server) setPromotionActiveHandler(w http.ResponseWriter, r *http.Request) {
+	var req promotionActiveReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := db.SetPromotionActive(r.Context(), s.DB, req.ID, req.Active); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
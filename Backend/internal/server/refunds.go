@@ -0,0 +1,133 @@
+// internal/server/refunds.go
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+	"nexus.local/internal/payments"
+)
+
+// refundReq refunds some or all of an order. Without items, everything not
+// refunded yet is refunded.
+type refundReq struct {
+	OrderID int64       `json:"order_id" validate:"min=1"`
+	Items   []orderLine `json:"items,omitempty" validate:"max=100"`
+	Restock bool        `json:"restock"` // put the refunded items back in stock
+	Reason  string      `json:"reason,omitempty" validate:"max=500"`
+}
+
+// retryRefundReq names a pending refund to send to the provider again.
+type retryRefundReq struct {
+	RefundID int64 `json:"refund_id" validate:"min=1"`
+}
+
+// refundResult is a refund and its order's totals after it.
+type refundResult struct {
+	Refund db.Refund `json:"refund"`
+	Order  *db.Order `json:"order"`
+}
+
+// POST /orders/refund — give back a whole order or some of its lines
+func (s *Server) refundOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var req refundReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	adminID, err := s.extractUserID(r)
+	if err != nil {
+		writeError(w, r, errNotAuthenticated)
+		return
+	}
+	items := make(map[int]int, len(req.Items))
+	for _, line := range req.Items {
+		items[line.ItemID] += line.Quantity
+	}
+	rf, err := db.BeginRefund(r.Context(), s.DB, db.RefundRequest{
+		OrderID:   req.OrderID,
+		Items:     items,
+		Restock:   req.Restock,
+		Reason:    req.Reason,
+		CreatedBy: adminID,
+	})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	logging.Annotate(r.Context(), slog.Int64("refund_id", rf.ID))
+	s.finishRefund(w, r, rf, http.StatusCreated)
+}
+
+// POST /orders/refund/retry — ask the provider again for a refund left
+// pending by a provider outage
+func (s *Server) retryRefundHandler(w http.ResponseWriter, r *http.Request) {
+	var req retryRefundReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rf, err := db.GetRefund(r.Context(), s.DB, req.RefundID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if rf.Status != db.RefundPending {
+		writeError(w, r, newError(http.StatusConflict, CodeConflict, "refund is "+rf.Status+", not pending"))
+		return
+	}
+	s.finishRefund(w, r, rf, http.StatusOK)
+}
+
+// finishRefund pays out a pending refund through the provider, records the
+// outcome and answers with the refund and its order.
+func (s *Server) finishRefund(w http.ResponseWriter, r *http.Request, rf db.Refund, status int) {
+	if rf.Status == db.RefundPending {
+		if err := s.payRefund(r.Context(), &rf); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	order, _, err := db.GetOrderByID(r.Context(), s.DB, rf.OrderID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, refundResult{Refund: rf, Order: order}, status)
+}
+
+// payRefund asks the provider for a pending refund's money. The reference
+// is derived from the refund, so a retry can't pay out twice. A refusal
+// fails the refund; if the provider can't be reached the outcome is
+// unknown, so the refund stays pending for a retry.
+func (s *Server) payRefund(ctx context.Context, rf *db.Refund) error {
+	res, err := s.Payments.Refund(ctx, payments.RefundRequest{
+		PaymentID: rf.PaymentID,
+		Amount:    rf.Amount,
+		Reference: "refund_" + strconv.FormatInt(rf.ID, 10),
+	})
+	countPayment("refund", err)
+	switch {
+	case err == nil:
+		if err := db.CompleteRefund(ctx, s.DB, rf.ID, res.ID); err != nil {
+			return err
+		}
+		rf.Status, rf.GatewayRefundID = db.RefundSucceeded, res.ID
+		return nil
+	case errors.Is(err, payments.ErrDeclined),
+		errors.Is(err, payments.ErrInvalidRequest),
+		errors.Is(err, payments.ErrNotFound):
+		if ferr := db.FailRefund(ctx, s.DB, rf.ID); ferr != nil {
+			return ferr
+		}
+		return err
+	}
+	logging.FromContext(ctx).Warn("refund left pending",
+		slog.Int64("refund_id", rf.ID), slog.Any("error", err))
+	return err
+}
@@ -2,131 +2,182 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 
 	"nexus.local/internal/db"
+	"nexus.local/internal/logging"
+	"nexus.local/internal/metrics"
 )
 
+// maxUploadBody caps the multipart body of an item upload.
+const maxUploadBody = 10 << 20
+
 // orderLine is a single line‐item in the client’s payload.
 type orderLine struct {
-	ItemID   int `json:"item_id"`
-	Quantity int `json:"quantity"`
+	ItemID   int `json:"item_id" validate:"min=1"`
+	Quantity int `json:"quantity" validate:"min=1,max=1000"`
 }
 
 // orderReq no longer has a UserID field.
 type orderReq struct {
-	Items []orderLine `json:"items"`
+	Items []orderLine `json:"items" validate:"required,max=100"`
+
+	// PaymentToken is the tokenised payment method from the payment
+	// provider's client library.
+	PaymentToken string `json:"payment_token,omitempty" validate:"max=255"`
+
+	// PostalCode is where the order goes, which decides its tax.
+	PostalCode string `json:"postal_code,omitempty" validate:"max=16"`
+
+	// PromoCode is applied on top of any automatic promotions.
+	PromoCode string `json:"promo_code,omitempty" validate:"max=64"`
+
+	// SlotID books the order into a pickup or delivery time slot; a
+	// delivery also needs DeliveryAddress.
+	SlotID          int64  `json:"slot_id,omitempty" validate:"min=0"`
+	DeliveryAddress string `json:"delivery_address,omitempty" validate:"max=255"`
+}
+
+// quoteReq asks what an order would cost; see orderReq.
+type quoteReq struct {
+	Items           []orderLine `json:"items" validate:"required,max=100"`
+	PostalCode      string      `json:"postal_code,omitempty" validate:"max=16"`
+	PromoCode       string      `json:"promo_code,omitempty" validate:"max=64"`
+	SlotID          int64       `json:"slot_id,omitempty" validate:"min=0"`
+	DeliveryAddress string      `json:"delivery_address,omitempty" validate:"max=255"`
 }
 
 type stockUpdateReq struct {
-	ItemID int `json:"item_id"`
-	Stock  int `json:"stock"`
+	ItemID int `json:"item_id" validate:"min=1"`
+	Stock  int `json:"stock" validate:"min=0,max=1000000"`
+}
+
+// addItemReq is the multipart form posted to /items/add (minus the image).
+type addItemReq struct {
+	Name        string  `form:"name" validate:"required,max=255"`
+	Description string  `form:"description" validate:"max=2000"`
+	Price       float64 `form:"price" validate:"required,min=0,max=100000"`
+	Stock       int     `form:"stock" validate:"required,min=0,max=1000000"`
+	VendorID    int64   `form:"vendor_id" validate:"min=0"`
+	TaxCategory string  `form:"tax_category" validate:"max=32"` // default "general"
+}
+
+// itemCreated is returned by /items/add.
+type itemCreated struct {
+	ItemID int64 `json:"item_id"`
+}
+
+// orderCreated is returned by POST /orders.
+type orderCreated struct {
+	OrderID int64 `json:"order_id"`
+}
+
+// orderDetail is one order together with its line‐items, refunds and
+// per‐vendor sub‐orders. Status combines the sub‐orders' statuses.
+type orderDetail struct {
+	Order      *db.Order      `json:"order"`
+	Status     string         `json:"status"`
+	OrderItems []db.OrderItem `json:"order_items"`
+	SubOrders  []db.SubOrder  `json:"sub_orders"`
+	Refunds    []db.Refund    `json:"refunds"`
 }
 
 // GET /items
 func (s *Server) getItemsHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	items, err := db.GetAllItems(r.Context(), s.DB)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	items, err := db.GetAllItems(s.DB)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := s.fillImageURLs(r.Context(), items); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	jsonResponse(w, items, http.StatusOK)
+	jsonResponse(w, r, items, http.StatusOK)
 }
 
 // POST /items/add (with image upload)
 func (s *Server) addItemHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	var req addItemReq
+	if err := parseUpload(w, r, &req); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "could not parse form", http.StatusBadRequest)
-		return
+
+	// 1) validate and store the image first, so a bad file is rejected
+	//    before anything is created
+	var imgKey string
+	file, _, err := r.FormFile("image")
+	if err == nil {
+		defer file.Close()
+		imgKey, err = s.storeImage(r.Context(), file)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
 	}
-	name := r.FormValue("name")
-	desc := r.FormValue("description")
-	price, _ := strconv.ParseFloat(r.FormValue("price"), 64)
-	stock, _ := strconv.Atoi(r.FormValue("stock"))
 
-	// 1) insert without image_url
-	newID, err := db.AddItemWithImageURL(s.DB, name, desc, price, stock, "")
+	// 2) insert the item, with the image as the start of its gallery
+	newID, err := db.AddItem(r.Context(), s.DB, db.Item{
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+		Stock:       req.Stock,
+		VendorID:    req.VendorID,
+		TaxCategory: req.TaxCategory,
+	})
+	if err == nil && imgKey != "" {
+		_, err = db.AddItemImage(r.Context(), s.DB, int(newID), imgKey, req.Name)
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.deleteImage(r.Context(), imgKey)
+		writeError(w, r, err)
 		return
 	}
 
-	// 2) save uploaded image if present
-	file, header, err := r.FormFile("image")
-	if err == nil {
-		defer file.Close()
-		ext := filepath.Ext(header.Filename)
-		filename := fmt.Sprintf("%d%s", newID, ext)
-		dstPath := filepath.Join("uploads", filename)
-		out, err := os.Create(dstPath)
-		if err == nil {
-			defer out.Close()
-			io.Copy(out, file)
-			imageURL := "/uploads/" + filename
-			if err := db.UpdateItemImageURL(s.DB, int(newID), imageURL); err != nil {
-				log.Println("failed to update image_url:", err)
-			}
+	jsonResponse(w, r, itemCreated{ItemID: newID}, http.StatusCreated)
+}
+
+// parseUpload reads a multipart upload of at most maxUploadBody and fills
+// dst from its form fields; the caller fetches the files itself.
+func parseUpload(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBody)
+	if err := r.ParseMultipartForm(maxUploadBody); err != nil {
+		var sizeErr *http.MaxBytesError
+		if errors.As(err, &sizeErr) {
+			return newError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "upload must not exceed 10 MB")
 		}
+		return newError(http.StatusBadRequest, CodeBadRequest, "could not parse form")
 	}
-
-	jsonResponse(w, map[string]int64{"item_id": newID}, http.StatusCreated)
+	return decodeForm(r, dst)
 }
 
 // POST /items/update
 func (s *Server) updateStockHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 	var req stockUpdateReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	if err := db.UpdateItemStock(s.DB, req.ItemID, req.Stock); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := db.UpdateItemStock(r.Context(), s.DB, req.ItemID, req.Stock); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	items, err := db.GetAllItems(s.DB)
+	items, err := db.GetAllItems(r.Context(), s.DB)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	jsonResponse(w, items, http.StatusOK)
-}
-
-// ordersHandler dispatches GET, POST, DELETE on /orders
-func (s *Server) ordersHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		if r.URL.Query().Get("order_id") != "" {
-			s.getOrderHandler(w, r)
-		} else {
-			s.getOrdersHandler(w, r)
-		}
-	case http.MethodPost:
-		s.placeOrderHandler(w, r)
-	case http.MethodDelete:
-		s.deleteOrderHandler(w, r)
-	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	if err := s.fillImageURLs(r.Context(), items); err != nil {
+		writeError(w, r, err)
+		return
 	}
+	jsonResponse(w, r, items, http.StatusOK)
 }
 
 // extractUserID verifies the id_token cookie and returns the Azure OID.
@@ -135,7 +186,7 @@ func (s *Server) extractUserID(r *http.Request) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	idToken, err := s.AuthApp.Verifier.Verify(context.Background(), ck.Value)
+	idToken, err := s.AuthApp.Verifier.Verify(r.Context(), ck.Value)
 	if err != nil {
 		return "", err
 	}
@@ -145,22 +196,27 @@ func (s *Server) extractUserID(r *http.Request) (string, error) {
 	if err := idToken.Claims(&claims); err != nil {
 		return "", err
 	}
+	logging.Annotate(r.Context(), slog.String("user_id", claims.OID))
 	return claims.OID, nil
 }
 
 // GET /orders — only the logged‑in user’s orders
 func (s *Server) getOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("order_id") != "" {
+		s.getOrderHandler(w, r)
+		return
+	}
 	userID, err := s.extractUserID(r)
 	if err != nil {
-		http.Error(w, "not authenticated", http.StatusUnauthorized)
+		writeError(w, r, errNotAuthenticated)
 		return
 	}
-	orders, err := db.GetOrdersByUser(s.DB, userID)
+	orders, err := db.GetOrdersByUser(r.Context(), s.DB, userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	jsonResponse(w, orders, http.StatusOK)
+	jsonResponse(w, r, orders, http.StatusOK)
 }
 
 // GET /orders?order_id=123 — only if it belongs to the user
@@ -168,98 +224,240 @@ func (s *Server) getOrderHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("order_id")
 	orderID, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		http.Error(w, "invalid order_id", http.StatusBadRequest)
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid order_id"))
 		return
 	}
-	order, lines, err := db.GetOrderByID(s.DB, orderID)
+	order, lines, err := db.GetOrderByID(r.Context(), s.DB, orderID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	userID, err := s.extractUserID(r)
 	if err != nil {
-		http.Error(w, "not authenticated", http.StatusUnauthorized)
+		writeError(w, r, errNotAuthenticated)
 		return
 	}
 	if order.UserID != userID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		writeError(w, r, errForbidden)
 		return
 	}
-	jsonResponse(w, map[string]any{
-		"order":       order,
-		"order_items": lines,
+	refunds, err := db.GetRefunds(r.Context(), s.DB, orderID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	subs, err := db.GetSubOrders(r.Context(), s.DB, orderID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, orderDetail{
+		Order:      order,
+		Status:     db.OrderStatus(subs),
+		OrderItems: lines,
+		SubOrders:  subs,
+		Refunds:    refunds,
 	}, http.StatusOK)
 }
 
-// POST /orders — place under the extracted userID
+// POST /orders — authorize the payment, then place under the extracted
+// userID; see idempotency.go for requests with an Idempotency-Key
 func (s *Server) placeOrderHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 	var req orderReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	userID, err := s.extractUserID(r)
 	if err != nil {
-		http.Error(w, "not authenticated", http.StatusUnauthorized)
+		writeError(w, r, errNotAuthenticated)
+		return
+	}
+	key := r.Header.Get(idempotencyHeader)
+	if _, sent := r.Header[idempotencyHeader]; sent && !validIdempotencyKey(key) {
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid Idempotency-Key header"))
 		return
 	}
-	orderMap := make(map[int]int)
+	var idem db.IdempotencyKey
+	if key != "" {
+		var done bool
+		if idem, done = s.replayOrder(w, r, key, userID, req); done {
+			return
+		}
+	}
+	order := db.NewOrder{
+		UserID:          userID,
+		Items:           make(map[int]int),
+		PostalCode:      req.PostalCode,
+		PromoCode:       req.PromoCode,
+		SlotID:          req.SlotID,
+		DeliveryAddress: req.DeliveryAddress,
+		Holder:          db.UserHolder(userID),
+	}
 	for _, line := range req.Items {
-		if line.Quantity <= 0 {
-			http.Error(w, "quantity must be > 0", http.StatusBadRequest)
+		order.Items[line.ItemID] += line.Quantity
+	}
+	if key != "" {
+		s.submitOrder(w, r, order, req.PaymentToken, s.placeOrderOnce(r, idem, order))
+		return
+	}
+	s.submitOrder(w, r, order, req.PaymentToken, placeNew(r, func(pay db.Payment) (int64, error) {
+		return db.PlaceOrder(r.Context(), s.DB, order, pay)
+	}))
+}
+
+// placeFunc stores an order paid for by pay and returns the response to
+// send, and whether that response replays an earlier request's, in which
+// case no new order was placed.
+type placeFunc func(pay db.Payment) (resp db.StoredResponse, replayed bool, err error)
+
+// submitOrder is what POST /orders and POST /cart/checkout share once the
+// order is assembled: it refuses an order we already know we can't fill,
+// quotes it, authorizes the total and has place store it. The
+// authorization is voided if place fails or replays.
+func (s *Server) submitOrder(w http.ResponseWriter, r *http.Request, order db.NewOrder, paymentToken string, place placeFunc) {
+	ctx := r.Context()
+	held := make(map[int]int)
+	if order.Holder != "" {
+		holds, err := db.GetHolds(ctx, s.DB, order.Holder)
+		if err != nil {
+			writeError(w, r, err)
 			return
 		}
-		orderMap[line.ItemID] += line.Quantity
+		for _, h := range holds {
+			held[h.ItemID] = h.Quantity
+		}
 	}
-	for itemID := range orderMap {
-		if _, err := db.GetItem(s.DB, itemID); err != nil {
-			http.Error(w, fmt.Sprintf("item %d not found", itemID), http.StatusBadRequest)
+	for itemID, qty := range order.Items {
+		item, err := db.GetItem(ctx, s.DB, itemID)
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				err = newError(http.StatusBadRequest, CodeBadRequest, fmt.Sprintf("item %d not found", itemID))
+			}
+			writeError(w, r, err)
+			return
+		}
+		// don't authorize a payment for an order we already know we can't fill
+		if item.Available+held[itemID] < qty {
+			metrics.StockOuts.Inc()
+			writeError(w, r, fmt.Errorf("item %d: %w", itemID, db.ErrInsufficientStock))
 			return
 		}
 	}
-	orderID, err := db.PlaceOrder(s.DB, userID, orderMap)
+	quote, err := db.QuoteOrder(ctx, s.DB, order)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	jsonResponse(w, map[string]int64{"order_id": orderID}, http.StatusCreated)
+
+	pay, err := s.authorizePayment(ctx, quote.Total, paymentToken)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp, replayed, err := place(pay)
+	if err != nil || replayed {
+		s.voidPayment(ctx, pay)
+	}
+	if err != nil {
+		if errors.Is(err, db.ErrInsufficientStock) {
+			metrics.StockOuts.Inc()
+		}
+		writeError(w, r, err)
+		return
+	}
+	if !replayed {
+		metrics.OrdersPlaced.Inc()
+		metrics.OrderValue.Add(float64(quote.Total) / 100) // what was charged, in major units
+	}
+	writeStoredResponse(w, resp, replayed)
 }
 
-// DELETE /orders?order_id=123 — only if it belongs to the user
+// placeNew makes a placeFunc of place, which stores an order and returns
+// its ID.
+func placeNew(r *http.Request, place func(pay db.Payment) (int64, error)) placeFunc {
+	return func(pay db.Payment) (db.StoredResponse, bool, error) {
+		orderID, err := place(pay)
+		if err != nil {
+			return db.StoredResponse{}, false, err
+		}
+		resp, err := createdResponse(r, orderID)
+		return resp, false, err
+	}
+}
+
+// createdResponse is the 201 response to a new order, in the shape of
+// the request's API version.
+func createdResponse(r *http.Request, orderID int64) (db.StoredResponse, error) {
+	body, err := json.Marshal(forVersion(orderCreated{OrderID: orderID}, apiVersionFrom(r.Context())))
+	return db.StoredResponse{Status: http.StatusCreated, Body: append(body, '\n')}, err
+}
+
+// DELETE /orders?order_id=123 — only if it belongs to the user and no
+// vendor has accepted it yet; an authorized payment is voided, a captured
+// one must be refunded instead
 func (s *Server) deleteOrderHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Query().Get("order_id")
 	orderID, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		http.Error(w, "invalid order_id", http.StatusBadRequest)
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid order_id"))
 		return
 	}
 	userID, err := s.extractUserID(r)
 	if err != nil {
-		http.Error(w, "not authenticated", http.StatusUnauthorized)
+		writeError(w, r, errNotAuthenticated)
 		return
 	}
-	order, _, err := db.GetOrderByID(s.DB, orderID)
+	order, _, err := db.GetOrderByID(r.Context(), s.DB, orderID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	if order.UserID != userID {
-		http.Error(w, "forbidden", http.StatusForbidden)
+		writeError(w, r, errForbidden)
+		return
+	}
+	// checked again by DeleteOrder, but before the payment is voided
+	subs, err := db.GetSubOrders(r.Context(), s.DB, orderID)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	if err := db.DeleteOrder(s.DB, orderID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	for _, so := range subs {
+		if so.Status != db.SubOrderPending && so.Status != db.SubOrderCancelled {
+			writeError(w, r, newError(http.StatusConflict, CodeConflict, "a vendor has accepted the order; it can't be deleted"))
+			return
+		}
+	}
+	switch order.PaymentStatus {
+	case db.PaymentCaptured, db.PaymentPartiallyRefunded, db.PaymentRefunded:
+		writeError(w, r, newError(http.StatusConflict, CodeConflict, "the order has been paid; it can't be deleted, only refunded"))
+		return
+	case db.PaymentAuthorized:
+		// claim the payment first, so a concurrent capture can't take it
+		if err := db.SetPaymentStatus(r.Context(), s.DB, orderID, db.PaymentAuthorized, db.PaymentVoided); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		err := s.Payments.Void(r.Context(), order.PaymentID)
+		countPayment("void", err)
+		if err != nil {
+			db.SetPaymentStatus(r.Context(), s.DB, orderID, db.PaymentVoided, db.PaymentAuthorized)
+			writeError(w, r, err)
+			return
+		}
+	}
+	if err := db.DeleteOrder(r.Context(), s.DB, orderID); err != nil {
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// jsonResponse is a helper for writing JSON + status code.
-func jsonResponse(w http.ResponseWriter, data interface{}, status int) {
+// jsonResponse is a helper for writing JSON + status code. Values that
+// implement versioned are encoded in the shape of the request's API version.
+func jsonResponse(w http.ResponseWriter, r *http.Request, data interface{}, status int) {
+	data = forVersion(data, apiVersionFrom(r.Context()))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(data)
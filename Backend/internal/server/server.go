@@ -2,12 +2,18 @@
 package server
 
 import (
-	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"nexus.local/internal/auth"
+	"nexus.local/internal/db"
+	"nexus.local/internal/metrics"
+	"nexus.local/internal/payments"
+	"nexus.local/internal/storage"
+	"nexus.local/internal/tracing"
 )
 
 // GraphUser models the subset of fields we care about from MS Graph /me
@@ -26,74 +32,110 @@ type GraphUser struct {
 	ID                string   `json:"id"`
 }
 
-// Server holds your OAuth app and the database pool.
+// Server holds your OAuth app, the database pool and the blob store.
 type Server struct {
 	AuthApp *auth.App
-	DB      *sql.DB
+	DB      *db.DB
+	Blobs   storage.BlobStore
+
+	// BlobsPath is where a store that serves its own files (see
+	// storage.Local) is mounted, e.g. "/uploads".
+	BlobsPath string
+
+	// IdempotencyTTL is how long POST /orders remembers an Idempotency-Key
+	// (default 24h).
+	IdempotencyTTL time.Duration
+
+	// HoldTTL is how long a stock hold lasts before its stock is back on
+	// sale (default 10m).
+	HoldTTL time.Duration
+
+	// Payments authorizes order payments, in Currency (e.g. "usd").
+	// NewServer sets an in‑memory payments.Mock.
+	Payments payments.Gateway
+	Currency string
 }
 
-// NewServer constructs a Server with its dependencies.
-func NewServer(authApp *auth.App, db *sql.DB) *Server {
-	return &Server{AuthApp: authApp, DB: db}
+// NewServer constructs a Server with its dependencies. The auth handlers
+// are switched over to the server's JSON error envelope, and signing in
+// merges the visitor's anonymous cart into their own.
+func NewServer(authApp *auth.App, db *db.DB, blobs storage.BlobStore, blobsPath string) *Server {
+	s := &Server{
+		AuthApp:   authApp,
+		DB:        db,
+		Blobs:     blobs,
+		BlobsPath: blobsPath,
+		Payments:  payments.NewMock(""),
+		Currency:  "usd",
+	}
+	authApp.OnError = writeError
+	authApp.OnLogin = s.onLogin
+	return s
 }
 
 // routes wires up all handlers.
 func (s *Server) routes() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	// OAuth endpoints
+	// Login page
 	mux.HandleFunc("/", s.AuthApp.Root)
-	mux.HandleFunc("/login", s.AuthApp.Login)
-	mux.HandleFunc("/redirect", s.AuthApp.OAuthCallback)
 
-	// CRUD endpoints
-	mux.HandleFunc("/items", s.getItemsHandler)
-	mux.Handle("/items/add",
-		s.AuthApp.AuthMiddleware(http.HandlerFunc(s.addItemHandler)),
-	)
-	mux.Handle("/items/update",
-		s.AuthApp.AuthMiddleware(http.HandlerFunc(s.updateStockHandler)),
-	)
-	mux.HandleFunc("/orders", s.ordersHandler)
-
-	// Graph profile + DB upsert
-	mux.HandleFunc("/me", s.profileHandler)
-
-	// Logout endpoint — clears the auth cookies
-	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
-		clear := func(name string) {
-			http.SetCookie(w, &http.Cookie{
-				Name:     name,
-				Value:    "",
-				Path:     "/",
-				HttpOnly: true,
-				// SameSite: http.SameSiteNoneMode,
-				// Secure:   false, // set to true in production
-				SameSite: http.SameSiteNoneMode,
-				Secure:   true, // ← must be true if SameSite=None
-				MaxAge:   -1,
-			})
-		}
-		clear("id_token")
-		clear("access_token")
-		w.WriteHeader(http.StatusNoContent)
-	})
+	// API endpoints, plus their OpenAPI description and docs
+	eps := s.endpoints()
+	s.mount(mux, eps)
+	mux.HandleFunc("GET /openapi.json", openAPIHandler(openAPI(eps)))
+	mux.HandleFunc("GET /docs", docsHandler)
 
-	// serve uploads at /uploads/*
-	mux.Handle("/uploads/",
-		http.StripPrefix("/uploads/",
-			http.FileServer(http.Dir("uploads"))),
-	)
+	// serve uploads at /uploads/* when they live on local disk
+	if h, ok := s.Blobs.(http.Handler); ok {
+		mux.Handle(s.BlobsPath+"/", http.StripPrefix(s.BlobsPath, h))
+	}
 
 	return mux
 }
 
+// logoutHandler clears the auth cookies.
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	clear := func(name string) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: true,
+			// SameSite: http.SameSiteNoneMode,
+			// Secure:   false, // set to true in production
+			SameSite: http.SameSiteNoneMode,
+			Secure:   true, // ← must be true if SameSite=None
+			MaxAge:   -1,
+		})
+	}
+	clear("id_token")
+	clear("access_token")
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // Start runs the HTTP server with CORS enabled.
 func (s *Server) Start(addr string) error {
-	handler := corsMiddleware(s.routes())
+	handler := tracing.Middleware(
+		requestIDMiddleware(accessLogMiddleware(corsMiddleware(routeMiddleware(s.routes())))),
+	)
 	return http.ListenAndServe(addr, handler)
 }
 
+// adminRoutes wires up the operator‑only endpoints.
+func (s *Server) adminRoutes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
+
+// StartAdmin runs the admin listener. It serves /metrics and is meant to be
+// bound to a private address (localhost, or a cluster‑internal interface),
+// never exposed publicly.
+func (s *Server) StartAdmin(addr string) error {
+	return http.ListenAndServe(addr, s.adminRoutes())
+}
+
 // corsMiddleware sets CORS headers and allows credentials.
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -101,8 +143,9 @@ func corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 		// Allow cookies to be sent/received
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Deprecation, Sunset, Link, Idempotent-Replayed")
 
 		// Preflight requests
 		if r.Method == http.MethodOptions {
@@ -119,23 +162,23 @@ func (s *Server) profileHandler(w http.ResponseWriter, r *http.Request) {
 	// 1) Grab the access_token from the cookie
 	ck, err := r.Cookie("access_token")
 	if err != nil {
-		http.Error(w, "not authenticated", http.StatusUnauthorized)
+		writeError(w, r, errNotAuthenticated)
 		return
 	}
 	at := ck.Value
 
 	// 2) Call Graph /me
-	req, err := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/me", nil)
+	req, err := http.NewRequestWithContext(r.Context(), "GET", "https://graph.microsoft.com/v1.0/me", nil)
 	if err != nil {
-		http.Error(w, "failed to create request", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	req.Header.Set("Authorization", "Bearer "+at)
 
-	client := http.DefaultClient
+	client := tracing.HTTPClient
 	resp, err := client.Do(req)
 	if err != nil {
-		http.Error(w, "graph request failed: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, wrapError(http.StatusBadGateway, CodeUpstream, "profile lookup failed", err))
 		return
 	}
 	defer resp.Body.Close()
@@ -143,72 +186,45 @@ func (s *Server) profileHandler(w http.ResponseWriter, r *http.Request) {
 	// 3) Read the entire response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		http.Error(w, "failed to read graph response", http.StatusInternalServerError)
+		writeError(w, r, wrapError(http.StatusBadGateway, CodeUpstream, "profile lookup failed", err))
 		return
 	}
 
-	// If Graph didn’t return 200, just pass it through
+	// If Graph didn’t return 200, report it in our own error shape; an
+	// expired access token is a sign‑in problem, anything else is upstream.
 	if resp.StatusCode != http.StatusOK {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(resp.StatusCode)
-		w.Write(body)
+		graphErr := fmt.Errorf("graph /me returned %d: %s", resp.StatusCode, body)
+		if resp.StatusCode == http.StatusUnauthorized {
+			writeError(w, r, wrapError(http.StatusUnauthorized, CodeUnauthenticated, "not authenticated", graphErr))
+		} else {
+			writeError(w, r, wrapError(http.StatusBadGateway, CodeUpstream, "profile lookup failed", graphErr))
+		}
 		return
 	}
 
 	// 4) Decode into our GraphUser struct
 	var user GraphUser
 	if err := json.Unmarshal(body, &user); err != nil {
-		http.Error(w, "failed to parse graph response: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, wrapError(http.StatusBadGateway, CodeUpstream, "profile lookup failed", err))
 		return
 	}
 
 	// 5) Upsert into `users` table
-	phonesJSON, err := json.Marshal(user.BusinessPhones)
-	if err != nil {
-		http.Error(w, "failed to marshal phones: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	_, err = s.DB.Exec(`
-        INSERT INTO users (
-            id,
-            display_name,
-            given_name,
-            surname,
-            job_title,
-            mail,
-            mobile_phone,
-            office_location,
-            preferred_language,
-            user_principal_name,
-            business_phones
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-        ON DUPLICATE KEY UPDATE
-            display_name        = VALUES(display_name),
-            given_name          = VALUES(given_name),
-            surname             = VALUES(surname),
-            job_title           = VALUES(job_title),
-            mail                = VALUES(mail),
-            mobile_phone        = VALUES(mobile_phone),
-            office_location     = VALUES(office_location),
-            preferred_language  = VALUES(preferred_language),
-            user_principal_name = VALUES(user_principal_name),
-            business_phones     = VALUES(business_phones)
-    `,
-		user.ID,
-		user.DisplayName,
-		user.GivenName,
-		user.Surname,
-		user.JobTitle,
-		user.Mail,
-		user.MobilePhone,
-		user.OfficeLocation,
-		user.PreferredLanguage,
-		user.UserPrincipalName,
-		phonesJSON,
-	)
+	err = db.UpsertUser(r.Context(), s.DB, db.User{
+		ID:                user.ID,
+		DisplayName:       user.DisplayName,
+		GivenName:         user.GivenName,
+		Surname:           user.Surname,
+		JobTitle:          user.JobTitle,
+		Mail:              user.Mail,
+		MobilePhone:       user.MobilePhone,
+		OfficeLocation:    user.OfficeLocation,
+		PreferredLanguage: user.PreferredLanguage,
+		UserPrincipalName: user.UserPrincipalName,
+		BusinessPhones:    user.BusinessPhones,
+	})
 	if err != nil {
-		http.Error(w, "failed to upsert user: "+err.Error(), http.StatusInternalServerError)
+		writeError(w, r, fmt.Errorf("upsert user: %w", err))
 		return
 	}
 
@@ -0,0 +1,124 @@
+// internal/server/suborders.go
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"nexus.local/internal/db"
+)
+
+// subOrderStatusReq moves a sub-order along its lifecycle.
+type subOrderStatusReq struct {
+	SubOrderID int64  `json:"sub_order_id" validate:"min=1"`
+	Status     string `json:"status" validate:"required,max=16"` // accepted, ready, fulfilled or cancelled
+}
+
+// vendorStaffReq makes a user one of a vendor's staff.
+type vendorStaffReq struct {
+	UserID   string `json:"user_id" validate:"required,max=64"`
+	VendorID int64  `json:"vendor_id" validate:"min=0"` // 0 to remove them
+}
+
+// staffVendor returns the vendor the caller works for (0 for none) and
+// whether they are an admin, who may act for any vendor.
+func (s *Server) staffVendor(r *http.Request) (vendorID int64, admin bool, err error) {
+	userID, err := s.extractUserID(r)
+	if err != nil {
+		return 0, false, errNotAuthenticated
+	}
+	if vendorID, err = db.UserVendor(r.Context(), s.DB, userID); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			err = errForbidden
+		}
+		return 0, false, err
+	}
+	if admin, err = db.IsAdmin(r.Context(), s.DB, userID); err != nil {
+		return 0, false, err
+	}
+	return vendorID, admin, nil
+}
+
+// GET /vendor/orders?status=pending — the caller's vendor's sub-orders;
+// admins pick the vendor with vendor_id
+func (s *Server) getVendorOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	vendorID, admin, err := s.staffVendor(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	q := r.URL.Query()
+	if v := q.Get("vendor_id"); v != "" && admin {
+		if vendorID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid vendor_id"))
+			return
+		}
+	}
+	if vendorID == 0 {
+		writeError(w, r, errForbidden)
+		return
+	}
+	status := q.Get("status")
+	if status != "" && !db.ValidSubOrderStatus(status) {
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "unknown status"))
+		return
+	}
+	orders, err := db.GetVendorOrders(r.Context(), s.DB, vendorID, status)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, orders, http.StatusOK)
+}
+
+// POST /vendor/orders/status — vendor staff change their own sub-orders,
+// admins any, including the store's own
+func (s *Server) setSubOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var req subOrderStatusReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !db.ValidSubOrderStatus(req.Status) {
+		writeError(w, r, validationError([]FieldError{{"status", "must be accepted, ready, fulfilled or cancelled"}}))
+		return
+	}
+	vendorID, admin, err := s.staffVendor(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	so, err := db.GetSubOrder(r.Context(), s.DB, req.SubOrderID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !admin && (vendorID == 0 || so.VendorID != vendorID) {
+		writeError(w, r, errForbidden)
+		return
+	}
+	if err := db.SetSubOrderStatus(r.Context(), s.DB, so.ID, req.Status); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if so, err = db.GetSubOrder(r.Context(), s.DB, so.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, so, http.StatusOK)
+}
+
+// POST /vendors/staff
+func (s *Server) setVendorStaffHandler(w http.ResponseWriter, r *http.Request) {
+	var req vendorStaffReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := db.SetUserVendor(r.Context(), s.DB, req.UserID, req.VendorID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,198 @@
+// internal/server/tax.go
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"nexus.local/internal/db"
+	"nexus.local/internal/tax"
+)
+
+// addVendorReq creates a vendor.
+type addVendorReq struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+// itemTaxReq sets an item's vendor and tax category.
+type itemTaxReq struct {
+	ItemID      int    `json:"item_id" validate:"min=1"`
+	VendorID    int64  `json:"vendor_id" validate:"min=0"` // 0 for none
+	TaxCategory string `json:"tax_category" validate:"required,max=32"`
+}
+
+// taxRateReq sets the rate for a category in a jurisdiction.
+type taxRateReq struct {
+	Jurisdiction string `json:"jurisdiction" validate:"max=16"` // postal-code prefix; "" is everywhere
+	Category     string `json:"category" validate:"required,max=32"`
+	VendorID     int64  `json:"vendor_id,omitempty" validate:"min=0"`
+	BasisPoints  int64  `json:"basis_points" validate:"min=0,max=10000"`
+	Rounding     string `json:"rounding,omitempty" validate:"max=16"` // half_up (default), half_even, up or down
+}
+
+// taxReport is the body of GET /reports/tax.
+type taxReport struct {
+	From    time.Time       `json:"from"`
+	To      time.Time       `json:"to"`
+	Summary []db.TaxSummary `json:"summary"`
+}
+
+// GET /vendors
+func (s *Server) getVendorsHandler(w http.ResponseWriter, r *http.Request) {
+	vendors, err := db.ListVendors(r.Context(), s.DB)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, vendors, http.StatusOK)
+}
+
+// POST /vendors
+func (s *Server) addVendorHandler(w http.ResponseWriter, r *http.Request) {
+	var req addVendorReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	v, err := db.AddVendor(r.Context(), s.DB, req.Name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, v, http.StatusCreated)
+}
+
+// POST /items/tax — orders already placed keep what they were taxed at
+func (s *Server) setItemTaxHandler(w http.ResponseWriter, r *http.Request) {
+	var req itemTaxReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := db.SetItemTax(r.Context(), s.DB, req.ItemID, req.VendorID, req.TaxCategory); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	item, err := db.GetItem(r.Context(), s.DB, req.ItemID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, item, http.StatusOK)
+}
+
+// POST /orders/quote — what an order would cost now, promotions and tax
+// included; per-user promotion limits are only checked when ordering
+func (s *Server) quoteOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var req quoteReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	order := db.NewOrder{
+		Items:           make(map[int]int),
+		PostalCode:      req.PostalCode,
+		PromoCode:       req.PromoCode,
+		SlotID:          req.SlotID,
+		DeliveryAddress: req.DeliveryAddress,
+	}
+	for _, line := range req.Items {
+		order.Items[line.ItemID] += line.Quantity
+	}
+	quote, err := db.QuoteOrder(r.Context(), s.DB, order)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, quote, http.StatusOK)
+}
+
+// GET /tax/rates
+func (s *Server) getTaxRatesHandler(w http.ResponseWriter, r *http.Request) {
+	rates, err := db.ListTaxRates(r.Context(), s.DB)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, rates, http.StatusOK)
+}
+
+// POST /tax/rates — create or replace a rate
+func (s *Server) putTaxRateHandler(w http.ResponseWriter, r *http.Request) {
+	var req taxRateReq
+	if err := decodeJSON(w, r, &req); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rate := tax.Rate{
+		Jurisdiction: req.Jurisdiction,
+		Category:     req.Category,
+		VendorID:     req.VendorID,
+		BasisPoints:  req.BasisPoints,
+		Rounding:     tax.Rounding(req.Rounding),
+	}
+	if rate.Rounding != "" && !rate.Rounding.Valid() {
+		writeError(w, r, validationError([]FieldError{{"rounding", "must be half_up, half_even, up or down"}}))
+		return
+	}
+	rate, err := db.PutTaxRate(r.Context(), s.DB, rate)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, rate, http.StatusOK)
+}
+
+// DELETE /tax/rates?id=3
+func (s *Server) deleteTaxRateHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid id"))
+		return
+	}
+	if err := db.DeleteTaxRate(r.Context(), s.DB, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /reports/tax?from=2025-01-01&to=2025-02-01&vendor_id=3 — the period
+// defaults to the current month, and to to a month after from
+func (s *Server) taxReportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var err error
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "from must be a date (YYYY-MM-DD)"))
+			return
+		}
+	}
+	to := from.AddDate(0, 1, 0)
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.DateOnly, v); err != nil {
+			writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "to must be a date (YYYY-MM-DD)"))
+			return
+		}
+	}
+	if !to.After(from) {
+		writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "to must be after from"))
+		return
+	}
+	var vendorID int64
+	if v := q.Get("vendor_id"); v != "" {
+		if vendorID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, r, newError(http.StatusBadRequest, CodeBadRequest, "invalid vendor_id"))
+			return
+		}
+	}
+	summary, err := db.TaxReport(r.Context(), s.DB, from, to, vendorID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	jsonResponse(w, r, taxReport{From: from, To: to, Summary: summary}, http.StatusOK)
+}
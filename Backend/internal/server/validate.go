@@ -0,0 +1,273 @@
+// internal/server/validate.go
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxJSONBody caps every JSON request body.
+const maxJSONBody = 1 << 20
+
+// Request structs declare their rules in a `validate` tag, e.g.
+//
+//	Name  string `json:"name" validate:"required,max=255"`
+//	Stock int    `json:"stock" validate:"min=0"`
+//
+// Supported rules:
+//
+//	required  strings must be non‑blank, slices non‑empty, pointers non‑nil;
+//	          on form fields it also means the field must be present
+//	min=N     numbers must be >= N; strings and slices need length >= N
+//	max=N     numbers must be <= N; strings and slices need length <= N
+//
+// Nested structs and slices of structs are validated recursively, and every
+// failure is collected so the client sees all of them at once.
+
+// decodeJSON strictly decodes the request body into dst and validates it.
+// Unknown fields, trailing data and bodies over maxJSONBody are rejected.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBody)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return jsonDecodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return newError(http.StatusBadRequest, CodeInvalidJSON, "request body must contain a single JSON object")
+	}
+	return validate(dst)
+}
+
+// decodeForm fills dst from an already‑parsed (multipart) form using each
+// field's `form` tag, then applies the same rules as decodeJSON.
+func decodeForm(r *http.Request, dst any) error {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	var errs []FieldError
+	reported := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("form")
+		if name == "" {
+			continue
+		}
+		raw := strings.TrimSpace(r.FormValue(name))
+		if raw == "" {
+			if hasRule(f, "required") {
+				errs = append(errs, FieldError{name, "is required"})
+				reported[name] = true
+			}
+			continue
+		}
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(raw)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				errs = append(errs, FieldError{name, "must be a whole number"})
+				reported[name] = true
+				continue
+			}
+			fv.SetInt(n)
+		case reflect.Float64:
+			n, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				errs = append(errs, FieldError{name, "must be a number"})
+				reported[name] = true
+				continue
+			}
+			fv.SetFloat(n)
+		default:
+			panic(fmt.Sprintf("decodeForm: unsupported field type %s", fv.Type()))
+		}
+	}
+	for _, fe := range fieldErrors(dst) {
+		if !reported[fe.Field] {
+			errs = append(errs, fe)
+		}
+	}
+	if len(errs) > 0 {
+		return validationError(errs)
+	}
+	return nil
+}
+
+// validate checks dst's `validate` tags and returns a 400 APIError listing
+// every failing field, or nil.
+func validate(dst any) error {
+	if errs := fieldErrors(dst); len(errs) > 0 {
+		return validationError(errs)
+	}
+	return nil
+}
+
+// fieldErrors collects every rule violation in dst.
+func fieldErrors(dst any) []FieldError {
+	var errs []FieldError
+	checkStruct(reflect.Indirect(reflect.ValueOf(dst)), "", &errs)
+	return errs
+}
+
+func validationError(errs []FieldError) *APIError {
+	e := newError(http.StatusBadRequest, CodeValidation, "request validation failed")
+	e.Details = errs
+	return e
+}
+
+func checkStruct(v reflect.Value, prefix string, errs *[]FieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := prefix + fieldName(f)
+		fv := v.Field(i)
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			if rule == "" {
+				continue
+			}
+			if msg := checkRule(fv, rule); msg != "" {
+				*errs = append(*errs, FieldError{name, msg})
+				break
+			}
+		}
+		switch fv.Kind() {
+		case reflect.Struct:
+			checkStruct(fv, name+".", errs)
+		case reflect.Slice:
+			if fv.Type().Elem().Kind() == reflect.Struct {
+				for j := 0; j < fv.Len(); j++ {
+					checkStruct(fv.Index(j), fmt.Sprintf("%s[%d].", name, j), errs)
+				}
+			}
+		}
+	}
+}
+
+// checkRule applies one rule to v and returns a message if it fails.
+func checkRule(v reflect.Value, rule string) string {
+	key, arg, _ := strings.Cut(rule, "=")
+	switch key {
+	case "required":
+		switch v.Kind() {
+		case reflect.String:
+			if strings.TrimSpace(v.String()) == "" {
+				return "is required"
+			}
+		case reflect.Slice, reflect.Map:
+			if v.Len() == 0 {
+				return "must not be empty"
+			}
+		case reflect.Pointer:
+			if v.IsNil() {
+				return "is required"
+			}
+		}
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: bad rule %q", rule))
+		}
+		n, unit := measure(v)
+		if key == "min" && n < limit {
+			return fmt.Sprintf("must be at least %s%s", arg, unit)
+		}
+		if key == "max" && n > limit {
+			return fmt.Sprintf("must be at most %s%s", arg, unit)
+		}
+	default:
+		panic(fmt.Sprintf("validate: unknown rule %q", rule))
+	}
+	return ""
+}
+
+// measure returns the number min/max compare against, plus a unit suffix
+// for the error message.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	case reflect.String:
+		return float64(len([]rune(v.String()))), " characters"
+	case reflect.Slice, reflect.Map:
+		return float64(v.Len()), " entries"
+	}
+	panic(fmt.Sprintf("validate: min/max on unsupported type %s", v.Type()))
+}
+
+func hasRule(f reflect.StructField, rule string) bool {
+	for _, r := range strings.Split(f.Tag.Get("validate"), ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldName is the name the client used for f: its json or form tag.
+func fieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		if name, _, _ := strings.Cut(f.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+// jsonDecodeError turns an encoding/json failure into a client error.
+func jsonDecodeError(err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		sizeErr   *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &sizeErr):
+		return newError(http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+			fmt.Sprintf("request body must not exceed %d bytes", sizeErr.Limit))
+	case errors.As(err, &typeErr):
+		return validationError([]FieldError{{typeErr.Field, "must be " + jsonTypeName(typeErr.Type)}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return validationError([]FieldError{{field, "is not a known field"}})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return wrapError(http.StatusBadRequest, CodeInvalidJSON, "malformed JSON", err)
+	case errors.Is(err, io.EOF):
+		return newError(http.StatusBadRequest, CodeInvalidJSON, "request body must not be empty")
+	}
+	return wrapError(http.StatusBadRequest, CodeInvalidJSON, "invalid JSON", err)
+}
+
+// jsonTypeName describes t the way a JSON client would think of it.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Pointer:
+		return jsonTypeName(t.Elem())
+	}
+	return "an object"
+}
@@ -0,0 +1,198 @@
+// internal/server/validate_test.go
+package server
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testLine struct {
+	SKU      string `json:"sku" validate:"required"`
+	Quantity int    `json:"quantity" validate:"min=1,max=99"`
+}
+
+type testReq struct {
+	Name  string     `json:"name" validate:"required,max=5"`
+	Tags  []string   `json:"tags" validate:"max=2"`
+	Note  *string    `json:"note" validate:"required"`
+	Lines []testLine `json:"lines" validate:"required"`
+	Price float64    `json:"price" validate:"min=0.5"`
+}
+
+// decode runs decodeJSON on body and returns the APIError it gives.
+func decode(t *testing.T, body string, dst any) *APIError {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	err := decodeJSON(httptest.NewRecorder(), r, dst)
+	if err == nil {
+		return nil
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("decodeJSON returned %T %v, want an *APIError", err, err)
+	}
+	return apiErr
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		code    string
+		details []FieldError
+	}{
+		{
+			name: "valid",
+			body: `{"name":"eggs","tags":["a"],"note":"","lines":[{"sku":"E1","quantity":2}],"price":1}`,
+		},
+		{
+			name:   "every rule at once",
+			body:   `{"name":"  ","tags":["a","b","c"],"lines":[{"sku":"","quantity":0},{"sku":"X","quantity":100}],"price":0.25}`,
+			status: http.StatusBadRequest,
+			code:   CodeValidation,
+			details: []FieldError{
+				{"name", "is required"},
+				{"tags", "must be at most 2 entries"},
+				{"note", "is required"},
+				{"lines[0].sku", "is required"},
+				{"lines[0].quantity", "must be at least 1"},
+				{"lines[1].quantity", "must be at most 99"},
+				{"price", "must be at least 0.5"},
+			},
+		},
+		{
+			name:    "too long",
+			body:    `{"name":"éééééé","note":"","lines":[{"sku":"E1","quantity":1}],"price":1}`,
+			status:  http.StatusBadRequest,
+			code:    CodeValidation,
+			details: []FieldError{{"name", "must be at most 5 characters"}},
+		},
+		{
+			name:    "empty slice",
+			body:    `{"name":"eggs","note":"","lines":[],"price":1}`,
+			status:  http.StatusBadRequest,
+			code:    CodeValidation,
+			details: []FieldError{{"lines", "must not be empty"}},
+		},
+		{
+			name:    "unknown field",
+			body:    `{"name":"eggs","colour":"brown"}`,
+			status:  http.StatusBadRequest,
+			code:    CodeValidation,
+			details: []FieldError{{"colour", "is not a known field"}},
+		},
+		{
+			name:    "wrong type",
+			body:    `{"price":"cheap"}`,
+			status:  http.StatusBadRequest,
+			code:    CodeValidation,
+			details: []FieldError{{"price", "must be a number"}},
+		},
+		{name: "malformed", body: `{"name":`, status: http.StatusBadRequest, code: CodeInvalidJSON},
+		{name: "empty", body: ``, status: http.StatusBadRequest, code: CodeInvalidJSON},
+		{name: "trailing data", body: `{} {}`, status: http.StatusBadRequest, code: CodeInvalidJSON},
+		{
+			name:   "over 1 MB",
+			body:   `{"name":"` + strings.Repeat("x", maxJSONBody) + `"}`,
+			status: http.StatusRequestEntityTooLarge,
+			code:   CodePayloadTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decode(t, tt.body, &testReq{})
+			if tt.code == "" {
+				if got != nil {
+					t.Fatalf("unexpected error %v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("no error, want %s", tt.code)
+			}
+			if got.Status != tt.status || got.Code != tt.code {
+				t.Errorf("got %d %s, want %d %s", got.Status, got.Code, tt.status, tt.code)
+			}
+			if tt.details != nil && !reflect.DeepEqual(got.Details, tt.details) {
+				t.Errorf("details %v, want %v", got.Details, tt.details)
+			}
+		})
+	}
+}
+
+// multipartRequest builds a parsed multipart request from fields.
+func multipartRequest(t *testing.T, fields map[string]string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/", &buf)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDecodeForm(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		want    addItemReq
+		details []FieldError
+	}{
+		{
+			name:   "valid",
+			fields: map[string]string{"name": " Eggs ", "price": "4.5", "stock": "12", "vendor_id": "3"},
+			want:   addItemReq{Name: "Eggs", Price: 4.5, Stock: 12, VendorID: 3},
+		},
+		{
+			name:   "missing and malformed",
+			fields: map[string]string{"price": "cheap", "stock": "1.5"},
+			details: []FieldError{
+				{"name", "is required"},
+				{"price", "must be a number"},
+				{"stock", "must be a whole number"},
+			},
+		},
+		{
+			name:    "out of range",
+			fields:  map[string]string{"name": "Eggs", "price": "4", "stock": "-1"},
+			details: []FieldError{{"stock", "must be at least 0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got addItemReq
+			err := decodeForm(multipartRequest(t, tt.fields), &got)
+			if tt.details == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("got %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != CodeValidation {
+				t.Fatalf("err %v, want %s", err, CodeValidation)
+			}
+			if !reflect.DeepEqual(apiErr.Details, tt.details) {
+				t.Errorf("details %v, want %v", apiErr.Details, tt.details)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// internal/storage/local.go
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local keeps blobs in a directory on this machine and serves them itself
+// (it is an http.Handler, mounted under BaseURL). It is only suitable for a
+// single replica.
+//
+// With a SigningKey and a URLTTL, URL hands out links carrying an expiry
+// and an HMAC, and ServeHTTP refuses any request without a valid one;
+// otherwise URLs are public.
+type Local struct {
+	Dir        string        // root directory
+	BaseURL    string        // URL path the handler is mounted at, e.g. "/uploads"
+	SigningKey []byte        // HMAC key for signed URLs; nil means public URLs
+	URLTTL     time.Duration // lifetime of signed URLs
+}
+
+// NewLocal returns a Local store rooted at dir, creating it if needed.
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put writes the blob to a temporary file and renames it into place, so
+// readers never see a half‑written file.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	dst := filepath.Join(l.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no‑op once renamed
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(l.Dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) URL(ctx context.Context, key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	u := l.BaseURL + "/" + (&url.URL{Path: key}).EscapedPath()
+	if l.SigningKey == nil {
+		return u, nil
+	}
+	expires := strconv.FormatInt(time.Now().Add(l.URLTTL).Unix(), 10)
+	return u + "?expires=" + expires + "&sig=" + l.sign(key, expires), nil
+}
+
+// ServeHTTP serves the blob named by the request path, which must already
+// have BaseURL stripped.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if checkKey(key) != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if l.SigningKey != nil {
+		expires := r.URL.Query().Get("expires")
+		sig, err := hex.DecodeString(r.URL.Query().Get("sig"))
+		want, _ := hex.DecodeString(l.sign(key, expires))
+		unix, _ := strconv.ParseInt(expires, 10, 64)
+		if err != nil || !hmac.Equal(sig, want) || time.Now().Unix() > unix {
+			http.Error(w, "link expired or invalid", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(max(unix-time.Now().Unix(), 0), 10))
+	}
+	name := filepath.Join(l.Dir, filepath.FromSlash(key))
+	if fi, err := os.Stat(name); err != nil || fi.IsDir() {
+		http.NotFound(w, r) // and no directory listings
+		return
+	}
+	http.ServeFile(w, r, name)
+}
+
+func (l *Local) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, l.SigningKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,38 @@
+// internal/storage/storage.go
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// BlobStore keeps uploaded files such as product images. Keys are
+// slash‑separated relative paths ("items/12-3f9c.jpg"); what the database
+// stores is the key, and URL turns it into something a browser can fetch.
+type BlobStore interface {
+	// Put stores size bytes from r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns where clients can download key. Depending on the store's
+	// configuration it is either a stable public URL or a signed one that
+	// expires.
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// ErrBadKey is returned for keys that are empty, absolute or try to
+// escape the store with "..".
+var ErrBadKey = errors.New("invalid blob key")
+
+// checkKey rejects keys that could address something outside the store.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return ErrBadKey
+	}
+	return nil
+}
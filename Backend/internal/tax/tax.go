@@ -0,0 +1,106 @@
+// internal/tax/tax.go
+package tax
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultCategory is the tax category of items that don't name one.
+// Untaxed goods simply have a category with no rates, e.g. "grocery".
+const DefaultCategory = "general"
+
+// Rounding is how a line's exact tax is turned into whole cents.
+type Rounding string
+
+const (
+	HalfUp   Rounding = "half_up"   // nearest cent, halves up (the default)
+	HalfEven Rounding = "half_even" // nearest cent, halves to even
+	Up       Rounding = "up"        // any fraction of a cent is a cent
+	Down     Rounding = "down"      // fractions of a cent are dropped
+)
+
+// Valid reports whether r is one of the rounding rules above.
+func (r Rounding) Valid() bool {
+	switch r {
+	case HalfUp, HalfEven, Up, Down:
+		return true
+	}
+	return false
+}
+
+// Rate is the tax on one category of goods in one jurisdiction, optionally
+// for a single vendor's goods only.
+type Rate struct {
+	ID int64 `json:"id"`
+
+	// Jurisdiction is a postal‑code prefix (normalised, see PostalCode);
+	// the empty prefix matches every address.
+	Jurisdiction string `json:"jurisdiction"`
+	Category     string `json:"category"`
+	VendorID     int64  `json:"vendor_id,omitempty"` // 0 for every vendor
+
+	// BasisPoints is the rate in hundredths of a percent: 825 is 8.25%.
+	BasisPoints int64    `json:"basis_points"`
+	Rounding    Rounding `json:"rounding"`
+}
+
+// Tax is the tax on amount (in cents), rounded by r.Rounding.
+func (r Rate) Tax(amount int64) int64 {
+	if amount <= 0 || r.BasisPoints <= 0 {
+		return 0
+	}
+	n := amount * r.BasisPoints
+	q, rem := n/10000, n%10000
+	switch r.Rounding {
+	case Down:
+	case Up:
+		if rem > 0 {
+			q++
+		}
+	case HalfEven:
+		if rem > 5000 || rem == 5000 && q%2 == 1 {
+			q++
+		}
+	default:
+		if rem >= 5000 {
+			q++
+		}
+	}
+	return q
+}
+
+// PostalCode normalises a postal code for matching: upper case, without
+// spaces or dashes.
+func PostalCode(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// Match finds the rate for a vendor's goods of category shipped to
+// postalCode. The longest matching jurisdiction wins, and within it a rate
+// for the vendor beats one for every vendor. ok is false if no rate
+// applies, i.e. the goods are untaxed there.
+func Match(rates []Rate, postalCode string, vendorID int64, category string) (_ Rate, ok bool) {
+	postalCode = PostalCode(postalCode)
+	var best Rate
+	for _, r := range rates {
+		if r.Category != category || !strings.HasPrefix(postalCode, r.Jurisdiction) {
+			continue
+		}
+		if r.VendorID != 0 && r.VendorID != vendorID {
+			continue
+		}
+		switch {
+		case !ok,
+			len(r.Jurisdiction) > len(best.Jurisdiction),
+			len(r.Jurisdiction) == len(best.Jurisdiction) && r.VendorID != 0:
+			best, ok = r, true
+		}
+	}
+	return best, ok
+}
@@ -0,0 +1,96 @@
+// internal/tax/tax_test.go
+package tax
+
+import "testing"
+
+func TestRateTax(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		bp     int64
+		want   map[Rounding]int64
+	}{
+		{"exact", 1000, 1000, map[Rounding]int64{HalfUp: 100, HalfEven: 100, Up: 100, Down: 100}},
+		{"below half", 1234, 1000, map[Rounding]int64{HalfUp: 123, HalfEven: 123, Up: 124, Down: 123}},
+		{"above half", 1236, 1000, map[Rounding]int64{HalfUp: 124, HalfEven: 124, Up: 124, Down: 123}},
+		{"half, to an even cent", 1000, 825, map[Rounding]int64{HalfUp: 83, HalfEven: 82, Up: 83, Down: 82}},
+		{"half, to an odd cent", 1400, 825, map[Rounding]int64{HalfUp: 116, HalfEven: 116, Up: 116, Down: 115}},
+		{"just over half", 1001, 825, map[Rounding]int64{HalfUp: 83, HalfEven: 83, Up: 83, Down: 82}},
+		{"a sliver of a cent", 1, 1, map[Rounding]int64{HalfUp: 0, HalfEven: 0, Up: 1, Down: 0}},
+		{"nothing to tax", 0, 825, map[Rounding]int64{HalfUp: 0, HalfEven: 0, Up: 0, Down: 0}},
+		{"discounted below zero", -500, 825, map[Rounding]int64{HalfUp: 0, HalfEven: 0, Up: 0, Down: 0}},
+		{"zero rate", 1000, 0, map[Rounding]int64{HalfUp: 0, HalfEven: 0, Up: 0, Down: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for rounding, want := range tt.want {
+				r := Rate{BasisPoints: tt.bp, Rounding: rounding}
+				if got := r.Tax(tt.amount); got != want {
+					t.Errorf("%s: %d bp of %d is %d, want %d", rounding, tt.bp, tt.amount, got, want)
+				}
+			}
+			// no rounding rule rounds half up
+			if got, want := (Rate{BasisPoints: tt.bp}).Tax(tt.amount), tt.want[HalfUp]; got != want {
+				t.Errorf("default: %d bp of %d is %d, want %d", tt.bp, tt.amount, got, want)
+			}
+		})
+	}
+}
+
+func TestPostalCode(t *testing.T) {
+	tests := map[string]string{
+		"94107":      "94107",
+		"sw1a 1aa":   "SW1A1AA",
+		" SW1A-1AA ": "SW1A1AA",
+		"k1a\t0b1":   "K1A0B1",
+		"":           "",
+	}
+	for in, want := range tests {
+		if got := PostalCode(in); got != want {
+			t.Errorf("PostalCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rates := []Rate{
+		{ID: 1, Jurisdiction: "", Category: DefaultCategory, BasisPoints: 500},
+		{ID: 2, Jurisdiction: "94", Category: DefaultCategory, BasisPoints: 725},
+		{ID: 3, Jurisdiction: "941", Category: DefaultCategory, BasisPoints: 863},
+		{ID: 4, Jurisdiction: "94", Category: DefaultCategory, VendorID: 7, BasisPoints: 600},
+		{ID: 5, Jurisdiction: "941", Category: "food", BasisPoints: 100},
+		{ID: 6, Jurisdiction: "SW1A", Category: DefaultCategory, BasisPoints: 2000},
+	}
+	tests := []struct {
+		name       string
+		postalCode string
+		vendorID   int64
+		category   string
+		want       int64 // rate ID, 0 for untaxed
+	}{
+		{"everywhere else", "10001", 0, DefaultCategory, 1},
+		{"longest prefix", "94107", 0, DefaultCategory, 3},
+		{"shorter prefix", "94301", 0, DefaultCategory, 2},
+		{"vendor rate beats every vendor's", "94301", 7, DefaultCategory, 4},
+		{"longer prefix beats the vendor's", "94107", 7, DefaultCategory, 3},
+		{"another vendor's rate doesn't apply", "94301", 8, DefaultCategory, 2},
+		{"other category", "94107", 0, "food", 5},
+		{"category with no rate there", "10001", 0, "food", 0},
+		{"unknown category", "94107", 0, "books", 0},
+		{"normalised postal code", "sw1a 1aa", 0, DefaultCategory, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := Match(rates, tt.postalCode, tt.vendorID, tt.category)
+			if ok != (tt.want != 0) || r.ID != tt.want {
+				t.Errorf("got rate %d (ok %v), want %d", r.ID, ok, tt.want)
+			}
+		})
+	}
+
+	// ties go to the vendor's rate whichever comes first
+	tied := []Rate{rates[3], rates[1]}
+	if r, _ := Match(tied, "94301", 7, DefaultCategory); r.ID != 4 {
+		t.Errorf("tie listed vendor first: got rate %d, want 4", r.ID)
+	}
+}
@@ -9,7 +9,7 @@ const LogoutButton = ({ onLogout }) => {
   const handleLogout = async () => {
     setLoading(true);
     try {
-      const res = await fetch("http://localhost:8080/logout", {
+      const res = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/api/v1/logout`, {
         method: "POST",
         credentials: "include",
       });
@@ -14,7 +14,7 @@ export default function NavigationBar() {
   const count = getTotalItems();
 
   useEffect(() => {
-    fetch(`${process.env.NEXT_PUBLIC_API_URL}/me`, { credentials: "include" })
+    fetch(`${process.env.NEXT_PUBLIC_API_URL}/api/v1/me`, { credentials: "include" })
       .then((res) => (res.ok ? res.json() : Promise.reject()))
       .then(setUser)
       .catch(() => setUser(null));
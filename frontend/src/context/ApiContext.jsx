@@ -3,7 +3,18 @@ import { createContext, useContext } from "react";
 const ApiContext = createContext();
 
 export const ApiProvider = ({ children }) => {
-  const apiUrl = process.env.NEXT_PUBLIC_API_URL;
+  // the versioned API; the root aliases are deprecated
+  const apiUrl = `${process.env.NEXT_PUBLIC_API_URL}/api/v1`;
+
+  // turns the backend's {"error": {...}} envelope into a readable Error
+  const apiError = async (res, action) => {
+    const body = await res.json().catch(() => null);
+    const message = body?.error?.message ?? res.statusText;
+    const err = new Error(`${action} failed: ${message}`);
+    err.code = body?.error?.code;
+    err.details = body?.error?.details;
+    return err;
+  };
 
   // now accepts FormData (for file uploads)
   const addItemApi = async (formData) => {
@@ -12,7 +23,7 @@ export const ApiProvider = ({ children }) => {
       credentials: "include", // include cookies
       body: formData, // browser sets multipart boundaries
     });
-    if (!res.ok) throw new Error(`Add item failed: ${res.statusText}`);
+    if (!res.ok) throw await apiError(res, "Add item");
     return res.json();
   };
 
@@ -23,7 +34,7 @@ export const ApiProvider = ({ children }) => {
       headers: { "Content-Type": "application/json" },
       body: JSON.stringify(data),
     });
-    if (!res.ok) throw new Error(`Update item failed: ${res.statusText}`);
+    if (!res.ok) throw await apiError(res, "Update item");
     return res.json();
   };
 
@@ -34,7 +45,7 @@ export const ApiProvider = ({ children }) => {
     const res = await fetch(url, {
       credentials: "include",
     });
-    if (!res.ok) throw new Error(`Fetch orders failed: ${res.statusText}`);
+    if (!res.ok) throw await apiError(res, "Fetch orders");
     return res.json();
   };
 
@@ -45,7 +56,7 @@ export const ApiProvider = ({ children }) => {
       headers: { "Content-Type": "application/json" },
       body: JSON.stringify(order),
     });
-    if (!res.ok) throw new Error(`Post order failed: ${res.statusText}`);
+    if (!res.ok) throw await apiError(res, "Post order");
     return res.json();
   };
 
@@ -54,7 +65,7 @@ export const ApiProvider = ({ children }) => {
       method: "DELETE",
       credentials: "include",
     });
-    if (!res.ok) throw new Error(`Delete order failed: ${res.statusText}`);
+    if (!res.ok) throw await apiError(res, "Delete order");
     return res.text();
   };
 
@@ -21,9 +21,14 @@ export default function ListingPage({ items }) {
       {/* Grid */}
       <div className="grid grid-cols-1 gap-6 sm:grid-cols-2 md:grid-cols-3 lg:grid-cols-4">
         {items.map((item) => {
-          const src = item.image_url
-            ? `${apiUrl}${item.image_url}`
-            : "/Question-Mark.png";
+          // Cards use the medium variant. Local uploads come back as a
+          // path on the API host; S3 and signed URLs are already absolute.
+          const img = item.images?.medium ?? item.image_url;
+          const src = !img
+            ? "/Question-Mark.png"
+            : /^https?:\/\//.test(img)
+              ? img
+              : `${apiUrl}${img}`;
 
           return (
             <ListingCard
@@ -43,7 +48,7 @@ export default function ListingPage({ items }) {
 }
 
 export async function getServerSideProps() {
-  const res = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/items`);
+  const res = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/api/v1/items`);
   const items = await res.json();
   return { props: { items } };
 }
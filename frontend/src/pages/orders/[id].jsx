@@ -13,7 +13,7 @@ export default function OrderDetailPage({ order }) {
 
   const handleDelete = async () => {
     await fetch(
-      `${process.env.NEXT_PUBLIC_API_URL}/orders?order_id=${order.id}`,
+      `${process.env.NEXT_PUBLIC_API_URL}/api/v1/orders?order_id=${order.id}`,
       { method: "DELETE" },
     );
     router.push("/orders");
@@ -67,7 +67,7 @@ export default function OrderDetailPage({ order }) {
 }
 
 export async function getServerSideProps({ params }) {
-  const api = process.env.NEXT_PUBLIC_API_URL;
+  const api = `${process.env.NEXT_PUBLIC_API_URL}/api/v1`;
   const { id } = params;
 
   // 1) Fetch the order + its items